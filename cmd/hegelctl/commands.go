@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/Jacalz/hegelmote/internal/upnp"
+	"github.com/Jacalz/hegelmote/remote"
+)
+
+// controller is the part of [remote.Control] and [remote.ControlWithListener] that the commands use.
+type controller interface {
+	remote.Amplifier
+
+	TogglePowerContext(ctx context.Context) (bool, error)
+	ToggleVolumeMuteContext(ctx context.Context) (bool, error)
+	VolumeUpContext(ctx context.Context) (remote.Volume, error)
+	VolumeDownContext(ctx context.Context) (remote.Volume, error)
+	SetResetDelayContext(ctx context.Context, delay remote.Minutes) (remote.Delay, error)
+	StopResetDelayContext(ctx context.Context) (remote.Delay, error)
+	GetResetDelayContext(ctx context.Context) (remote.Delay, error)
+	SendRawContext(ctx context.Context, command byte, arg string) (remote.Response, error)
+}
+
+type command func(ctx context.Context, control controller, args []string) (fmt.Stringer, error)
+
+var commands = map[string]command{
+	"power":       powerCommand,
+	"volume":      volumeCommand,
+	"mute":        muteCommand,
+	"input":       inputCommand,
+	"reset-delay": resetDelayCommand,
+	"status":      statusCommand,
+}
+
+func runCommand(ctx context.Context, opts *options, name string, args []string) (fmt.Stringer, error) {
+	if name == "discover" {
+		return discover(args)
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		return nil, usageErrorf("unknown command %q", name)
+	}
+
+	err := opts.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	model, err := opts.model()
+	if err != nil {
+		return nil, err
+	}
+
+	control := &remote.Control{}
+	err = control.ConnectWithConfig(ctx, opts.Host, model, opts.connectConfig())
+	if err != nil {
+		return nil, &connectionError{err: err}
+	}
+	defer control.Disconnect()
+
+	return cmd(ctx, control, args)
+}
+
+// onOff is a boolean state that is printed as "on" or "off".
+type onOff bool
+
+func (o onOff) String() string {
+	if o {
+		return "on"
+	}
+	return "off"
+}
+
+type powerResult struct {
+	Power onOff `json:"power"`
+}
+
+func (r powerResult) String() string {
+	return r.Power.String()
+}
+
+func powerCommand(ctx context.Context, control controller, args []string) (fmt.Stringer, error) {
+	on, err := applyOnOff(ctx, args, control.GetPowerContext, control.SetPowerContext, control.TogglePowerContext)
+	return powerResult{Power: onOff(on)}, err
+}
+
+type muteResult struct {
+	Mute onOff `json:"mute"`
+}
+
+func (r muteResult) String() string {
+	return r.Mute.String()
+}
+
+func muteCommand(ctx context.Context, control controller, args []string) (fmt.Stringer, error) {
+	muted, err := applyOnOff(ctx, args, control.GetVolumeMuteContext, control.SetVolumeMuteContext, control.ToggleVolumeMuteContext)
+	return muteResult{Mute: onOff(muted)}, err
+}
+
+func applyOnOff(
+	ctx context.Context, args []string,
+	get func(context.Context) (bool, error),
+	set func(context.Context, bool) (bool, error),
+	toggle func(context.Context) (bool, error),
+) (bool, error) {
+	if len(args) > 1 {
+		return false, usageErrorf("expected at most one argument, got %d", len(args))
+	} else if len(args) == 0 {
+		return get(ctx)
+	}
+
+	switch args[0] {
+	case "on":
+		return set(ctx, true)
+	case "off":
+		return set(ctx, false)
+	case "toggle":
+		return toggle(ctx)
+	}
+
+	return false, usageErrorf("expected on, off or toggle, got %q", args[0])
+}
+
+type volumeResult struct {
+	Volume remote.Volume `json:"volume"`
+}
+
+func (r volumeResult) String() string {
+	return strconv.Itoa(int(r.Volume))
+}
+
+func volumeCommand(ctx context.Context, control controller, args []string) (fmt.Stringer, error) {
+	if len(args) > 1 {
+		return nil, usageErrorf("expected at most one argument, got %d", len(args))
+	}
+
+	var volume remote.Volume
+	var err error
+	switch {
+	case len(args) == 0:
+		volume, err = control.GetVolumeContext(ctx)
+	case args[0] == "up":
+		volume, err = control.VolumeUpContext(ctx)
+	case args[0] == "down":
+		volume, err = control.VolumeDownContext(ctx)
+	default:
+		number, parseErr := strconv.ParseUint(args[0], 10, 8)
+		if parseErr != nil || number > 100 {
+			return nil, usageErrorf("expected a volume between 0 and 100, up or down, got %q", args[0])
+		}
+		volume, err = control.SetVolumeContext(ctx, remote.Volume(number))
+	}
+
+	return volumeResult{Volume: volume}, err
+}
+
+type inputResult struct {
+	Input device.Input `json:"input"`
+	Name  string       `json:"name"`
+}
+
+func (r inputResult) String() string {
+	return fmt.Sprintf("%d (%s)", r.Input, r.Name)
+}
+
+func newInputResult(model device.Type, input device.Input) inputResult {
+	name, _ := device.NameFromNumber(model, input)
+	return inputResult{Input: input, Name: name}
+}
+
+func inputCommand(ctx context.Context, control controller, args []string) (fmt.Stringer, error) {
+	if len(args) == 0 {
+		input, err := control.GetInputContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return newInputResult(control.GetDeviceType(), input), nil
+	}
+
+	input, err := parseInput(control.GetDeviceType(), strings.Join(args, " "))
+	if err != nil {
+		return nil, err
+	}
+
+	input, err = control.SetInputContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	return newInputResult(control.GetDeviceType(), input), nil
+}
+
+// parseInput parses an input number or a case-insensitive input name.
+func parseInput(model device.Type, arg string) (device.Input, error) {
+	names, err := device.GetInputNames(model)
+	if err != nil {
+		return 0, err
+	}
+
+	if number, err := strconv.ParseUint(arg, 10, 8); err == nil {
+		if number == 0 || number > uint64(len(names)) {
+			return 0, usageErrorf("input %d is out of range, the %s has %d inputs", number, model, len(names))
+		}
+		return device.Input(number), nil
+	}
+
+	index := slices.IndexFunc(names, func(name string) bool { return strings.EqualFold(name, arg) })
+	if index == -1 {
+		return 0, usageErrorf("unknown input %q, expected one of %q", arg, names)
+	}
+
+	return device.Input(index + 1), nil // #nosec G115 -- Inputs are few.
+}
+
+type resetDelayResult struct {
+	Minutes *remote.Minutes `json:"minutes"`
+}
+
+func (r resetDelayResult) String() string {
+	if r.Minutes == nil {
+		return "stopped"
+	}
+	return fmt.Sprintf("%d minutes", *r.Minutes)
+}
+
+func newResetDelayResult(delay remote.Delay) resetDelayResult {
+	if delay.Stopped {
+		return resetDelayResult{}
+	}
+	return resetDelayResult{Minutes: &delay.Minutes}
+}
+
+func resetDelayCommand(ctx context.Context, control controller, args []string) (fmt.Stringer, error) {
+	if len(args) > 1 {
+		return nil, usageErrorf("expected at most one argument, got %d", len(args))
+	}
+
+	var delay remote.Delay
+	var err error
+	switch {
+	case len(args) == 0:
+		delay, err = control.GetResetDelayContext(ctx)
+	case args[0] == "stop":
+		delay, err = control.StopResetDelayContext(ctx)
+	default:
+		minutes, parseErr := strconv.ParseUint(args[0], 10, 8)
+		if parseErr != nil {
+			return nil, usageErrorf("expected minutes between 0 and 255 or stop, got %q", args[0])
+		}
+		delay, err = control.SetResetDelayContext(ctx, remote.Minutes(minutes))
+	}
+
+	return newResetDelayResult(delay), err
+}
+
+type statusResult struct {
+	Model      string           `json:"model"`
+	Power      onOff            `json:"power"`
+	Volume     remote.Volume    `json:"volume"`
+	Mute       onOff            `json:"mute"`
+	Input      inputResult      `json:"input"`
+	ResetDelay resetDelayResult `json:"resetDelay"`
+}
+
+func (r statusResult) String() string {
+	return fmt.Sprintf("Model:       Hegel %s\nPower:       %s\nVolume:      %d\nMute:        %s\nInput:       %s\nReset delay: %s",
+		r.Model, r.Power, r.Volume, r.Mute, r.Input, r.ResetDelay)
+}
+
+func statusCommand(ctx context.Context, control controller, args []string) (fmt.Stringer, error) {
+	if len(args) > 0 {
+		return nil, usageErrorf("status takes no arguments")
+	}
+
+	status := statusResult{Model: control.GetDeviceType().String()}
+	on, err := control.GetPowerContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status.Power = onOff(on)
+
+	status.Volume, err = control.GetVolumeContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	muted, err := control.GetVolumeMuteContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status.Mute = onOff(muted)
+
+	input, err := control.GetInputContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status.Input = newInputResult(control.GetDeviceType(), input)
+
+	delay, err := control.GetResetDelayContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status.ResetDelay = newResetDelayResult(delay)
+	return status, nil
+}
+
+type discoverResult struct {
+	Devices []discoveredDevice `json:"devices"`
+}
+
+type discoveredDevice struct {
+	Host  string `json:"host"`
+	Model string `json:"model"`
+}
+
+func (r discoverResult) String() string {
+	if len(r.Devices) == 0 {
+		return "No amplifiers found"
+	}
+
+	lines := make([]string, 0, len(r.Devices))
+	for _, d := range r.Devices {
+		lines = append(lines, fmt.Sprintf("Hegel %s at %s", d.Model, d.Host))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func discover(args []string) (fmt.Stringer, error) {
+	if len(args) > 0 {
+		return nil, usageErrorf("discover takes no arguments")
+	}
+
+	devices, err := upnp.LookUpDevices()
+	if err != nil {
+		return nil, err
+	}
+
+	result := discoverResult{Devices: make([]discoveredDevice, 0, len(devices))}
+	for _, d := range devices {
+		result.Devices = append(result.Devices, discoveredDevice{Host: d.Host, Model: d.Model.String()})
+	}
+	return result, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestParseInput(t *testing.T) {
+	for _, test := range []struct {
+		model device.Type
+		arg   string
+		input device.Input
+		err   string
+	}{
+		{device.H95, "1", 1, ""},
+		{device.H95, "8", 8, ""},
+		{device.H95, "usb", 7, ""},
+		{device.H95, "OPTICAL 2", 5, ""},
+		{device.H190V, "xlr", 1, ""},
+		{device.H95, "0", 0, "input 0 is out of range, the H95 has 8 inputs"},
+		{device.H95, "9", 0, "input 9 is out of range, the H95 has 8 inputs"},
+		{device.H95, "phono", 0, `unknown input "phono", expected one of ["Analog 1" "Analog 2" "Coaxial" "Optical 1" "Optical 2" "Optical 3" "USB" "Network"]`},
+		{device.H95, "", 0, `unknown input "", expected one of ["Analog 1" "Analog 2" "Coaxial" "Optical 1" "Optical 2" "Optical 3" "USB" "Network"]`},
+	} {
+		input, err := parseInput(test.model, test.arg)
+		if test.err != "" {
+			assert.EqualError(t, err, test.err, test.arg)
+			assert.Equal(t, exitUsage, exitCode(err), test.arg)
+			continue
+		}
+
+		assert.NoError(t, err, test.arg)
+		assert.Equal(t, test.input, input, test.arg)
+	}
+
+	_, err := parseInput(device.Type(-1), "1")
+	assert.Error(t, err)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/Jacalz/hegelmote/remote"
+)
+
+// options are the settings used to connect to the amplifier.
+// Flags take precedence over environment variables, which take precedence over the config file.
+type options struct {
+	Host  string `json:"host"`
+	Model string `json:"model"`
+	Port  uint   `json:"port"`
+
+	ConfigPath string        `json:"-"`
+	Timeout    time.Duration `json:"-"`
+}
+
+func defaultConfigPath() string {
+	if path := os.Getenv("HEGELCTL_CONFIG"); path != "" {
+		return path
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "hegelmote", "hegelctl.json")
+}
+
+// resolve fills in any missing options from the environment and then the config file.
+func (o *options) resolve() error {
+	o.Host = cmp.Or(o.Host, os.Getenv("HEGELCTL_HOST"))
+	o.Model = cmp.Or(o.Model, os.Getenv("HEGELCTL_MODEL"))
+	if port := os.Getenv("HEGELCTL_PORT"); o.Port == 0 && port != "" {
+		parsed, err := strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			return usageErrorf("invalid port in HEGELCTL_PORT: %q", port)
+		}
+		o.Port = uint(parsed)
+	}
+
+	if o.Host != "" && o.Model != "" && o.Port != 0 {
+		return nil
+	}
+
+	file, err := loadConfig(o.ConfigPath)
+	if err != nil {
+		return err
+	}
+
+	o.Host = cmp.Or(o.Host, file.Host)
+	o.Model = cmp.Or(o.Model, file.Model)
+	o.Port = cmp.Or(o.Port, file.Port)
+	return nil
+}
+
+func (o *options) model() (device.Type, error) {
+	if o.Host == "" {
+		return 0, usageErrorf("no host given, use -host or HEGELCTL_HOST")
+	} else if o.Model == "" {
+		return 0, usageErrorf("no model given, use -model or HEGELCTL_MODEL")
+	}
+
+	model := device.FromString(o.Model)
+	if !device.IsSupported(model) {
+		return 0, usageErrorf("unsupported model %q, expected one of %v", o.Model, device.SupportedTypeNames())
+	} else if o.Port > 65535 {
+		return 0, usageErrorf("invalid port: %d", o.Port)
+	}
+
+	return model, nil
+}
+
+// connectConfig returns how to connect to the amplifier, waiting up to the timeout for it.
+func (o *options) connectConfig() remote.ConnectConfig {
+	return remote.ConnectConfig{Port: uint16(o.Port), Timeout: o.Timeout} // #nosec G115 -- Checked by o.model().
+}
+
+func loadConfig(path string) (*options, error) {
+	config := &options{}
+	if path == "" {
+		return config, nil
+	}
+
+	data, err := os.ReadFile(path) // #nosec G304 -- The path is chosen by the user.
+	if errors.Is(err, fs.ErrNotExist) {
+		return config, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, config)
+	if err != nil {
+		return nil, usageErrorf("invalid config file %s: %v", path, err)
+	}
+
+	return config, nil
+}
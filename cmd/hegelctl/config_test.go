@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Jacalz/hegelmote/remote"
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestResolvePrecedence(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		flags    options
+		env      map[string]string
+		file     string
+		expected options
+	}{
+		{
+			name:     "flags only",
+			flags:    options{Host: "flag", Model: "H95", Port: 1},
+			file:     `{"host":"file","model":"H390","port":3}`,
+			expected: options{Host: "flag", Model: "H95", Port: 1},
+		},
+		{
+			name:     "environment over file",
+			env:      map[string]string{"HEGELCTL_HOST": "env", "HEGELCTL_MODEL": "H190", "HEGELCTL_PORT": "2"},
+			file:     `{"host":"file","model":"H390","port":3}`,
+			expected: options{Host: "env", Model: "H190", Port: 2},
+		},
+		{
+			name:     "flags over environment",
+			flags:    options{Host: "flag"},
+			env:      map[string]string{"HEGELCTL_HOST": "env", "HEGELCTL_MODEL": "H190"},
+			expected: options{Host: "flag", Model: "H190"},
+		},
+		{
+			name:     "file fills in the rest",
+			flags:    options{Model: "H95"},
+			env:      map[string]string{"HEGELCTL_PORT": "2"},
+			file:     `{"host":"file","model":"H390","port":3}`,
+			expected: options{Host: "file", Model: "H95", Port: 2},
+		},
+		{
+			name:     "port only in file",
+			flags:    options{Host: "flag"},
+			env:      map[string]string{"HEGELCTL_MODEL": "H190"},
+			file:     `{"port":3}`,
+			expected: options{Host: "flag", Model: "H190", Port: 3},
+		},
+		{
+			name:     "no config file",
+			flags:    options{Host: "flag", Model: "H95"},
+			expected: options{Host: "flag", Model: "H95"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			for _, key := range []string{"HEGELCTL_HOST", "HEGELCTL_MODEL", "HEGELCTL_PORT"} {
+				t.Setenv(key, test.env[key])
+			}
+
+			opts := test.flags
+			opts.ConfigPath = filepath.Join(t.TempDir(), "hegelctl.json")
+			if test.file != "" {
+				assert.NoError(t, os.WriteFile(opts.ConfigPath, []byte(test.file), 0o600))
+			}
+
+			assert.NoError(t, opts.resolve())
+			opts.ConfigPath = ""
+			assert.Equal(t, test.expected, opts)
+		})
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	t.Setenv("HEGELCTL_HOST", "")
+	t.Setenv("HEGELCTL_MODEL", "")
+
+	t.Setenv("HEGELCTL_PORT", "http")
+	opts := options{}
+	assert.EqualError(t, opts.resolve(), `invalid port in HEGELCTL_PORT: "http"`)
+	assert.Equal(t, exitUsage, exitCode(opts.resolve()))
+
+	t.Setenv("HEGELCTL_PORT", "")
+	opts = options{ConfigPath: filepath.Join(t.TempDir(), "hegelctl.json")}
+	assert.NoError(t, os.WriteFile(opts.ConfigPath, []byte(`{"host":`), 0o600))
+	assert.Equal(t, exitUsage, exitCode(opts.resolve()))
+}
+
+func TestOptionsModel(t *testing.T) {
+	for _, test := range []struct {
+		opts options
+		err  bool
+	}{
+		{options{Host: "amp", Model: "H95"}, false},
+		{options{Host: "amp", Model: "H190", Port: 65535}, false},
+		{options{Model: "H95"}, true},
+		{options{Host: "amp"}, true},
+		{options{Host: "amp", Model: "H1"}, true},
+		{options{Host: "amp", Model: "H95", Port: 65536}, true},
+	} {
+		_, err := test.opts.model()
+		assert.Equal(t, test.err, err != nil, "%+v", test.opts)
+	}
+}
+
+func TestConnectConfig(t *testing.T) {
+	opts := options{Port: 4000, Timeout: 3 * time.Second}
+	assert.Equal(t, remote.ConnectConfig{Port: 4000, Timeout: 3 * time.Second}, opts.connectConfig())
+}
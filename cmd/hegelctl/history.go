@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+const maxHistory = 1000
+
+func historyPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "hegelmote", "hegelctl_history")
+}
+
+// fileHistory is the shell history, kept between runs by appending each line to a file.
+// It implements [term.History].
+type fileHistory struct {
+	path    string
+	entries []string // Oldest first.
+}
+
+func loadHistory(path string) *fileHistory {
+	history := &fileHistory{path: path}
+	if path == "" {
+		return history
+	}
+
+	file, err := os.Open(path) // #nosec G304 -- The path is in the user cache directory.
+	if err != nil {
+		return history
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		history.entries = append(history.entries, scanner.Text())
+	}
+
+	history.entries = history.entries[max(len(history.entries)-maxHistory, 0):]
+	return history
+}
+
+func (h *fileHistory) Add(entry string) {
+	if entry == "" || (len(h.entries) > 0 && h.entries[len(h.entries)-1] == entry) {
+		return
+	}
+
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > maxHistory {
+		h.entries = slices.Delete(h.entries, 0, len(h.entries)-maxHistory)
+	}
+
+	h.save(entry)
+}
+
+func (h *fileHistory) save(entry string) {
+	if h.path == "" {
+		return
+	}
+
+	err := os.MkdirAll(filepath.Dir(h.path), 0o700)
+	if err != nil {
+		return
+	}
+
+	file, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600) // #nosec G304 -- The path is in the user cache directory.
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	_, _ = file.WriteString(entry + "\n")
+}
+
+func (h *fileHistory) Len() int {
+	return len(h.entries)
+}
+
+func (h *fileHistory) At(idx int) string {
+	return h.entries[len(h.entries)-1-idx]
+}
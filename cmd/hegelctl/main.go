@@ -0,0 +1,166 @@
+// Command hegelctl controls Hegel amplifiers from the command line.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Exit codes returned by the command.
+const (
+	exitOK         = 0
+	exitFailure    = 1 // The command failed, for example when the amplifier reported an error.
+	exitUsage      = 2 // The command was used incorrectly.
+	exitConnection = 3 // Connecting to the amplifier failed.
+)
+
+const usage = `Usage: hegelctl [flags] <command> [arguments]
+
+Commands:
+  power [on|off|toggle]         show or change the power state
+  volume [0-100|up|down]        show or change the volume
+  mute [on|off|toggle]          show or change muting
+  input [number|name]           show or change the input
+  reset-delay [minutes|stop]    show or change the delay until connections are reset
+  status                        show the full state of the amplifier
+  discover                      look for amplifiers on the local network
+  watch                         print changes reported by the amplifier until interrupted
+  shell                         start an interactive shell, see help within it
+
+The host, model and port are read from flags, then from the HEGELCTL_HOST,
+HEGELCTL_MODEL and HEGELCTL_PORT environment variables and lastly from the
+config file, a JSON object with "host", "model" and "port" keys.
+
+Exit codes: 0 on success, 1 if the command failed, 2 on incorrect usage
+and 3 if connecting to the amplifier failed.
+
+Flags:
+`
+
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func usageErrorf(format string, args ...any) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+type connectionError struct {
+	err error
+}
+
+func (e *connectionError) Error() string {
+	return "failed to connect: " + e.err.Error()
+}
+
+func (e *connectionError) Unwrap() error {
+	return e.err
+}
+
+// sessions are commands that keep running until stopped, instead of running once.
+var sessions = map[string]func(opts *options, args []string, stdout io.Writer, jsonOutput bool) error{
+	"watch": watch,
+	"shell": shell,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("hegelctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+
+	opts := options{}
+	flags.StringVar(&opts.Host, "host", "", "address of the amplifier")
+	flags.StringVar(&opts.Model, "model", "", "model of the amplifier, like H190")
+	flags.UintVar(&opts.Port, "port", 0, "port to connect to (default 50001)")
+	flags.StringVar(&opts.ConfigPath, "config", defaultConfigPath(), "path to the config file")
+	flags.DurationVar(&opts.Timeout, "timeout", 5*time.Second, "time to wait for the amplifier")
+	jsonOutput := flags.Bool("json", false, "print output as JSON")
+
+	err := flags.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	} else if err != nil {
+		return exitUsage
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	if session, ok := sessions[flags.Arg(0)]; ok {
+		err = session(&opts, flags.Args()[1:], stdout, *jsonOutput)
+		if err != nil {
+			printError(stderr, err, *jsonOutput)
+			return exitCode(err)
+		}
+		return exitOK
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	result, err := runCommand(ctx, &opts, flags.Arg(0), flags.Args()[1:])
+	if err != nil {
+		printError(stderr, err, *jsonOutput)
+		return exitCode(err)
+	}
+
+	err = printResult(stdout, result, *jsonOutput)
+	if err != nil {
+		printError(stderr, err, *jsonOutput)
+		return exitFailure
+	}
+
+	return exitOK
+}
+
+func exitCode(err error) int {
+	usageErr := &usageError{}
+	connErr := &connectionError{}
+	switch {
+	case errors.As(err, &usageErr):
+		return exitUsage
+	case errors.As(err, &connErr):
+		return exitConnection
+	}
+
+	return exitFailure
+}
+
+func printResult(w io.Writer, result fmt.Stringer, jsonOutput bool) error {
+	if jsonOutput {
+		return json.NewEncoder(w).Encode(result)
+	}
+
+	_, err := fmt.Fprintln(w, result.String())
+	return err
+}
+
+func printError(w io.Writer, err error, jsonOutput bool) {
+	if jsonOutput {
+		_ = json.NewEncoder(w).Encode(struct {
+			Error string `json:"error"`
+		}{err.Error()})
+		return
+	}
+
+	fmt.Fprintln(w, "hegelctl:", err)
+}
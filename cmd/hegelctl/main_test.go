@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/Jacalz/hegelmote/remote/hegelsim"
+	"github.com/alecthomas/assert/v2"
+)
+
+func newSimulator(t *testing.T, model device.Type) *hegelsim.Amplifier {
+	t.Helper()
+
+	sim, err := hegelsim.New(model)
+	assert.NoError(t, err)
+	assert.NoError(t, sim.Listen("127.0.0.1:0"))
+	t.Cleanup(func() { sim.Close() })
+	return sim
+}
+
+// closedPort returns a local port that nothing listens on.
+func closedPort(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	assert.NoError(t, listener.Close())
+	return strconv.Itoa(port)
+}
+
+// silentPort returns a local port that accepts connections but never answers.
+func silentPort(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+	return strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func TestRunExitCodes(t *testing.T) {
+	for _, key := range []string{"HEGELCTL_HOST", "HEGELCTL_MODEL", "HEGELCTL_PORT"} {
+		t.Setenv(key, "")
+	}
+	t.Setenv("HEGELCTL_CONFIG", filepath.Join(t.TempDir(), "hegelctl.json"))
+
+	sim := newSimulator(t, device.H95)
+	sim.SetVolume(20)
+	simulator := []string{"-host", "127.0.0.1", "-model", "H95", "-port", strconv.Itoa(int(sim.Port()))}
+
+	for _, test := range []struct {
+		name   string
+		args   []string
+		code   int
+		stdout string
+	}{
+		{"no arguments", nil, exitUsage, ""},
+		{"help", []string{"-help"}, exitOK, ""},
+		{"unknown flag", []string{"-volume", "20"}, exitUsage, ""},
+		{"unknown command", append(simulator, "balance"), exitUsage, ""},
+		{"no host", []string{"-model", "H95", "volume"}, exitUsage, ""},
+		{"unsupported model", []string{"-host", "127.0.0.1", "-model", "H1", "volume"}, exitUsage, ""},
+		{"input out of range", append(simulator, "input", "9"), exitUsage, ""},
+		{"closed port", []string{"-host", "127.0.0.1", "-model", "H95", "-port", closedPort(t), "volume"}, exitConnection, ""},
+		{"no answer", []string{"-host", "127.0.0.1", "-model", "H95", "-port", silentPort(t), "-timeout", "100ms", "volume"}, exitFailure, ""},
+		{"set volume", append(simulator, "volume", "40"), exitOK, "40\n"},
+		{"get volume", append(simulator, "volume"), exitOK, "40\n"},
+		{"json output", append(simulator, "-json", "mute"), exitOK, `{"mute":false}` + "\n"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+			code := run(test.args, stdout, stderr)
+			assert.Equal(t, test.code, code, stderr.String())
+			assert.Equal(t, test.stdout, stdout.String())
+		})
+	}
+
+	assert.Equal(t, 40, sim.State().Volume)
+}
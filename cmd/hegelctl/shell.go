@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/Jacalz/hegelmote/remote"
+)
+
+const shellHelp = `Commands:
+  power [on|off|toggle], power?     show or change the power state
+  vol [0-100|up|down], vol?         show or change the volume
+  mute [on|off|toggle], mute?       show or change muting
+  input [number|name], input?       show or change the input
+  reset [minutes|stop], reset?      show or change the reset delay
+  status                            show the full state of the amplifier
+  -x.arg                            send a packet, like -v.u or -i.?
+  help                              show this help
+  quit                              leave the shell
+Changes reported by the amplifier are printed with a leading "*".`
+
+var shellAliases = map[string]string{
+	"vol":   "volume",
+	"reset": "reset-delay",
+}
+
+// rawCommands maps packet letters to the command and arguments that send them.
+// Packets with other letters are sent to the amplifier as they are.
+var rawCommands = map[byte]struct {
+	name string
+	args map[string]string
+}{
+	'p': {"power", map[string]string{"0": "off", "1": "on", "t": "toggle"}},
+	'v': {"volume", map[string]string{"u": "up", "d": "down"}},
+	'm': {"mute", map[string]string{"0": "off", "1": "on", "t": "toggle"}},
+	'i': {"input", nil},
+	'r': {"reset-delay", map[string]string{"~": "stop"}},
+}
+
+type lineReader interface {
+	ReadLine() (string, error)
+}
+
+type scannerReader struct {
+	scanner *bufio.Scanner
+}
+
+func (s *scannerReader) ReadLine() (string, error) {
+	if !s.scanner.Scan() {
+		return "", cmp.Or(s.scanner.Err(), io.EOF)
+	}
+	return s.scanner.Text(), nil
+}
+
+// lockedWriter keeps asynchronous notifications from interleaving with command output.
+type lockedWriter struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.w.Write(p)
+}
+
+// shell runs an interactive prompt for controlling the amplifier.
+// Line editing, history and tab completion are used when stdin is a terminal.
+// The output is always meant for humans and never JSON.
+func shell(opts *options, args []string, stdout io.Writer, _ bool) error {
+	if len(args) > 0 {
+		return usageErrorf("shell takes no arguments")
+	}
+
+	err := opts.resolve()
+	if err != nil {
+		return err
+	}
+
+	model, err := opts.model()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	control := remote.NewControlWithListener(nil, nil, nil, nil, nil, nil)
+	control.Reconnect = &remote.ReconnectPolicy{MaxDelay: 10 * time.Second, Jitter: 0.2}
+
+	connectCtx, cancelConnect := context.WithTimeout(ctx, opts.Timeout)
+	defer cancelConnect()
+	err = control.ConnectWithConfig(connectCtx, opts.Host, model, opts.connectConfig())
+	if err != nil {
+		return &connectionError{err: err}
+	}
+	defer control.Disconnect()
+
+	// Subscribing after connecting leaves out the states passed through while connecting.
+	events := control.SubscribeWithConfig(ctx, remote.SubscribeConfig{Buffer: 64})
+
+	reader, out, restore, err := newPrompt(model, stdout)
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	go func() {
+		for event := range events {
+			fmt.Fprintln(out, "*", newWatchEvent(model, event))
+		}
+	}()
+
+	fmt.Fprintf(out, "Connected to Hegel %s at %s. Type help for a list of commands.\n", model, opts.Host)
+	for {
+		line, err := reader.ReadLine()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		line = strings.TrimSpace(line)
+		switch line {
+		case "":
+			continue
+		case "quit", "exit":
+			return nil
+		case "help":
+			fmt.Fprintln(out, shellHelp)
+			continue
+		}
+
+		commandCtx, cancelCommand := context.WithTimeout(ctx, opts.Timeout)
+		result, err := runShellLine(commandCtx, control, line)
+		cancelCommand()
+		if err != nil {
+			fmt.Fprintln(out, "error:", err)
+			continue
+		}
+
+		fmt.Fprintln(out, result)
+	}
+}
+
+// newPrompt sets up line editing when stdin is a terminal and plain line reading otherwise.
+// The returned function restores the terminal.
+func newPrompt(model device.Type, stdout io.Writer) (lineReader, io.Writer, func(), error) {
+	fd := int(os.Stdin.Fd()) // #nosec G115 -- File descriptors fit in an int.
+	if !term.IsTerminal(fd) {
+		return &scannerReader{scanner: bufio.NewScanner(os.Stdin)}, &lockedWriter{w: stdout}, func() {}, nil
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	terminal := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, stdout}, "hegel> ")
+	terminal.History = loadHistory(historyPath())
+
+	inputs, _ := device.GetInputNames(model)
+	completer := &completer{inputs: inputs, out: terminal}
+	terminal.AutoCompleteCallback = completer.complete
+
+	return terminal, terminal, func() { _ = term.Restore(fd, state) }, nil
+}
+
+// runShellLine runs a command typed into the shell, like "vol 40", "power?" or "-i.?".
+func runShellLine(ctx context.Context, control controller, line string) (fmt.Stringer, error) {
+	if strings.HasPrefix(line, "-") {
+		letter, arg, err := splitPacket(line)
+		if err != nil {
+			return nil, err
+		}
+
+		// Letters without a command of their own are sent as they are.
+		if _, ok := rawCommands[letter]; !ok {
+			resp, err := control.SendRawContext(ctx, letter, arg)
+			if err != nil {
+				return nil, err
+			}
+			return resp, nil
+		}
+	}
+
+	name, args, err := parseShellLine(line)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		return nil, usageErrorf("unknown command %q, type help for a list of commands", name)
+	}
+
+	return cmd(ctx, control, args)
+}
+
+func parseShellLine(line string) (string, []string, error) {
+	if strings.HasPrefix(line, "-") {
+		return parseRawPacket(line)
+	}
+
+	fields := strings.Fields(line)
+	name, args := fields[0], fields[1:]
+	if query, ok := strings.CutSuffix(name, "?"); ok {
+		if len(args) > 0 {
+			return "", nil, usageErrorf("queries take no arguments")
+		}
+		name = query
+	}
+
+	if alias, ok := shellAliases[name]; ok {
+		name = alias
+	}
+
+	return name, args, nil
+}
+
+func parseRawPacket(packet string) (string, []string, error) {
+	letter, arg, err := splitPacket(packet)
+	if err != nil {
+		return "", nil, err
+	}
+
+	raw := rawCommands[letter]
+	if arg == "?" {
+		return raw.name, nil, nil
+	} else if mapped, ok := raw.args[arg]; ok {
+		arg = mapped
+	}
+
+	return raw.name, []string{arg}, nil
+}
+
+// splitPacket splits a packet like "-v.u" into the command letter and the argument.
+func splitPacket(packet string) (byte, string, error) {
+	if len(packet) < len("-v.?") || packet[2] != '.' {
+		return 0, "", usageErrorf("packets look like -v.? or -i.3, got %q", packet)
+	}
+
+	return packet[1], packet[3:], nil
+}
+
+// completer completes command names and input names for the shell.
+type completer struct {
+	inputs []string
+	out    io.Writer
+}
+
+func (c *completer) complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+
+	head, partial, candidates := "", line[:pos], c.commandNames()
+	if name, rest, ok := strings.Cut(line[:pos], " "); ok {
+		if name != "input" {
+			return line, pos, true
+		}
+		head, partial, candidates = name+" ", strings.TrimLeft(rest, " "), c.inputs
+	}
+
+	matches := []string{}
+	for _, candidate := range candidates {
+		if len(candidate) >= len(partial) && strings.EqualFold(candidate[:len(partial)], partial) {
+			matches = append(matches, candidate)
+		}
+	}
+
+	if len(matches) == 0 {
+		return line, pos, true
+	} else if len(matches) == 1 {
+		completed := head + matches[0]
+		if head == "" {
+			completed += " "
+		}
+		return completed + line[pos:], len(completed), true
+	}
+
+	common := commonPrefix(matches)
+	if len(common) > len(partial) {
+		completed := head + common
+		return completed + line[pos:], len(completed), true
+	}
+
+	fmt.Fprintln(c.out, strings.Join(matches, "  "))
+	return line, pos, true
+}
+
+func (c *completer) commandNames() []string {
+	names := []string{"help", "quit", "status"}
+	for name := range commands {
+		names = append(names, name)
+	}
+	for alias := range shellAliases {
+		names = append(names, alias)
+	}
+
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, word := range words[1:] {
+		for !strings.HasPrefix(strings.ToLower(word), strings.ToLower(prefix)) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
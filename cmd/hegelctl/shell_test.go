@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestSplitPacket(t *testing.T) {
+	for _, test := range []struct {
+		packet string
+		letter byte
+		arg    string
+		err    bool
+	}{
+		{"-v.?", 'v', "?", false},
+		{"-v.u", 'v', "u", false},
+		{"-i.12", 'i', "12", false},
+		{"-x.raw arg", 'x', "raw arg", false},
+		{"-v.", 0, "", true},
+		{"-v", 0, "", true},
+		{"-", 0, "", true},
+		{"-vv?", 0, "", true},
+		{"-v:20", 0, "", true},
+	} {
+		letter, arg, err := splitPacket(test.packet)
+		if test.err {
+			assert.EqualError(t, err, "packets look like -v.? or -i.3, got "+strconv.Quote(test.packet))
+			continue
+		}
+
+		assert.NoError(t, err, test.packet)
+		assert.Equal(t, test.letter, letter, test.packet)
+		assert.Equal(t, test.arg, arg, test.packet)
+	}
+}
+
+func TestParseShellLine(t *testing.T) {
+	for _, test := range []struct {
+		line string
+		name string
+		args []string
+		err  bool
+	}{
+		{"power?", "power", []string{}, false},
+		{"power on", "power", []string{"on"}, false},
+		{"vol 40", "volume", []string{"40"}, false},
+		{"vol?", "volume", []string{}, false},
+		{"reset stop", "reset-delay", []string{"stop"}, false},
+		{"input  optical  1", "input", []string{"optical", "1"}, false},
+		{"mute? on", "", nil, true},
+
+		// Raw packets for the known letters are run like the commands.
+		{"-p.?", "power", nil, false},
+		{"-p.1", "power", []string{"on"}, false},
+		{"-p.t", "power", []string{"toggle"}, false},
+		{"-v.u", "volume", []string{"up"}, false},
+		{"-v.30", "volume", []string{"30"}, false},
+		{"-m.0", "mute", []string{"off"}, false},
+		{"-i.3", "input", []string{"3"}, false},
+		{"-r.~", "reset-delay", []string{"stop"}, false},
+		{"-r.5", "reset-delay", []string{"5"}, false},
+		{"-r", "", nil, true},
+	} {
+		name, args, err := parseShellLine(test.line)
+		if test.err {
+			assert.Error(t, err, test.line)
+			continue
+		}
+
+		assert.NoError(t, err, test.line)
+		assert.Equal(t, test.name, name, test.line)
+		assert.Equal(t, test.args, args, test.line)
+	}
+}
+
+func TestCompleter(t *testing.T) {
+	for _, test := range []struct {
+		line    string
+		pos     int
+		key     rune
+		newLine string
+		newPos  int
+		ok      bool
+		listed  string
+	}{
+		{"po", 2, 'w', "", 0, false, ""},
+		{"po", 2, '\t', "power ", 6, true, ""},
+		{"PO", 2, '\t', "power ", 6, true, ""},
+		{"pox", 2, '\t', "power x", 6, true, ""},
+		{"", 0, '\t', "", 0, true, "help  input  mute  power  quit  reset  reset-delay  status  vol  volume\n"},
+		{"re", 2, '\t', "reset", 5, true, ""},
+		{"vol", 3, '\t', "vol", 3, true, "vol  volume\n"},
+		{"x", 1, '\t', "x", 1, true, ""},
+
+		// Input names are completed after the input command, and only there.
+		{"input co", 8, '\t', "input Coaxial", 13, true, ""},
+		{"input  usb", 10, '\t', "input USB", 9, true, ""},
+		{"input opt", 9, '\t', "input Optical ", 14, true, ""},
+		{"input Optical ", 14, '\t', "input Optical ", 14, true, "Optical 1  Optical 2  Optical 3\n"},
+		{"input phono", 11, '\t', "input phono", 11, true, ""},
+		{"mute o", 6, '\t', "mute o", 6, true, ""},
+	} {
+		out := &bytes.Buffer{}
+		c := &completer{
+			inputs: []string{"Analog 1", "Analog 2", "Coaxial", "Optical 1", "Optical 2", "Optical 3", "USB", "Network"},
+			out:    out,
+		}
+
+		newLine, newPos, ok := c.complete(test.line, test.pos, test.key)
+		assert.Equal(t, test.newLine, newLine, "%q", test.line)
+		assert.Equal(t, test.newPos, newPos, "%q", test.line)
+		assert.Equal(t, test.ok, ok, "%q", test.line)
+		assert.Equal(t, test.listed, out.String(), "%q", test.line)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hegelmote", "hegelctl_history")
+
+	history := loadHistory(path)
+	assert.Equal(t, 0, history.Len())
+
+	// Empty lines and repeats of the last line are left out.
+	for _, entry := range []string{"power on", "", "vol 40", "vol 40", "power on"} {
+		history.Add(entry)
+	}
+	assert.Equal(t, 3, history.Len())
+	assert.Equal(t, "power on", history.At(0))
+	assert.Equal(t, "vol 40", history.At(1))
+	assert.Equal(t, "power on", history.At(2))
+
+	saved, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "power on\nvol 40\npower on\n", string(saved))
+
+	loaded := loadHistory(path)
+	assert.Equal(t, history.entries, loaded.entries)
+}
+
+func TestHistoryLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hegelctl_history")
+	lines := make([]string, maxHistory+5)
+	for i := range lines {
+		lines[i] = "vol " + strconv.Itoa(i)
+	}
+	assert.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600))
+
+	// Only the newest entries are loaded.
+	history := loadHistory(path)
+	assert.Equal(t, maxHistory, history.Len())
+	assert.Equal(t, "vol 1004", history.At(0))
+	assert.Equal(t, "vol 5", history.At(maxHistory-1))
+
+	history.Add("mute on")
+	assert.Equal(t, maxHistory, history.Len())
+	assert.Equal(t, "mute on", history.At(0))
+	assert.Equal(t, "vol 6", history.At(maxHistory-1))
+}
+
+func TestHistoryWithoutPath(t *testing.T) {
+	history := loadHistory("")
+	history.Add("power on")
+	assert.Equal(t, 1, history.Len())
+	assert.Equal(t, "power on", history.At(0))
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/Jacalz/hegelmote/remote"
+)
+
+// watchEvent is a printed event. Only the fields relevant for the kind of event are set.
+type watchEvent struct {
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"`
+
+	Power  *onOff         `json:"power,omitempty"`
+	Volume *remote.Volume `json:"volume,omitempty"`
+	Mute   *onOff         `json:"mute,omitempty"`
+	Input  *inputResult   `json:"input,omitempty"`
+	State  string         `json:"state,omitempty"`
+	Error  string         `json:"error,omitempty"`
+}
+
+func (e *watchEvent) String() string {
+	value := ""
+	switch {
+	case e.Power != nil:
+		value = e.Power.String()
+	case e.Volume != nil:
+		value = fmt.Sprint(*e.Volume)
+	case e.Mute != nil:
+		value = e.Mute.String()
+	case e.Input != nil:
+		value = e.Input.String()
+	case e.State != "":
+		value = e.State
+	case e.Error != "":
+		value = e.Error
+	}
+
+	return fmt.Sprintf("%s %s %s", e.Time.Format(time.RFC3339Nano), e.Event, value)
+}
+
+func newWatchEvent(model device.Type, event remote.Event) *watchEvent {
+	out := &watchEvent{Time: time.Now()}
+	switch event := event.(type) {
+	case remote.PowerChanged:
+		out.Event, out.Power = "power", (*onOff)(&event.PoweredOn)
+	case remote.VolumeChanged:
+		out.Event, out.Volume = "volume", &event.Volume
+	case remote.MuteChanged:
+		out.Event, out.Mute = "mute", (*onOff)(&event.Muted)
+	case remote.InputChanged:
+		input := newInputResult(model, event.Input)
+		out.Event, out.Input = "input", &input
+	case remote.ResetReceived:
+		out.Event = "reset"
+	case remote.ErrorReceived:
+		out.Event, out.Error = "error", event.Err.Error()
+	case remote.ConnectionStateChanged:
+		out.Event, out.State = "connection", event.State.String()
+	case remote.Resynced:
+		out.Event = "resynced"
+	}
+	return out
+}
+
+// watch prints every change reported by the amplifier until interrupted.
+// It reconnects when the connection is lost, like when the amplifier resets it.
+func watch(opts *options, args []string, stdout io.Writer, jsonOutput bool) error {
+	if len(args) > 0 {
+		return usageErrorf("watch takes no arguments")
+	}
+
+	err := opts.resolve()
+	if err != nil {
+		return err
+	}
+
+	model, err := opts.model()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	control := remote.NewControlWithListener(nil, nil, nil, nil, nil, nil)
+	control.Reconnect = &remote.ReconnectPolicy{MaxDelay: 10 * time.Second, Jitter: 0.2}
+	events := control.SubscribeWithConfig(ctx, remote.SubscribeConfig{Buffer: 64, Policy: remote.Block})
+
+	connectCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	err = control.ConnectWithConfig(connectCtx, opts.Host, model, opts.connectConfig())
+	if err != nil {
+		return &connectionError{err: err}
+	}
+	defer control.Disconnect()
+
+	encoder := json.NewEncoder(stdout)
+	for event := range events {
+		out := newWatchEvent(model, event)
+		if jsonOutput {
+			err = encoder.Encode(out)
+		} else {
+			_, err = fmt.Fprintln(stdout, out)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/Jacalz/hegelmote/internal/mqtt"
+	"github.com/Jacalz/hegelmote/remote"
+)
+
+const (
+	brokerRetryDelay = 5 * time.Second
+	commandTimeout   = 2 * time.Second
+)
+
+// bridge publishes the state of the amplifier as retained messages and passes on commands from the broker.
+type bridge struct {
+	amp    *remote.ControlWithListener
+	events <-chan remote.Event
+
+	broker   string
+	username string
+	password string
+
+	id        string
+	topic     string
+	discovery string
+}
+
+// run keeps a session with the broker running, reconnecting after a delay, until the context is done.
+func (b *bridge) run(ctx context.Context) {
+	for {
+		err := b.runSession(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		slog.Error("Lost connection to MQTT broker:", slog.String("reason", err.Error()))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(brokerRetryDelay):
+		}
+	}
+}
+
+func (b *bridge) runSession(ctx context.Context) error {
+	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	client, err := mqtt.Dial(dialCtx, b.broker, mqtt.Config{
+		ClientID: "hegelmqtt-" + b.id,
+		Username: b.username,
+		Password: b.password,
+		Will:     b.availability(false),
+	})
+	cancel()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	slog.Info("Connected to MQTT broker", slog.String("address", b.broker))
+	err = b.start(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return client.Publish(*b.availability(false))
+		case <-client.Done():
+			return client.Err()
+		case event := <-b.events:
+			err = b.handleEvent(client, event)
+		case message, ok := <-client.Messages():
+			if !ok {
+				return client.Err()
+			}
+			err = b.handleCommand(ctx, client, message)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// start publishes the discovery configs and the current state, and then subscribes to commands.
+func (b *bridge) start(ctx context.Context, client *mqtt.Client) error {
+	if b.discovery != "" {
+		messages, err := b.discoveryMessages()
+		if err != nil {
+			return err
+		}
+
+		for _, message := range messages {
+			if err := client.Publish(message); err != nil {
+				return err
+			}
+		}
+	}
+
+	err := b.publishState(client)
+	if err != nil {
+		return err
+	}
+
+	return client.Subscribe(ctx, b.topic+"/+/set")
+}
+
+func (b *bridge) availability(online bool) *mqtt.Message {
+	payload := "offline"
+	if online {
+		payload = "online"
+	}
+
+	return &mqtt.Message{Topic: b.topic + "/availability", Payload: []byte(payload), Retain: true}
+}
+
+// values returns the payload of each state topic from the last known state of the amplifier.
+func (b *bridge) values() map[string]string {
+	state := b.amp.Snapshot()
+	values := map[string]string{
+		"power":  onOff(state.Power),
+		"volume": strconv.Itoa(int(state.Volume)),
+		"mute":   onOff(state.Mute),
+	}
+
+	if name, err := device.NameFromNumber(b.amp.GetDeviceType(), state.Input); err == nil {
+		values["input"] = name
+	}
+
+	return values
+}
+
+// publishState publishes the availability and, when connected, every state topic.
+func (b *bridge) publishState(client *mqtt.Client) error {
+	connected := b.amp.GetConnectionState() == remote.Connected
+	err := client.Publish(*b.availability(connected))
+	if err != nil || !connected {
+		return err
+	}
+
+	for field, value := range b.values() {
+		err = b.publishValue(client, field, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *bridge) publishValue(client *mqtt.Client, field, value string) error {
+	return client.Publish(mqtt.Message{Topic: b.topic + "/" + field, Payload: []byte(value), Retain: true})
+}
+
+// handleEvent publishes the topic that changed. The value is taken from the
+// last known state so that events that were buffered for a while are not stale.
+func (b *bridge) handleEvent(client *mqtt.Client, event remote.Event) error {
+	field := ""
+	switch event := event.(type) {
+	case remote.ConnectionStateChanged:
+		return b.publishState(client)
+	case remote.Resynced:
+		return b.publishState(client)
+	case remote.ErrorReceived:
+		slog.Error("Error from amplifier:", slog.String("reason", event.Err.Error()))
+	case remote.PowerChanged:
+		field = "power"
+	case remote.VolumeChanged:
+		field = "volume"
+	case remote.MuteChanged:
+		field = "mute"
+	case remote.InputChanged:
+		field = "input"
+	}
+
+	value, ok := b.values()[field]
+	if !ok {
+		return nil
+	}
+
+	return b.publishValue(client, field, value)
+}
+
+// handleCommand passes on a message from a command topic to the amplifier. Failed commands are
+// logged and the state is published again, so that controls that changed optimistically are reset.
+func (b *bridge) handleCommand(ctx context.Context, client *mqtt.Client, message mqtt.Message) error {
+	field, ok := strings.CutPrefix(message.Topic, b.topic+"/")
+	field, isCommand := strings.CutSuffix(field, "/set")
+	if !ok || !isCommand {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	payload := strings.TrimSpace(string(message.Payload))
+	err := b.runCommand(ctx, field, payload)
+	if err != nil {
+		slog.Error("Failed to run command:", slog.String("topic", message.Topic), slog.String("payload", payload), slog.String("reason", err.Error()))
+		return b.publishState(client)
+	}
+
+	// Responses to our own commands are not reported as events.
+	value, ok := b.values()[field]
+	if !ok {
+		return nil
+	}
+	return b.publishValue(client, field, value)
+}
+
+func (b *bridge) runCommand(ctx context.Context, field, payload string) error {
+	var err error
+	switch field {
+	case "power":
+		err = applyOnOff(ctx, payload, b.amp.SetPowerContext, b.amp.TogglePowerContext)
+	case "mute":
+		err = applyOnOff(ctx, payload, b.amp.SetVolumeMuteContext, b.amp.ToggleVolumeMuteContext)
+	case "volume":
+		err = b.setVolume(ctx, payload)
+	case "input":
+		err = b.setInput(ctx, payload)
+	default:
+		err = fmt.Errorf("unknown command topic %q", field)
+	}
+
+	return err
+}
+
+func applyOnOff(ctx context.Context, payload string, set func(context.Context, bool) (bool, error), toggle func(context.Context) (bool, error)) error {
+	var err error
+	switch strings.ToUpper(payload) {
+	case "ON":
+		_, err = set(ctx, true)
+	case "OFF":
+		_, err = set(ctx, false)
+	case "TOGGLE":
+		_, err = toggle(ctx)
+	default:
+		err = errors.New("expected ON, OFF or TOGGLE")
+	}
+
+	return err
+}
+
+func (b *bridge) setVolume(ctx context.Context, payload string) error {
+	var err error
+	switch strings.ToUpper(payload) {
+	case "UP":
+		_, err = b.amp.VolumeUpContext(ctx)
+	case "DOWN":
+		_, err = b.amp.VolumeDownContext(ctx)
+	default:
+		// Home Assistant may send whole numbers with a decimal part.
+		volume, parseErr := strconv.ParseFloat(payload, 64)
+		if parseErr != nil || volume < 0 || volume > 100 {
+			return errors.New("expected a volume between 0 and 100, UP or DOWN")
+		}
+		_, err = b.amp.SetVolumeContext(ctx, remote.Volume(math.Round(volume)))
+	}
+
+	return err
+}
+
+// setInput selects an input by number or by case-insensitive name.
+func (b *bridge) setInput(ctx context.Context, payload string) error {
+	names, err := device.GetInputNames(b.amp.GetDeviceType())
+	if err != nil {
+		return err
+	}
+
+	input := device.Input(0)
+	if number, err := strconv.ParseUint(payload, 10, 8); err == nil && number >= 1 && number <= uint64(len(names)) {
+		input = device.Input(number)
+	} else if index := slices.IndexFunc(names, func(name string) bool { return strings.EqualFold(name, payload) }); index != -1 {
+		input = device.Input(index + 1) // #nosec G115 -- Inputs are few.
+	} else {
+		return fmt.Errorf("unknown input, expected one of %q", names)
+	}
+
+	_, err = b.amp.SetInputContext(ctx, input)
+	return err
+}
+
+func onOff(on bool) string {
+	if on {
+		return "ON"
+	}
+	return "OFF"
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/Jacalz/hegelmote/internal/mqtt"
+	"github.com/Jacalz/hegelmote/remote"
+	"github.com/Jacalz/hegelmote/remote/hegelsim"
+	"github.com/alecthomas/assert/v2"
+)
+
+// fakeBroker accepts clients and collects the messages that they publish.
+type fakeBroker struct {
+	listener  net.Listener
+	published chan mqtt.Message
+}
+
+func newFakeBroker(t *testing.T) *fakeBroker {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	broker := &fakeBroker{listener: listener, published: make(chan mqtt.Message, 64)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go broker.serve(conn)
+		}
+	}()
+	return broker
+}
+
+func (b *fakeBroker) serve(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	for {
+		header, body, err := readFakePacket(reader)
+		if err != nil {
+			return
+		}
+
+		switch header & 0xf0 {
+		case 0x10: // Connect, which is always accepted.
+			_, _ = conn.Write([]byte{0x20, 0x02, 0x00, 0x00})
+		case 0x30: // Publish at QoS 0.
+			length := int(binary.BigEndian.Uint16(body))
+			b.published <- mqtt.Message{Topic: string(body[2 : 2+length]), Payload: body[2+length:], Retain: header&0x01 != 0}
+		}
+	}
+}
+
+func readFakePacket(reader *bufio.Reader) (byte, []byte, error) {
+	header, err := reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	length, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	body := make([]byte, length)
+	_, err = io.ReadFull(reader, body)
+	return header, body, err
+}
+
+// receive returns the messages published until nothing has been published for a while.
+func (b *fakeBroker) receive() map[string]string {
+	messages := map[string]string{}
+	for {
+		select {
+		case message := <-b.published:
+			messages[message.Topic] = string(message.Payload)
+		case <-time.After(50 * time.Millisecond):
+			return messages
+		}
+	}
+}
+
+func newSimulator(t *testing.T, model device.Type) *hegelsim.Amplifier {
+	t.Helper()
+
+	sim, err := hegelsim.New(model)
+	assert.NoError(t, err)
+	assert.NoError(t, sim.Listen("127.0.0.1:0"))
+	t.Cleanup(func() { sim.Close() })
+	return sim
+}
+
+// newTestBridge connects a bridge to the simulator and a client to a fake broker.
+func newTestBridge(t *testing.T, sim *hegelsim.Amplifier) (*bridge, *mqtt.Client, *fakeBroker) {
+	t.Helper()
+
+	amp := remote.NewControlWithListener(nil, nil, nil, nil, nil, func(err error) { t.Errorf("unexpected error: %v", err) })
+	err := amp.ConnectWithConfig(context.Background(), "127.0.0.1", sim.Model(), remote.ConnectConfig{Port: sim.Port()})
+	assert.NoError(t, err)
+	t.Cleanup(func() { amp.Disconnect() })
+
+	broker := newFakeBroker(t)
+	client, err := mqtt.Dial(context.Background(), broker.listener.Addr().String(), mqtt.Config{ClientID: "test"})
+	assert.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+
+	b := &bridge{amp: amp, id: "amp", topic: "hegelmote/amp", discovery: "homeassistant"}
+	return b, client, broker
+}
+
+func TestHandleCommand(t *testing.T) {
+	sim := newSimulator(t, device.H95)
+	sim.SetVolume(20)
+	b, client, broker := newTestBridge(t, sim)
+
+	for _, test := range []struct {
+		topic, payload string
+		published      map[string]string
+		check          func(state hegelsim.State) bool
+	}{
+		{"hegelmote/amp/power/set", "ON", map[string]string{"hegelmote/amp/power": "ON"}, func(s hegelsim.State) bool { return s.Power }},
+		{"hegelmote/amp/power/set", "toggle", map[string]string{"hegelmote/amp/power": "OFF"}, func(s hegelsim.State) bool { return !s.Power }},
+		{"hegelmote/amp/volume/set", "35.0", map[string]string{"hegelmote/amp/volume": "35"}, func(s hegelsim.State) bool { return s.Volume == 35 }},
+		{"hegelmote/amp/volume/set", "UP", map[string]string{"hegelmote/amp/volume": "36"}, func(s hegelsim.State) bool { return s.Volume == 36 }},
+		{"hegelmote/amp/volume/set", "down", map[string]string{"hegelmote/amp/volume": "35"}, func(s hegelsim.State) bool { return s.Volume == 35 }},
+		{"hegelmote/amp/mute/set", " ON ", map[string]string{"hegelmote/amp/mute": "ON"}, func(s hegelsim.State) bool { return s.Mute }},
+		{"hegelmote/amp/input/set", "coaxial", map[string]string{"hegelmote/amp/input": "Coaxial"}, func(s hegelsim.State) bool { return s.Input == 3 }},
+		{"hegelmote/amp/input/set", "7", map[string]string{"hegelmote/amp/input": "USB"}, func(s hegelsim.State) bool { return s.Input == 7 }},
+
+		// Commands for other amplifiers and topics that are not commands are ignored.
+		{"hegelmote/other/volume/set", "50", map[string]string{}, func(s hegelsim.State) bool { return s.Volume == 35 }},
+		{"hegelmote/amp/volume", "50", map[string]string{}, func(s hegelsim.State) bool { return s.Volume == 35 }},
+	} {
+		err := b.handleCommand(context.Background(), client, mqtt.Message{Topic: test.topic, Payload: []byte(test.payload)})
+		assert.NoError(t, err)
+		assert.Equal(t, test.published, broker.receive(), "%s %s", test.topic, test.payload)
+		assert.True(t, test.check(sim.State()), "%s %s", test.topic, test.payload)
+	}
+}
+
+func TestHandleCommandFailure(t *testing.T) {
+	sim := newSimulator(t, device.H95)
+	sim.SetVolume(20)
+	assert.NoError(t, sim.SetInput(2))
+	b, client, broker := newTestBridge(t, sim)
+
+	// Failed commands publish the full state again, to reset controls that changed optimistically.
+	expected := map[string]string{
+		"hegelmote/amp/availability": "online",
+		"hegelmote/amp/power":        "OFF",
+		"hegelmote/amp/volume":       "20",
+		"hegelmote/amp/mute":         "OFF",
+		"hegelmote/amp/input":        "Analog 2",
+	}
+
+	for _, test := range []struct{ topic, payload string }{
+		{"hegelmote/amp/power/set", "maybe"},
+		{"hegelmote/amp/volume/set", "101"},
+		{"hegelmote/amp/volume/set", "loud"},
+		{"hegelmote/amp/input/set", "phono"},
+		{"hegelmote/amp/reset/set", "ON"},
+	} {
+		err := b.handleCommand(context.Background(), client, mqtt.Message{Topic: test.topic, Payload: []byte(test.payload)})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, broker.receive(), "%s %s", test.topic, test.payload)
+	}
+
+	assert.Equal(t, 20, sim.State().Volume)
+}
+
+func TestSetInput(t *testing.T) {
+	sim := newSimulator(t, device.H95)
+	b, _, _ := newTestBridge(t, sim)
+
+	for _, test := range []struct {
+		payload string
+		input   device.Input
+		err     bool
+	}{
+		{"1", 1, false},
+		{"8", 8, false},
+		{"Optical 2", 5, false},
+		{"optical 3", 6, false},
+		{"0", 0, true},
+		{"9", 0, true},
+		{"Balanced", 0, true},
+		{"", 0, true},
+	} {
+		_, err := b.amp.SetInput(2)
+		assert.NoError(t, err)
+
+		err = b.setInput(context.Background(), test.payload)
+		if test.err {
+			assert.Error(t, err, test.payload)
+			assert.Equal(t, 2, sim.State().Input, test.payload)
+			continue
+		}
+
+		assert.NoError(t, err, test.payload)
+		assert.Equal(t, test.input, sim.State().Input, test.payload)
+	}
+}
+
+func TestDiscoveryMessages(t *testing.T) {
+	b, _, _ := newTestBridge(t, newSimulator(t, device.H95))
+
+	messages, err := b.discoveryMessages()
+	assert.NoError(t, err)
+
+	topics := []string{}
+	for _, message := range messages {
+		assert.True(t, message.Retain)
+		topics = append(topics, message.Topic)
+	}
+	assert.Equal(t, []string{
+		"homeassistant/switch/amp/power/config",
+		"homeassistant/switch/amp/mute/config",
+		"homeassistant/number/amp/volume/config",
+		"homeassistant/select/amp/input/config",
+	}, topics)
+
+	assert.Equal(t, `{"name":"Power","unique_id":"amp_power","icon":"mdi:power",`+
+		`"state_topic":"hegelmote/amp/power","command_topic":"hegelmote/amp/power/set",`+
+		`"availability_topic":"hegelmote/amp/availability",`+
+		`"device":{"identifiers":["amp"],"name":"Hegel H95","manufacturer":"Hegel","model":"H95"},`+
+		`"payload_on":"ON","payload_off":"OFF"}`, string(messages[0].Payload))
+	assert.Contains(t, string(messages[2].Payload), `"min":0,"max":100,"step":1,"mode":"slider"`)
+	assert.Contains(t, string(messages[3].Payload),
+		`"options":["Analog 1","Analog 2","Coaxial","Optical 1","Optical 2","Optical 3","USB","Network"]`)
+}
+
+func TestDefaultID(t *testing.T) {
+	assert.Equal(t, "hegel_h95_192_168_1_20", defaultID(device.H95, "192.168.1.20"))
+	assert.Equal(t, "hegel_r__st_amp_local", defaultID(device.Röst, "Amp.local"))
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/Jacalz/hegelmote/internal/mqtt"
+)
+
+// haDevice groups the entities of the amplifier into one device in Home Assistant.
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+}
+
+// haEntity is the discovery config of one entity. Only the fields used by its component are set.
+type haEntity struct {
+	Name              string   `json:"name"`
+	UniqueID          string   `json:"unique_id"`
+	Icon              string   `json:"icon,omitempty"`
+	StateTopic        string   `json:"state_topic"`
+	CommandTopic      string   `json:"command_topic"`
+	AvailabilityTopic string   `json:"availability_topic"`
+	Device            haDevice `json:"device"`
+
+	// Used by switch entities.
+	PayloadOn  string `json:"payload_on,omitempty"`
+	PayloadOff string `json:"payload_off,omitempty"`
+
+	// Used by number entities. Min is a pointer as zero differs from the default.
+	Min  *int   `json:"min,omitempty"`
+	Max  int    `json:"max,omitempty"`
+	Step int    `json:"step,omitempty"`
+	Mode string `json:"mode,omitempty"`
+
+	// Used by select entities.
+	Options []string `json:"options,omitempty"`
+}
+
+// discoveryMessages returns the retained Home Assistant discovery configs: switches for
+// power and mute, a number for the volume and a select with the inputs of the model.
+func (b *bridge) discoveryMessages() ([]mqtt.Message, error) {
+	model := b.amp.GetDeviceType()
+	inputs, err := device.GetInputNames(model)
+	if err != nil {
+		return nil, err
+	}
+
+	dev := haDevice{Identifiers: []string{b.id}, Name: "Hegel " + model.String(), Manufacturer: "Hegel", Model: model.String()}
+	entity := func(field, name, icon string) haEntity {
+		return haEntity{
+			Name:              name,
+			UniqueID:          b.id + "_" + field,
+			Icon:              icon,
+			StateTopic:        b.topic + "/" + field,
+			CommandTopic:      b.topic + "/" + field + "/set",
+			AvailabilityTopic: b.topic + "/availability",
+			Device:            dev,
+		}
+	}
+
+	power := entity("power", "Power", "mdi:power")
+	power.PayloadOn, power.PayloadOff = "ON", "OFF"
+
+	mute := entity("mute", "Mute", "mdi:volume-off")
+	mute.PayloadOn, mute.PayloadOff = "ON", "OFF"
+
+	volume := entity("volume", "Volume", "mdi:volume-high")
+	volume.Min, volume.Max, volume.Step, volume.Mode = new(int), 100, 1, "slider"
+
+	input := entity("input", "Input", "mdi:import")
+	input.Options = inputs
+
+	configs := []struct {
+		component, field string
+		entity           haEntity
+	}{
+		{"switch", "power", power},
+		{"switch", "mute", mute},
+		{"number", "volume", volume},
+		{"select", "input", input},
+	}
+
+	messages := make([]mqtt.Message, 0, len(configs))
+	for _, config := range configs {
+		payload, err := json.Marshal(config.entity)
+		if err != nil {
+			return nil, err
+		}
+
+		topic := b.discovery + "/" + config.component + "/" + b.id + "/" + config.field + "/config"
+		messages = append(messages, mqtt.Message{Topic: topic, Payload: payload, Retain: true})
+	}
+
+	return messages, nil
+}
@@ -0,0 +1,102 @@
+// Command hegelmqtt bridges a Hegel amplifier to an MQTT broker, with discovery for Home Assistant.
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/Jacalz/hegelmote/remote"
+)
+
+func main() {
+	host := ""
+	flag.StringVar(&host, "host", host, "host of the amplifier")
+	model := ""
+	flag.StringVar(&model, "model", model, "model of the amplifier")
+	port := uint(remote.DefaultPort)
+	flag.UintVar(&port, "port", port, "port of the amplifier")
+	broker := "localhost:1883"
+	flag.StringVar(&broker, "broker", broker, "address of the MQTT broker")
+	username := ""
+	flag.StringVar(&username, "username", username, "user name for the MQTT broker, with the password in HEGELMQTT_PASSWORD")
+	id := ""
+	flag.StringVar(&id, "id", id, "unique id of the amplifier, defaults to one based on the model and host")
+	topic := ""
+	flag.StringVar(&topic, "topic", topic, "prefix of the state and command topics, defaults to hegelmote/<id>")
+	discovery := "homeassistant"
+	flag.StringVar(&discovery, "discovery-prefix", discovery, "prefix for Home Assistant discovery, or empty to disable it")
+	flag.Parse()
+
+	if args := flag.Args(); len(args) > 0 {
+		fmt.Printf("invalid arguments: %v\n", args)
+		flag.Usage()
+		return
+	}
+
+	deviceType := device.FromString(model)
+	if host == "" {
+		log.Fatalln("No amplifier host given, use -host")
+	} else if !device.IsSupported(deviceType) {
+		log.Fatalf("Unsupported model %q, expected one of %v\n", model, device.SupportedTypeNames())
+	} else if port > 65535 {
+		log.Fatalln("Invalid port:", port)
+	}
+
+	password := os.Getenv("HEGELMQTT_PASSWORD")
+	if password != "" && username == "" {
+		log.Fatalln("HEGELMQTT_PASSWORD is set without a user name, use -username")
+	}
+
+	if id == "" {
+		id = defaultID(deviceType, host)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	amp := remote.NewControlWithListener(nil, nil, nil, nil, nil, func(err error) {
+		slog.Error("Error from amplifier:", slog.String("reason", err.Error()))
+	})
+	amp.Reconnect = &remote.ReconnectPolicy{Jitter: 0.1}
+	events := amp.SubscribeWithConfig(ctx, remote.SubscribeConfig{Buffer: 64})
+
+	connectCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	err := amp.ConnectWithConfig(connectCtx, host, deviceType, remote.ConnectConfig{Port: uint16(port)}) // #nosec G115 -- Checked above.
+	cancel()
+	if err != nil {
+		log.Fatalln("Error connecting to amplifier:", err)
+	}
+	defer amp.Disconnect()
+
+	b := &bridge{
+		amp:       amp,
+		events:    events,
+		broker:    broker,
+		username:  username,
+		password:  password,
+		id:        id,
+		topic:     strings.TrimSuffix(cmp.Or(topic, "hegelmote/"+id), "/"),
+		discovery: strings.TrimSuffix(discovery, "/"),
+	}
+	b.run(ctx)
+}
+
+// defaultID returns an id that is stable for the amplifier and only uses characters valid in topics and ids.
+func defaultID(model device.Type, host string) string {
+	id := []byte(strings.ToLower("hegel_" + model.String() + "_" + host))
+	for i, c := range id {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			id[i] = '_'
+		}
+	}
+	return string(id)
+}
@@ -0,0 +1,53 @@
+// Command hegelsim runs a simulated Hegel amplifier for testing without real hardware.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/Jacalz/hegelmote/remote/hegelsim"
+)
+
+func main() {
+	address := hegelsim.DefaultAddress
+	flag.StringVar(&address, "address", address, "address to listen on")
+	model := device.H95.String()
+	flag.StringVar(&model, "model", model, "amplifier model to simulate")
+	flag.Parse()
+
+	if args := flag.Args(); len(args) > 0 {
+		fmt.Printf("invalid arguments: %v\n", args)
+		flag.Usage()
+		return
+	}
+
+	deviceType := device.FromString(model)
+	if !device.IsSupported(deviceType) {
+		log.Fatalf("Unsupported model %q, expected one of %v\n", model, device.SupportedTypeNames())
+	}
+
+	amp, err := hegelsim.New(deviceType)
+	if err != nil {
+		log.Fatalln("Error creating simulator:", err)
+	}
+
+	err = amp.Listen(address)
+	if err != nil {
+		log.Fatalln("Error listening:", err)
+	}
+
+	fmt.Printf("Simulating Hegel %s at: %s\n", deviceType, amp.Addr())
+
+	ctrlc := make(chan os.Signal, 1)
+	signal.Notify(ctrlc, os.Interrupt)
+	<-ctrlc
+
+	err = amp.Close()
+	if err != nil {
+		log.Fatalln("Error shutting down simulator:", err)
+	}
+}
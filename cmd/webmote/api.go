@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/Jacalz/hegelmote/remote"
+)
+
+// apiTimeout is how long to wait for the amplifier, well within the write timeout of the server.
+const apiTimeout = 800 * time.Millisecond
+
+// maxBodySize limits the size of request bodies, which are all tiny.
+const maxBodySize = 1024
+
+// api serves a JSON REST API for controlling the amplifier given using -amplifier.
+type api struct {
+	amp     *remote.ControlWithListener
+	address string
+}
+
+// connectAPI connects to the amplifier at the address, with an optional port, and keeps reconnecting.
+func connectAPI(address, model string) (*api, error) {
+	deviceType := device.FromString(model)
+	if !device.IsSupported(deviceType) {
+		return nil, fmt.Errorf("unsupported model %q, expected one of %v", model, device.SupportedTypeNames())
+	}
+
+	host, port := address, uint64(remote.DefaultPort)
+	if h, p, err := net.SplitHostPort(address); err == nil {
+		port, err = strconv.ParseUint(p, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q: %w", p, err)
+		}
+		host = h
+	}
+	address = net.JoinHostPort(host, strconv.FormatUint(port, 10))
+
+	amp := remote.NewControlWithListener(nil, nil, nil, nil, nil, func(err error) {
+		slog.Error("Error from amplifier:", slog.String("reason", err.Error()))
+	})
+	amp.Reconnect = &remote.ReconnectPolicy{Jitter: 0.1}
+
+	var logTracer remote.Tracer
+	if traceHandler != nil {
+		logTracer = remote.SlogTracer(traceHandler.WithAttrs([]slog.Attr{slog.String("amplifier", address)}))
+	}
+	serverMetrics.addAmplifier(address, deviceType, amp)
+	amp.SetTracer(combineTracers(logTracer, serverMetrics.tracer(address)))
+	go serverMetrics.watch(context.Background(), address, amp)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := amp.ConnectWithConfig(ctx, host, deviceType, remote.ConnectConfig{Port: uint16(port)}) // #nosec G115 -- Parsed as 16 bits.
+	if err != nil {
+		return nil, err
+	}
+
+	return &api{amp: amp, address: address}, nil
+}
+
+// register serves the API on the mux.
+func (a *api) register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/state", a.handle(nil))
+	mux.HandleFunc("PUT /api/power", a.handle(a.setPower))
+	mux.HandleFunc("POST /api/power/toggle", a.handle(a.togglePower))
+	mux.HandleFunc("PUT /api/volume", a.handle(a.setVolume))
+	mux.HandleFunc("POST /api/volume/up", a.handle(a.volumeUp))
+	mux.HandleFunc("POST /api/volume/down", a.handle(a.volumeDown))
+	mux.HandleFunc("PUT /api/mute", a.handle(a.setMute))
+	mux.HandleFunc("POST /api/mute/toggle", a.handle(a.toggleMute))
+	mux.HandleFunc("PUT /api/input", a.handle(a.setInput))
+	mux.HandleFunc("PUT /api/reset-delay", a.handle(a.setResetDelay))
+}
+
+type apiInput struct {
+	Number device.Input `json:"number"`
+	Name   string       `json:"name"`
+}
+
+type apiResetDelay struct {
+	// Minutes is nil when the reset delay is stopped.
+	Minutes *remote.Minutes `json:"minutes"`
+}
+
+type apiState struct {
+	Model      string         `json:"model"`
+	Connection string         `json:"connection"`
+	Power      bool           `json:"power"`
+	Volume     remote.Volume  `json:"volume"`
+	Mute       bool           `json:"mute"`
+	Input      apiInput       `json:"input"`
+	ResetDelay *apiResetDelay `json:"resetDelay,omitempty"`
+}
+
+// state returns the last known state. The reset delay is left out when it can't be fetched.
+func (a *api) state(ctx context.Context) apiState {
+	model := a.amp.GetDeviceType()
+	snapshot := a.amp.Snapshot()
+	name, _ := device.NameFromNumber(model, snapshot.Input)
+	state := apiState{
+		Model:      model.String(),
+		Connection: strings.ToLower(a.amp.GetConnectionState().String()),
+		Power:      snapshot.Power,
+		Volume:     snapshot.Volume,
+		Mute:       snapshot.Mute,
+		Input:      apiInput{Number: snapshot.Input, Name: name},
+	}
+
+	if a.amp.GetConnectionState() != remote.Connected {
+		return state
+	}
+
+	delay, err := a.amp.GetResetDelayContext(ctx)
+	if err != nil {
+		slog.Error("Failed to get reset delay:", slog.String("reason", err.Error()))
+		return state
+	}
+
+	state.ResetDelay = &apiResetDelay{}
+	if !delay.Stopped {
+		state.ResetDelay.Minutes = &delay.Minutes
+	}
+	return state
+}
+
+// apiAction changes the amplifier as requested. The state is written as the response afterwards.
+type apiAction func(ctx context.Context, r *http.Request) error
+
+func (a *api) handle(action apiAction) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), apiTimeout)
+		defer cancel()
+
+		if action != nil {
+			err := a.perform(ctx, r, action)
+			if err != nil {
+				writeAPIError(w, r, err)
+				return
+			}
+		}
+
+		writeJSON(w, http.StatusOK, a.state(ctx))
+	}
+}
+
+func (a *api) perform(ctx context.Context, r *http.Request, action apiAction) error {
+	if state := a.amp.GetConnectionState(); state != remote.Connected {
+		return &apiError{
+			status:  http.StatusServiceUnavailable,
+			Code:    "not_connected",
+			Message: "not connected to the amplifier: " + strings.ToLower(state.String()),
+		}
+	}
+
+	return action(ctx, r)
+}
+
+func (a *api) setPower(ctx context.Context, r *http.Request) error {
+	body := struct {
+		Power *bool `json:"power"`
+	}{}
+	if err := decodeBody(r, &body); err != nil {
+		return err
+	} else if body.Power == nil {
+		return badRequest("expected a power field with true or false")
+	}
+
+	_, err := a.amp.SetPowerContext(ctx, *body.Power)
+	return err
+}
+
+func (a *api) togglePower(ctx context.Context, _ *http.Request) error {
+	_, err := a.amp.TogglePowerContext(ctx)
+	return err
+}
+
+func (a *api) setVolume(ctx context.Context, r *http.Request) error {
+	body := struct {
+		Volume *int `json:"volume"`
+	}{}
+	if err := decodeBody(r, &body); err != nil {
+		return err
+	} else if body.Volume == nil || *body.Volume < 0 || *body.Volume > 100 {
+		return badRequest("expected a volume field between 0 and 100")
+	}
+
+	_, err := a.amp.SetVolumeContext(ctx, remote.Volume(*body.Volume)) // #nosec G115 -- Checked above.
+	return err
+}
+
+func (a *api) volumeUp(ctx context.Context, _ *http.Request) error {
+	_, err := a.amp.VolumeUpContext(ctx)
+	return err
+}
+
+func (a *api) volumeDown(ctx context.Context, _ *http.Request) error {
+	_, err := a.amp.VolumeDownContext(ctx)
+	return err
+}
+
+func (a *api) setMute(ctx context.Context, r *http.Request) error {
+	body := struct {
+		Mute *bool `json:"mute"`
+	}{}
+	if err := decodeBody(r, &body); err != nil {
+		return err
+	} else if body.Mute == nil {
+		return badRequest("expected a mute field with true or false")
+	}
+
+	_, err := a.amp.SetVolumeMuteContext(ctx, *body.Mute)
+	return err
+}
+
+func (a *api) toggleMute(ctx context.Context, _ *http.Request) error {
+	_, err := a.amp.ToggleVolumeMuteContext(ctx)
+	return err
+}
+
+func (a *api) setInput(ctx context.Context, r *http.Request) error {
+	body := struct {
+		Input json.RawMessage `json:"input"`
+	}{}
+	if err := decodeBody(r, &body); err != nil {
+		return err
+	}
+
+	input, err := parseAPIInput(a.amp.GetDeviceType(), body.Input)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.amp.SetInputContext(ctx, input)
+	return err
+}
+
+// parseAPIInput parses an input given either as a number or as a case-insensitive input name.
+func parseAPIInput(model device.Type, raw json.RawMessage) (device.Input, error) {
+	names, err := device.GetInputNames(model)
+	if err != nil {
+		return 0, err
+	}
+
+	number := 0
+	if err := json.Unmarshal(raw, &number); err == nil {
+		if number < 1 || number > len(names) {
+			return 0, badRequest("input %d is out of range, the %s has %d inputs", number, model, len(names))
+		}
+		return device.Input(number), nil // #nosec G115 -- Checked above.
+	}
+
+	name := ""
+	if err := json.Unmarshal(raw, &name); err != nil {
+		return 0, badRequest("expected an input field with a number or a name")
+	}
+
+	index := slices.IndexFunc(names, func(input string) bool { return strings.EqualFold(input, name) })
+	if index == -1 {
+		return 0, badRequest("unknown input %q, expected one of %q", name, names)
+	}
+
+	return device.Input(index + 1), nil // #nosec G115 -- Inputs are few.
+}
+
+func (a *api) setResetDelay(ctx context.Context, r *http.Request) error {
+	body := struct {
+		Minutes json.RawMessage `json:"minutes"`
+	}{}
+	if err := decodeBody(r, &body); err != nil {
+		return err
+	}
+
+	if string(body.Minutes) == "null" {
+		_, err := a.amp.StopResetDelayContext(ctx)
+		return err
+	}
+
+	minutes := remote.Minutes(0)
+	if err := json.Unmarshal(body.Minutes, &minutes); err != nil {
+		return badRequest("expected a minutes field between 0 and 255, or null to stop the reset delay")
+	}
+
+	_, err := a.amp.SetResetDelayContext(ctx, minutes)
+	return err
+}
+
+// decodeBody decodes a small JSON request body and refuses unknown fields.
+func decodeBody(r *http.Request, body any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(body); err != nil {
+		return badRequest("invalid request body: %v", err)
+	}
+	return nil
+}
+
+// apiError is the structured error written as the response when a request fails.
+type apiError struct {
+	status int
+
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+func badRequest(format string, args ...any) *apiError {
+	return &apiError{status: http.StatusBadRequest, Code: "bad_request", Message: fmt.Sprintf(format, args...)}
+}
+
+// toAPIError maps errors from the amplifier to a status code and an error code.
+func toAPIError(err error) *apiError {
+	var apiErr *apiError
+	var limitErr *remote.VolumeLimitError
+	var timeoutErr *remote.TimeoutError
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.As(err, &limitErr):
+		return &apiError{status: http.StatusUnprocessableEntity, Code: "volume_limit", Message: err.Error()}
+	case errors.As(err, &timeoutErr):
+		return &apiError{status: http.StatusGatewayTimeout, Code: "timeout", Message: err.Error()}
+	}
+
+	return &apiError{status: http.StatusBadGateway, Code: "amplifier_error", Message: err.Error()}
+}
+
+func writeAPIError(w http.ResponseWriter, r *http.Request, err error) {
+	apiErr := toAPIError(err)
+	if apiErr.status >= http.StatusInternalServerError {
+		slog.Error("API request failed:", slog.String("path", r.URL.Path), slog.String("reason", err.Error()))
+	}
+
+	writeJSON(w, apiErr.status, struct {
+		Error *apiError `json:"error"`
+	}{apiErr})
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(value)
+	if err != nil {
+		slog.Error("Failed to write API response:", slog.String("reason", err.Error()))
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/Jacalz/hegelmote/remote"
+	"github.com/Jacalz/hegelmote/remote/hegelsim"
+	"github.com/alecthomas/assert/v2"
+)
+
+func newSimulator(t *testing.T, model device.Type) *hegelsim.Amplifier {
+	t.Helper()
+
+	sim, err := hegelsim.New(model)
+	assert.NoError(t, err)
+	assert.NoError(t, sim.Listen("127.0.0.1:0"))
+	t.Cleanup(func() { sim.Close() })
+	return sim
+}
+
+// newTestAPI serves the API for the simulator from a test server.
+func newTestAPI(t *testing.T, sim *hegelsim.Amplifier) (*api, *httptest.Server) {
+	t.Helper()
+
+	a, err := connectAPI("127.0.0.1:"+strconv.Itoa(int(sim.Port())), sim.Model().String())
+	assert.NoError(t, err)
+	t.Cleanup(func() { a.amp.Disconnect() })
+
+	mux := http.NewServeMux()
+	a.register(mux)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return a, server
+}
+
+// request sends the request and decodes the response body into the result.
+func request(t *testing.T, server *httptest.Server, method, path, body string, result any) int {
+	t.Helper()
+
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	assert.NoError(t, err)
+	resp, err := server.Client().Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(result))
+	return resp.StatusCode
+}
+
+type errorResponse struct {
+	Error apiError `json:"error"`
+}
+
+func TestAPIState(t *testing.T) {
+	sim := newSimulator(t, device.H95)
+	sim.SetPower(true)
+	sim.SetVolume(25)
+	assert.NoError(t, sim.SetInput(3))
+	_, server := newTestAPI(t, sim)
+
+	state := apiState{}
+	assert.Equal(t, http.StatusOK, request(t, server, http.MethodGet, "/api/state", "", &state))
+
+	minutes := remote.Minutes(3)
+	assert.Equal(t, apiState{
+		Model:      "H95",
+		Connection: "connected",
+		Power:      true,
+		Volume:     25,
+		Input:      apiInput{Number: 3, Name: "Coaxial"},
+		ResetDelay: &apiResetDelay{Minutes: &minutes},
+	}, state)
+}
+
+func TestAPIActions(t *testing.T) {
+	sim := newSimulator(t, device.H95)
+	sim.SetVolume(20)
+	_, server := newTestAPI(t, sim)
+
+	for _, test := range []struct {
+		method, path, body string
+		check              func(state apiState) bool
+	}{
+		{http.MethodPut, "/api/power", `{"power":true}`, func(s apiState) bool { return s.Power }},
+		{http.MethodPost, "/api/power/toggle", "", func(s apiState) bool { return !s.Power }},
+		{http.MethodPut, "/api/volume", `{"volume":30}`, func(s apiState) bool { return s.Volume == 30 }},
+		{http.MethodPost, "/api/volume/up", "", func(s apiState) bool { return s.Volume == 31 }},
+		{http.MethodPost, "/api/volume/down", "", func(s apiState) bool { return s.Volume == 30 }},
+		{http.MethodPut, "/api/mute", `{"mute":true}`, func(s apiState) bool { return s.Mute }},
+		{http.MethodPost, "/api/mute/toggle", "", func(s apiState) bool { return !s.Mute }},
+		{http.MethodPut, "/api/input", `{"input":"optical 1"}`, func(s apiState) bool { return s.Input == apiInput{4, "Optical 1"} }},
+		{http.MethodPut, "/api/input", `{"input":7}`, func(s apiState) bool { return s.Input == apiInput{7, "USB"} }},
+		{http.MethodPut, "/api/reset-delay", `{"minutes":5}`, func(s apiState) bool { return *s.ResetDelay.Minutes == 5 }},
+		{http.MethodPut, "/api/reset-delay", `{"minutes":null}`, func(s apiState) bool { return s.ResetDelay.Minutes == nil }},
+	} {
+		state := apiState{}
+		status := request(t, server, test.method, test.path, test.body, &state)
+		assert.Equal(t, http.StatusOK, status, "%s %s %s", test.method, test.path, test.body)
+		assert.True(t, test.check(state), "%s %s %s: %+v", test.method, test.path, test.body, state)
+	}
+
+	assert.Equal(t, hegelsim.State{Volume: 30, Input: 7, ResetStopped: true}, sim.State())
+}
+
+func TestAPIBadRequests(t *testing.T) {
+	sim := newSimulator(t, device.H95)
+	sim.SetVolume(20)
+	_, server := newTestAPI(t, sim)
+
+	// Messages of decoding errors are only compared up to where they differ between Go versions.
+	for _, test := range []struct {
+		path, body, message string
+	}{
+		{"/api/power", `{}`, "expected a power field with true or false"},
+		{"/api/power", `{"power":"on"}`, "invalid request body: json: cannot unmarshal string"},
+		{"/api/volume", `{"volume":101}`, "expected a volume field between 0 and 100"},
+		{"/api/volume", `{"volume":-1}`, "expected a volume field between 0 and 100"},
+		{"/api/volume", `{"volume":30,"mute":true}`, `invalid request body: json: unknown field "mute"`},
+		{"/api/volume", ``, "invalid request body: EOF"},
+		{"/api/volume", `{"volume":` + strings.Repeat(" ", maxBodySize) + `30}`, "invalid request body: http: request body too large"},
+		{"/api/mute", `{"mute":null}`, "expected a mute field with true or false"},
+		{"/api/input", `{"input":0}`, "input 0 is out of range, the H95 has 8 inputs"},
+		{"/api/input", `{"input":"phono"}`, `unknown input "phono", expected one of ["Analog 1" "Analog 2" "Coaxial" "Optical 1" "Optical 2" "Optical 3" "USB" "Network"]`},
+		{"/api/input", `{"input":true}`, "expected an input field with a number or a name"},
+		{"/api/reset-delay", `{"minutes":256}`, "expected a minutes field between 0 and 255, or null to stop the reset delay"},
+	} {
+		response := errorResponse{}
+		status := request(t, server, http.MethodPut, test.path, test.body, &response)
+		assert.Equal(t, http.StatusBadRequest, status, "%s %s", test.path, test.body)
+		assert.Equal(t, "bad_request", response.Error.Code, "%s %s", test.path, test.body)
+		assert.True(t, strings.HasPrefix(response.Error.Message, test.message), "%s %s: %s", test.path, test.body, response.Error.Message)
+	}
+
+	assert.Equal(t, 20, sim.State().Volume)
+}
+
+func TestAPIErrors(t *testing.T) {
+	sim := newSimulator(t, device.H95)
+	sim.SetVolume(20)
+	a, server := newTestAPI(t, sim)
+
+	a.amp.SetVolumeLimit(&remote.VolumeLimit{Max: 40})
+	response := errorResponse{}
+	status := request(t, server, http.MethodPut, "/api/volume", `{"volume":50}`, &response)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, apiError{Code: "volume_limit", Message: "volume 50 is above the limit of 40"}, response.Error)
+
+	assert.NoError(t, a.amp.Disconnect())
+	status = request(t, server, http.MethodPost, "/api/mute/toggle", "", &response)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, apiError{Code: "not_connected", Message: "not connected to the amplifier: disconnected"}, response.Error)
+
+	// The last known state is still served, without the reset delay.
+	state := apiState{}
+	assert.Equal(t, http.StatusOK, request(t, server, http.MethodGet, "/api/state", "", &state))
+	assert.Equal(t, "disconnected", state.Connection)
+	assert.Equal(t, 20, state.Volume)
+	assert.Zero(t, state.ResetDelay)
+}
+
+func TestParseAPIInput(t *testing.T) {
+	for _, test := range []struct {
+		model device.Type
+		raw   string
+		input device.Input
+		err   bool
+	}{
+		{device.H95, `1`, 1, false},
+		{device.H95, `8`, 8, false},
+		{device.H95, `"usb"`, 7, false},
+		{device.H95, `"Analog 2"`, 2, false},
+		{device.H190V, `"XLR"`, 1, false},
+		{device.H120, `9`, 9, false},
+		{device.H95, `9`, 0, true},
+		{device.H95, `"XLR"`, 0, true},
+		{device.H95, `1.5`, 0, true},
+		{device.H95, `null`, 0, true},
+		{device.Type(-1), `1`, 0, true},
+	} {
+		input, err := parseAPIInput(test.model, json.RawMessage(test.raw))
+		if test.err {
+			assert.Error(t, err, test.raw)
+			continue
+		}
+
+		assert.NoError(t, err, test.raw)
+		assert.Equal(t, test.input, input, test.raw)
+	}
+}
+
+func TestToAPIError(t *testing.T) {
+	badRequestErr := badRequest("bad %s", "input")
+	for _, test := range []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{badRequestErr, http.StatusBadRequest, "bad_request"},
+		{fmt.Errorf("wrapped: %w", badRequestErr), http.StatusBadRequest, "bad_request"},
+		{&remote.VolumeLimitError{Volume: 50, Limit: 40}, http.StatusUnprocessableEntity, "volume_limit"},
+		{&remote.TimeoutError{Packet: "-v.50", Err: context.DeadlineExceeded}, http.StatusGatewayTimeout, "timeout"},
+		{&remote.ProtocolError{Code: 3}, http.StatusBadGateway, "amplifier_error"},
+		{errors.New("connection reset"), http.StatusBadGateway, "amplifier_error"},
+	} {
+		apiErr := toAPIError(test.err)
+		assert.Equal(t, test.status, apiErr.status, test.err.Error())
+		assert.Equal(t, test.code, apiErr.Code, test.err.Error())
+	}
+
+	assert.Equal(t, "bad input", toAPIError(badRequestErr).Message)
+}
@@ -24,6 +24,12 @@ func main() {
 	flag.Uint64Var(&portNumber, "port", portNumber, "port to serve on")
 	noWASM := false
 	flag.BoolVar(&noWASM, "no-wasm", noWASM, "disable hosting of WASM files")
+	trace := false
+	flag.BoolVar(&trace, "trace", trace, "log every packet exchanged with the amplifier")
+	amplifier := ""
+	flag.StringVar(&amplifier, "amplifier", amplifier, "host of an amplifier to serve a REST API for under /api")
+	model := ""
+	flag.StringVar(&model, "model", model, "model of the amplifier given using -amplifier")
 	flag.Parse()
 
 	if args := flag.Args(); len(args) > 0 {
@@ -38,14 +44,26 @@ func main() {
 	}
 	defer logfile.Close()
 
-	logger := slog.NewTextHandler(io.MultiWriter(os.Stdout, logfile), nil)
+	logger := slog.NewTextHandler(io.MultiWriter(os.Stdout, logfile), &slog.HandlerOptions{Level: logLevel(trace)})
 	slog.SetDefault(slog.New(logger))
+	if trace {
+		traceHandler = logger
+	}
 
 	if !noWASM {
 		serveWASM()
 	}
 	http.Handle("/proxy", http.HandlerFunc(proxyHandler))
 	http.Handle("/upnp", http.HandlerFunc(upnpHandler))
+	http.Handle("GET /metrics", serverMetrics)
+	if amplifier != "" {
+		api, err := connectAPI(amplifier, model)
+		if err != nil {
+			log.Fatalln("Error connecting to amplifier:", err)
+		}
+		defer api.amp.Disconnect()
+		api.register(http.DefaultServeMux)
+	}
 
 	port := strconv.FormatUint(portNumber, 10)
 	fmt.Printf("Serving at: http://localhost:%s\n", port)
@@ -69,3 +87,11 @@ func main() {
 		log.Fatalln("Error when running server:", err)
 	}
 }
+
+// logLevel returns the debug level, which packets are traced at, when tracing.
+func logLevel(trace bool) slog.Level {
+	if trace {
+		return slog.LevelDebug
+	}
+	return slog.LevelInfo
+}
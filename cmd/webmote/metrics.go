@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/Jacalz/hegelmote/remote"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the command latency histogram.
+var latencyBuckets = [...]float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// otherAmplifiers is the label that amplifiers which are neither discovered nor served by the API are counted under.
+// It keeps clients of the proxy from adding a set of metrics for every host that they ask for.
+const otherAmplifiers = "other"
+
+// serverMetrics collects the metrics served on /metrics in the Prometheus text format.
+var serverMetrics = &metrics{amplifiers: map[string]*amplifierMetrics{}}
+
+type histogram struct {
+	buckets [len(latencyBuckets)]uint64
+	sum     float64
+	count   uint64
+}
+
+func (h *histogram) observe(value float64) {
+	for i, bound := range latencyBuckets {
+		if value <= bound {
+			h.buckets[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+// amplifierMetrics holds the protocol counters of one amplifier, whether reached through the proxy or the API.
+// The state is taken from the packets sent by the amplifier, which keeps it up to date for both.
+type amplifierMetrics struct {
+	commands   uint64
+	errors     map[uint8]uint64
+	resets     uint64
+	reconnects uint64
+	latency    histogram
+
+	known   bool // Not set for the amplifiers counted together as other amplifiers.
+	model   device.Type
+	state   remote.State
+	proxies int                         // Number of open proxy connections.
+	control *remote.ControlWithListener // The connection used by the API, if any.
+}
+
+type metrics struct {
+	proxyClients     atomic.Int64
+	websocketClients atomic.Int64
+
+	lock       sync.Mutex
+	amplifiers map[string]*amplifierMetrics
+}
+
+// addAmplifier reports metrics for the amplifier at the address, instead of counting it as one of the other amplifiers.
+// The control is the connection to the amplifier, or nil if it is only reached through the proxy.
+func (m *metrics) addAmplifier(address string, model device.Type, control *remote.ControlWithListener) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	amp, ok := m.amplifiers[address]
+	if !ok {
+		amp = &amplifierMetrics{errors: map[uint8]uint64{}}
+		m.amplifiers[address] = amp
+	}
+
+	amp.known = true
+	amp.model = model
+	if control != nil {
+		amp.control = control
+	}
+}
+
+// amplifier returns the counters for the amplifier address, or for the other amplifiers if it has not been added.
+// The lock must be held when calling this method.
+func (m *metrics) amplifier(address string) *amplifierMetrics {
+	if amp, ok := m.amplifiers[address]; ok && amp.known {
+		return amp
+	}
+
+	amp, ok := m.amplifiers[otherAmplifiers]
+	if !ok {
+		amp = &amplifierMetrics{errors: map[uint8]uint64{}}
+		m.amplifiers[otherAmplifiers] = amp
+	}
+	return amp
+}
+
+// tracer returns a tracer that counts the packets exchanged with the amplifier at the address.
+func (m *metrics) tracer(address string) remote.Tracer {
+	return func(event remote.TraceEvent) {
+		m.lock.Lock()
+		defer m.lock.Unlock()
+
+		amp := m.amplifier(address)
+		switch {
+		case event.Direction == remote.TraceSent:
+			amp.commands++
+		case len(event.Packet) == len("-e.3") && strings.HasPrefix(event.Packet, "-e."):
+			if code := event.Packet[3]; code >= '0' && code <= '9' {
+				amp.errors[code-'0']++
+			}
+		case event.Packet == "-r.0" && event.Latency == 0:
+			amp.resets++
+		default:
+			amp.updateState(event.Packet, event.Time)
+		}
+
+		if event.Latency > 0 {
+			amp.latency.observe(event.Latency.Seconds())
+		}
+	}
+}
+
+// updateState applies a packet from the amplifier, like "-v.20", to the state.
+// The lock of the metrics must be held when calling this method.
+func (a *amplifierMetrics) updateState(packet string, now time.Time) {
+	if len(packet) < len("-v.0") || packet[2] != '.' {
+		return
+	}
+
+	switch packet[1] {
+	case 'p':
+		a.state.Power, a.state.PowerUpdated = packet[3:] == "1", now
+	case 'm':
+		a.state.Mute, a.state.MuteUpdated = packet[3:] == "1", now
+	case 'v', 'i':
+		number, err := strconv.ParseUint(packet[3:], 10, 8)
+		if err != nil {
+			return
+		} else if packet[1] == 'v' {
+			a.state.Volume, a.state.VolumeUpdated = remote.Volume(number), now
+		} else {
+			a.state.Input, a.state.InputUpdated = device.Input(number), now
+		}
+	}
+}
+
+// connected reports if the amplifier is reached through the proxy or the API.
+// The lock of the metrics must be held when calling this method.
+func (a *amplifierMetrics) connected() bool {
+	return a.proxies > 0 || (a.control != nil && a.control.GetConnectionState() == remote.Connected)
+}
+
+// proxyConnected counts a proxy connection to the amplifier at the address until the returned function is called.
+func (m *metrics) proxyConnected(address string) func() {
+	m.lock.Lock()
+	amp := m.amplifier(address)
+	amp.proxies++
+	m.lock.Unlock()
+
+	return func() {
+		m.lock.Lock()
+		amp.proxies--
+		m.lock.Unlock()
+	}
+}
+
+// watch counts the reconnections of the amplifier until the context is done.
+func (m *metrics) watch(ctx context.Context, address string, amp *remote.ControlWithListener) {
+	previous := amp.GetConnectionState()
+	for event := range amp.SubscribeWithConfig(ctx, remote.SubscribeConfig{Buffer: 64}) {
+		changed, ok := event.(remote.ConnectionStateChanged)
+		if !ok {
+			continue
+		}
+
+		if changed.State == remote.Connected && previous == remote.Reconnecting {
+			m.lock.Lock()
+			m.amplifier(address).reconnects++
+			m.lock.Unlock()
+		}
+		previous = changed.State
+	}
+}
+
+// clientConnected counts a websocket client until the returned function is called.
+func (m *metrics) clientConnected(proxy bool) func() {
+	m.websocketClients.Add(1)
+	if proxy {
+		m.proxyClients.Add(1)
+	}
+
+	return func() {
+		m.websocketClients.Add(-1)
+		if proxy {
+			m.proxyClients.Add(-1)
+		}
+	}
+}
+
+func (m *metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	out := &metricWriter{w: bufio.NewWriter(w)}
+	out.family("hegelmote_proxy_clients", "gauge", "Number of clients connected to amplifiers through the proxy.")
+	out.sample("hegelmote_proxy_clients", "", float64(m.proxyClients.Load()))
+	out.family("hegelmote_websocket_clients", "gauge", "Number of open websocket connections, for the proxy and for discovery.")
+	out.sample("hegelmote_websocket_clients", "", float64(m.websocketClients.Load()))
+
+	m.lock.Lock()
+	m.writeStateMetrics(out)
+	m.writeAmplifierMetrics(out)
+	m.lock.Unlock()
+
+	if err := out.w.Flush(); err != nil {
+		slog.Error("Failed to write metrics:", slog.String("reason", err.Error()))
+	}
+}
+
+// writeStateMetrics writes the state gauges of the amplifiers that have been added, for the values received so far.
+// The lock must be held when calling this method.
+func (m *metrics) writeStateMetrics(out *metricWriter) {
+	addresses := slices.DeleteFunc(slices.Sorted(maps.Keys(m.amplifiers)), func(address string) bool {
+		return !m.amplifiers[address].known
+	})
+
+	labels := func(address string) string {
+		return formatLabels("amplifier", address, "model", m.amplifiers[address].model.String())
+	}
+
+	out.family("hegelmote_connected", "gauge", "Whether the amplifier is connected, 1 for yes and 0 for no.")
+	for _, address := range addresses {
+		out.sample("hegelmote_connected", labels(address), boolToFloat(m.amplifiers[address].connected()))
+	}
+
+	out.family("hegelmote_power", "gauge", "Whether the amplifier is turned on, 1 for on and 0 for off.")
+	for _, address := range addresses {
+		if state := m.amplifiers[address].state; !state.PowerUpdated.IsZero() {
+			out.sample("hegelmote_power", labels(address), boolToFloat(state.Power))
+		}
+	}
+
+	out.family("hegelmote_volume", "gauge", "Volume of the amplifier, from 0 to 100.")
+	for _, address := range addresses {
+		if state := m.amplifiers[address].state; !state.VolumeUpdated.IsZero() {
+			out.sample("hegelmote_volume", labels(address), float64(state.Volume))
+		}
+	}
+
+	out.family("hegelmote_mute", "gauge", "Whether the amplifier is muted, 1 for muted and 0 for not.")
+	for _, address := range addresses {
+		if state := m.amplifiers[address].state; !state.MuteUpdated.IsZero() {
+			out.sample("hegelmote_mute", labels(address), boolToFloat(state.Mute))
+		}
+	}
+
+	out.family("hegelmote_input", "gauge", "Number of the selected input, counting from 1.")
+	for _, address := range addresses {
+		if state := m.amplifiers[address].state; !state.InputUpdated.IsZero() {
+			out.sample("hegelmote_input", labels(address), float64(state.Input))
+		}
+	}
+}
+
+// writeAmplifierMetrics writes the protocol counters. The lock must be held when calling this method.
+func (m *metrics) writeAmplifierMetrics(out *metricWriter) {
+	addresses := slices.Sorted(maps.Keys(m.amplifiers))
+
+	out.family("hegelmote_commands_total", "counter", "Number of commands sent to the amplifier.")
+	for _, address := range addresses {
+		out.sample("hegelmote_commands_total", formatLabels("amplifier", address), float64(m.amplifiers[address].commands))
+	}
+
+	out.family("hegelmote_errors_total", "counter", "Number of errors sent by the amplifier, by error code.")
+	for _, address := range addresses {
+		errors := m.amplifiers[address].errors
+		for _, code := range slices.Sorted(maps.Keys(errors)) {
+			reason := (&remote.ProtocolError{Code: code}).Error()
+			labels := formatLabels("amplifier", address, "code", strconv.Itoa(int(code)), "reason", reason)
+			out.sample("hegelmote_errors_total", labels, float64(errors[code]))
+		}
+	}
+
+	out.family("hegelmote_resets_total", "counter", "Number of times the amplifier announced that it resets the connection.")
+	for _, address := range addresses {
+		out.sample("hegelmote_resets_total", formatLabels("amplifier", address), float64(m.amplifiers[address].resets))
+	}
+
+	out.family("hegelmote_reconnects_total", "counter", "Number of times the connection to the amplifier was restored after being lost.")
+	for _, address := range addresses {
+		out.sample("hegelmote_reconnects_total", formatLabels("amplifier", address), float64(m.amplifiers[address].reconnects))
+	}
+
+	out.family("hegelmote_command_duration_seconds", "histogram", "Time from sending a command to receiving the response.")
+	for _, address := range addresses {
+		latency := m.amplifiers[address].latency
+		for i, bound := range latencyBuckets {
+			labels := formatLabels("amplifier", address, "le", strconv.FormatFloat(bound, 'g', -1, 64))
+			out.sample("hegelmote_command_duration_seconds_bucket", labels, float64(latency.buckets[i]))
+		}
+		out.sample("hegelmote_command_duration_seconds_bucket", formatLabels("amplifier", address, "le", "+Inf"), float64(latency.count))
+		out.sample("hegelmote_command_duration_seconds_sum", formatLabels("amplifier", address), latency.sum)
+		out.sample("hegelmote_command_duration_seconds_count", formatLabels("amplifier", address), float64(latency.count))
+	}
+}
+
+// metricWriter writes metrics in the Prometheus text format.
+type metricWriter struct {
+	w *bufio.Writer
+}
+
+func (w *metricWriter) family(name, kind, help string) {
+	fmt.Fprintf(w.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (w *metricWriter) sample(name, labels string, value float64) {
+	fmt.Fprintf(w.w, "%s%s %s\n", name, labels, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// formatLabels formats pairs of label names and values.
+func formatLabels(pairs ...string) string {
+	labels := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		labels = append(labels, pairs[i]+`="`+labelEscaper.Replace(pairs[i+1])+`"`)
+	}
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+func boolToFloat(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
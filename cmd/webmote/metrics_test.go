@@ -0,0 +1,197 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/Jacalz/hegelmote/remote"
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestFormatLabels(t *testing.T) {
+	for _, test := range []struct {
+		pairs  []string
+		labels string
+	}{
+		{nil, "{}"},
+		{[]string{"amplifier", "amp:50001"}, `{amplifier="amp:50001"}`},
+		{[]string{"amplifier", "amp", "le", "0.5"}, `{amplifier="amp",le="0.5"}`},
+		{[]string{"reason", `back\slash "quoted"` + "\nnext line"}, `{reason="back\\slash \"quoted\"\nnext line"}`},
+		{[]string{"amplifier", "amp", "unpaired"}, `{amplifier="amp"}`},
+	} {
+		assert.Equal(t, test.labels, formatLabels(test.pairs...))
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := histogram{}
+	h.observe(0.001)
+	h.observe(0.01) // Bounds are inclusive.
+	h.observe(0.3)
+	h.observe(10) // Only counted by the +Inf bucket.
+
+	assert.Equal(t, [len(latencyBuckets)]uint64{1, 2, 2, 2, 2, 2, 3, 3, 3}, h.buckets)
+	assert.Equal(t, 4, h.count)
+	assert.True(t, h.sum > 10.310 && h.sum < 10.312)
+}
+
+func serveMetrics(t *testing.T, m *metrics) string {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	m.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", recorder.Header().Get("Content-Type"))
+	return recorder.Body.String()
+}
+
+func TestMetricsOutput(t *testing.T) {
+	m := &metrics{amplifiers: map[string]*amplifierMetrics{}}
+	done := m.clientConnected(true)
+	m.clientConnected(false)
+	done()
+
+	m.addAmplifier("amp:50001", device.H95, nil)
+	disconnected := m.proxyConnected("amp:50001")
+	m.proxyConnected("amp:50001")
+	disconnected()
+
+	trace := m.tracer("amp:50001")
+	trace(remote.TraceEvent{Direction: remote.TraceSent, Packet: "-v.20"})
+	trace(remote.TraceEvent{Time: time.Now(), Direction: remote.TraceReceived, Packet: "-v.20", Latency: 20 * time.Millisecond})
+	trace(remote.TraceEvent{Direction: remote.TraceSent, Packet: "-i.12"})
+	trace(remote.TraceEvent{Direction: remote.TraceReceived, Packet: "-e.3", Latency: 2 * time.Second})
+	trace(remote.TraceEvent{Direction: remote.TraceReceived, Packet: "-r.0"})
+	trace(remote.TraceEvent{Time: time.Now(), Direction: remote.TraceReceived, Packet: "-v.21"})
+	trace(remote.TraceEvent{Time: time.Now(), Direction: remote.TraceReceived, Packet: "-p.1"})
+	trace(remote.TraceEvent{Direction: remote.TraceReceived, Packet: "-e.x"})
+
+	// Amplifiers that have not been added are counted together, without their state.
+	m.tracer("other:50001")(remote.TraceEvent{Direction: remote.TraceReceived, Packet: "-e.1"})
+	m.tracer("192.0.2.1:50001")(remote.TraceEvent{Direction: remote.TraceSent, Packet: "-m.?"})
+	m.tracer("192.0.2.1:50001")(remote.TraceEvent{Direction: remote.TraceReceived, Packet: "-m.1"})
+	m.proxyConnected("192.0.2.1:50001")
+
+	expected := `# HELP hegelmote_proxy_clients Number of clients connected to amplifiers through the proxy.
+# TYPE hegelmote_proxy_clients gauge
+hegelmote_proxy_clients 0
+# HELP hegelmote_websocket_clients Number of open websocket connections, for the proxy and for discovery.
+# TYPE hegelmote_websocket_clients gauge
+hegelmote_websocket_clients 1
+# HELP hegelmote_connected Whether the amplifier is connected, 1 for yes and 0 for no.
+# TYPE hegelmote_connected gauge
+hegelmote_connected{amplifier="amp:50001",model="H95"} 1
+# HELP hegelmote_power Whether the amplifier is turned on, 1 for on and 0 for off.
+# TYPE hegelmote_power gauge
+hegelmote_power{amplifier="amp:50001",model="H95"} 1
+# HELP hegelmote_volume Volume of the amplifier, from 0 to 100.
+# TYPE hegelmote_volume gauge
+hegelmote_volume{amplifier="amp:50001",model="H95"} 21
+# HELP hegelmote_mute Whether the amplifier is muted, 1 for muted and 0 for not.
+# TYPE hegelmote_mute gauge
+# HELP hegelmote_input Number of the selected input, counting from 1.
+# TYPE hegelmote_input gauge
+# HELP hegelmote_commands_total Number of commands sent to the amplifier.
+# TYPE hegelmote_commands_total counter
+hegelmote_commands_total{amplifier="amp:50001"} 2
+hegelmote_commands_total{amplifier="other"} 1
+# HELP hegelmote_errors_total Number of errors sent by the amplifier, by error code.
+# TYPE hegelmote_errors_total counter
+hegelmote_errors_total{amplifier="amp:50001",code="3",reason="invalid parameter"} 1
+hegelmote_errors_total{amplifier="other",code="1",reason="malformed command"} 1
+# HELP hegelmote_resets_total Number of times the amplifier announced that it resets the connection.
+# TYPE hegelmote_resets_total counter
+hegelmote_resets_total{amplifier="amp:50001"} 1
+hegelmote_resets_total{amplifier="other"} 0
+# HELP hegelmote_reconnects_total Number of times the connection to the amplifier was restored after being lost.
+# TYPE hegelmote_reconnects_total counter
+hegelmote_reconnects_total{amplifier="amp:50001"} 0
+hegelmote_reconnects_total{amplifier="other"} 0
+# HELP hegelmote_command_duration_seconds Time from sending a command to receiving the response.
+# TYPE hegelmote_command_duration_seconds histogram
+hegelmote_command_duration_seconds_bucket{amplifier="amp:50001",le="0.005"} 0
+hegelmote_command_duration_seconds_bucket{amplifier="amp:50001",le="0.01"} 0
+hegelmote_command_duration_seconds_bucket{amplifier="amp:50001",le="0.025"} 1
+hegelmote_command_duration_seconds_bucket{amplifier="amp:50001",le="0.05"} 1
+hegelmote_command_duration_seconds_bucket{amplifier="amp:50001",le="0.1"} 1
+hegelmote_command_duration_seconds_bucket{amplifier="amp:50001",le="0.25"} 1
+hegelmote_command_duration_seconds_bucket{amplifier="amp:50001",le="0.5"} 1
+hegelmote_command_duration_seconds_bucket{amplifier="amp:50001",le="1"} 1
+hegelmote_command_duration_seconds_bucket{amplifier="amp:50001",le="2.5"} 2
+hegelmote_command_duration_seconds_bucket{amplifier="amp:50001",le="+Inf"} 2
+hegelmote_command_duration_seconds_sum{amplifier="amp:50001"} 2.02
+hegelmote_command_duration_seconds_count{amplifier="amp:50001"} 2
+hegelmote_command_duration_seconds_bucket{amplifier="other",le="0.005"} 0
+hegelmote_command_duration_seconds_bucket{amplifier="other",le="0.01"} 0
+hegelmote_command_duration_seconds_bucket{amplifier="other",le="0.025"} 0
+hegelmote_command_duration_seconds_bucket{amplifier="other",le="0.05"} 0
+hegelmote_command_duration_seconds_bucket{amplifier="other",le="0.1"} 0
+hegelmote_command_duration_seconds_bucket{amplifier="other",le="0.25"} 0
+hegelmote_command_duration_seconds_bucket{amplifier="other",le="0.5"} 0
+hegelmote_command_duration_seconds_bucket{amplifier="other",le="1"} 0
+hegelmote_command_duration_seconds_bucket{amplifier="other",le="2.5"} 0
+hegelmote_command_duration_seconds_bucket{amplifier="other",le="+Inf"} 0
+hegelmote_command_duration_seconds_sum{amplifier="other"} 0
+hegelmote_command_duration_seconds_count{amplifier="other"} 0
+`
+	assert.Equal(t, expected, serveMetrics(t, m))
+}
+
+func TestStateMetrics(t *testing.T) {
+	sim := newSimulator(t, device.H95)
+	sim.SetPower(true)
+	sim.SetVolume(25)
+	assert.NoError(t, sim.SetInput(3))
+	a, _ := newTestAPI(t, sim)
+
+	// The API adds its amplifier to the metrics served by webmote.
+	labels := `{amplifier="` + a.address + `",model="H95"}`
+	output := serveMetrics(t, serverMetrics)
+	for _, sample := range []string{
+		"hegelmote_connected" + labels + " 1",
+		"hegelmote_power" + labels + " 1",
+		"hegelmote_volume" + labels + " 25",
+		"hegelmote_mute" + labels + " 0",
+		"hegelmote_input" + labels + " 3",
+	} {
+		assert.True(t, strings.Contains(output, "\n"+sample+"\n"), "missing %s in:\n%s", sample, output)
+	}
+
+	// Changes made on the amplifier itself are followed as well.
+	sim.SetVolume(30)
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(serveMetrics(t, serverMetrics), "\nhegelmote_volume"+labels+" 30\n") && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Contains(t, serveMetrics(t, serverMetrics), "\nhegelmote_volume"+labels+" 30\n")
+
+	assert.NoError(t, a.amp.Disconnect())
+	assert.Contains(t, serveMetrics(t, serverMetrics), "\nhegelmote_connected"+labels+" 0\n")
+}
+
+func TestUpdateState(t *testing.T) {
+	now := time.Now()
+	for _, test := range []struct {
+		packet string
+		state  remote.State
+	}{
+		{"-p.1", remote.State{Power: true, PowerUpdated: now}},
+		{"-p.0", remote.State{PowerUpdated: now}},
+		{"-m.1", remote.State{Mute: true, MuteUpdated: now}},
+		{"-v.100", remote.State{Volume: 100, VolumeUpdated: now}},
+		{"-i.12", remote.State{Input: 12, InputUpdated: now}},
+		{"-v.u", remote.State{}},
+		{"-v.256", remote.State{}},
+		{"-v.", remote.State{}},
+		{"-p:1", remote.State{}},
+		{"-r.3", remote.State{}},
+	} {
+		amp := &amplifierMetrics{}
+		amp.updateState(test.packet, now)
+		assert.Equal(t, test.state, amp.state, test.packet)
+	}
+}
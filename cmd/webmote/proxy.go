@@ -2,13 +2,16 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"log/slog"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync/atomic"
 
+	"github.com/Jacalz/hegelmote/remote"
 	"github.com/coder/websocket"
 	"golang.org/x/sync/errgroup"
 )
@@ -19,7 +22,7 @@ func proxyHandler(w http.ResponseWriter, r *http.Request) {
 	pid := id.Add(1)
 	slog.Info("New proxy connection", slog.Uint64("id", pid), slog.String("source", r.RemoteAddr))
 
-	err := runProxy(w, r)
+	err := runProxy(w, r, pid)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
@@ -27,21 +30,24 @@ func proxyHandler(w http.ResponseWriter, r *http.Request) {
 	slog.Info("Closing proxy connection", slog.Uint64("id", pid), slog.String("source", r.RemoteAddr))
 }
 
-func runProxy(w http.ResponseWriter, r *http.Request) error {
+func runProxy(w http.ResponseWriter, r *http.Request, pid uint64) error {
 	ws, err := websocket.Accept(w, r, nil)
 	if err != nil {
 		slog.Error("Failed to accept proxy socket:", slog.String("reason", err.Error()))
 		return err
 	}
 	defer ws.Close(websocket.StatusNormalClosure, "")
+	defer serverMetrics.clientConnected(true)()
 
 	prx := &proxy{ctx: r.Context(), ws: ws}
-	err = prx.connect()
+	address, err := prx.connect()
 	if err != nil {
 		slog.Error("Failed to connect to amplifier:", slog.String("reason", err.Error()))
 		return err
 	}
 	defer prx.amp.Close()
+	defer serverMetrics.proxyConnected(address)()
+	prx.tracer = newPacketTracer(pid, address)
 
 	wg := errgroup.Group{}
 	wg.Go(prx.forwardFromAmplifier)
@@ -53,27 +59,39 @@ type proxy struct {
 	ctx context.Context
 	ws  *websocket.Conn
 	amp net.Conn
+
+	tracer *packetTracer
 }
 
-func (p *proxy) connect() error {
+// connect connects to the amplifier requested by the client and returns its address.
+func (p *proxy) connect() (string, error) {
 	_, host, err := p.ws.Read(p.ctx)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	p.amp, err = net.Dial("tcp", net.JoinHostPort(string(host), "50001"))
-	return err
+	// Only the standard port is allowed, to keep the proxy from relaying to arbitrary services.
+	if _, _, err := net.SplitHostPort(string(host)); err == nil {
+		return "", fmt.Errorf("the proxy only connects to port %d, got %q", remote.DefaultPort, host)
+	}
+
+	address := net.JoinHostPort(string(host), strconv.Itoa(remote.DefaultPort))
+
+	p.amp, err = net.Dial("tcp", address)
+	return address, err
 }
 
+// forwardFromAmplifier sends each complete packet from the amplifier as one message.
 func (p *proxy) forwardFromAmplifier() error {
-	buf := make([]byte, 8)
+	packets := remote.NewPacketReader(p.amp)
 	for {
-		n, err := p.amp.Read(buf)
+		packet, err := packets.ReadPacket()
 		if err != nil {
 			return handleForwardingError("Error reading from amplifier", err)
 		}
 
-		err = p.ws.Write(p.ctx, websocket.MessageText, buf[:n])
+		p.tracer.received(packet)
+		err = p.ws.Write(p.ctx, websocket.MessageText, packet)
 		if err != nil {
 			return handleForwardingError("Error writing to socket", err)
 		}
@@ -87,7 +105,13 @@ func (p *proxy) forwardFromClient() error {
 			return handleForwardingError("Error getting reader from socket", err)
 		}
 
-		_, err = io.Copy(p.amp, r)
+		message, err := io.ReadAll(r)
+		if err != nil {
+			return handleForwardingError("Error reading from socket", err)
+		}
+
+		p.tracer.sent(message)
+		_, err = p.amp.Write(message)
 		if err != nil {
 			return handleForwardingError("Error writing to amplifier", err)
 		}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Jacalz/hegelmote/remote"
+)
+
+// traceHandler is where packets are logged when running with -trace. Tracing is off when nil.
+var traceHandler slog.Handler
+
+// packetTracer traces the packets passing through one proxy connection.
+// Responses are paired with the last command sent to include the latency.
+type packetTracer struct {
+	trace remote.Tracer
+
+	lock     sync.Mutex
+	command  byte
+	lastSent time.Time
+}
+
+// newPacketTracer returns a tracer for the proxy connection to the amplifier at the address.
+// The packets are always counted for the metrics and also logged when tracing.
+func newPacketTracer(pid uint64, address string) *packetTracer {
+	trace := serverMetrics.tracer(address)
+	if traceHandler != nil {
+		handler := traceHandler.WithAttrs([]slog.Attr{slog.Uint64("id", pid)})
+		trace = combineTracers(remote.SlogTracer(handler), trace)
+	}
+
+	return &packetTracer{trace: trace}
+}
+
+// sent traces a message from the client. It may contain several packets.
+func (t *packetTracer) sent(message []byte) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for packet := range bytes.SplitSeq(bytes.TrimSuffix(message, []byte{'\r'}), []byte{'\r'}) {
+		t.lastSent = time.Now()
+		if len(packet) > 1 {
+			t.command = packet[1]
+		}
+
+		t.trace(remote.TraceEvent{Time: t.lastSent, Direction: remote.TraceSent, Packet: string(packet)})
+	}
+}
+
+// received traces a packet from the amplifier.
+func (t *packetTracer) received(packet []byte) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	event := remote.TraceEvent{
+		Time:      time.Now(),
+		Direction: remote.TraceReceived,
+		Packet:    string(bytes.TrimSuffix(packet, []byte{'\r'})),
+	}
+
+	answered := len(packet) > 1 && (packet[1] == t.command || packet[1] == 'e')
+	if answered && !t.lastSent.IsZero() {
+		event.Latency = event.Time.Sub(t.lastSent)
+		t.lastSent = time.Time{}
+	}
+
+	t.trace(event)
+}
+
+// combineTracers returns a tracer that calls each of the tracers that are not nil.
+func combineTracers(tracers ...remote.Tracer) remote.Tracer {
+	tracers = slices.DeleteFunc(tracers, func(tracer remote.Tracer) bool { return tracer == nil })
+	return func(event remote.TraceEvent) {
+		for _, tracer := range tracers {
+			tracer(event)
+		}
+	}
+}
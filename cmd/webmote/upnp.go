@@ -3,9 +3,12 @@ package main
 import (
 	"context"
 	"log/slog"
+	"net"
 	"net/http"
+	"strconv"
 
 	"github.com/Jacalz/hegelmote/internal/upnp"
+	"github.com/Jacalz/hegelmote/remote"
 	"github.com/coder/websocket"
 	"github.com/coder/websocket/wsjson"
 )
@@ -31,8 +34,13 @@ func doUpnpLookup(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 	defer ws.Close(websocket.StatusNormalClosure, "")
+	defer serverMetrics.clientConnected(false)()
 
 	devices, err := upnp.LookUpDevices()
+	for _, device := range devices {
+		serverMetrics.addAmplifier(net.JoinHostPort(device.Host, strconv.Itoa(remote.DefaultPort)), device.Model, nil)
+	}
+
 	err = wsjson.Write(context.Background(), ws, upnpResponse{devices, err})
 	if err != nil {
 		slog.Error("Failed to write upnp devices:", slog.String("reason", err.Error()))
@@ -59,7 +59,7 @@ func NameFromNumber(device Type, input Input) (string, error) {
 		return "", err
 	}
 
-	if int(input) > len(inputs) {
+	if input == 0 || int(input) > len(inputs) {
 		return "", errInvalidInput
 	}
 
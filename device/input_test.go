@@ -0,0 +1,19 @@
+package device
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestNameFromNumber(t *testing.T) {
+	name, err := NameFromNumber(H95, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, "Coaxial", name)
+
+	_, err = NameFromNumber(H95, 0)
+	assert.IsError(t, err, errInvalidInput)
+
+	_, err = NameFromNumber(H95, 9)
+	assert.IsError(t, err, errInvalidInput)
+}
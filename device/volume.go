@@ -0,0 +1,93 @@
+package device
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+var errInvalidVolume = errors.New("volume must be between 0 and 100")
+
+// attenuationPoint maps a volume to an attenuation in dB relative to full volume.
+type attenuationPoint struct {
+	volume uint8
+	db     float64
+}
+
+// attenuationTable is a piecewise linear mapping from volume to attenuation.
+// The points must be sorted by volume, start at volume 1 and end at volume 100.
+// Volume 0 is always treated as muted.
+type attenuationTable []attenuationPoint
+
+// Hegel does not publish volume curves, so there is no data to base a table
+// per model on. This is one generic approximation used for every model, with
+// finer steps near the top of the range and coarser below. Readings are only
+// a guide and should not be compared to measurements, which is also why the
+// volume is never set from a value in dB.
+var genericAttenuation = attenuationTable{
+	{1, -80}, {20, -50}, {50, -25}, {75, -10}, {100, 0},
+}
+
+func (t attenuationTable) toDB(volume uint8) float64 {
+	if volume == 0 {
+		return math.Inf(-1)
+	}
+
+	for i := 1; i < len(t); i++ {
+		low, high := t[i-1], t[i]
+		if volume <= high.volume {
+			fraction := float64(volume-low.volume) / float64(high.volume-low.volume)
+			return low.db + fraction*(high.db-low.db)
+		}
+	}
+
+	return t[len(t)-1].db
+}
+
+// VolumeToDB returns the approximate attenuation in dB, relative to
+// full volume, for the volume on the given device. The volume is in the
+// range 0 to 100 and zero returns negative infinity. The same generic
+// curve is used for all devices, as Hegel does not publish their curves.
+func VolumeToDB(device Type, volume uint8) (float64, error) {
+	if !IsSupported(device) {
+		return 0, errInvalidDevice
+	} else if volume > 100 {
+		return 0, errInvalidVolume
+	}
+
+	return genericAttenuation.toDB(volume), nil
+}
+
+// VolumeFromDB returns the volume whose attenuation is closest to the given
+// value in dB on the given device. Values above 0 dB return full volume and
+// values below the lowest step, including negative infinity, return zero.
+func VolumeFromDB(device Type, db float64) (uint8, error) {
+	if !IsSupported(device) {
+		return 0, errInvalidDevice
+	} else if math.IsNaN(db) {
+		return 0, errors.New("attenuation is not a number")
+	}
+
+	if db < genericAttenuation.toDB(1) {
+		return 0, nil
+	}
+
+	closest, distance := uint8(1), math.Inf(1)
+	for volume := uint8(1); volume <= 100; volume++ {
+		if d := math.Abs(db - genericAttenuation.toDB(volume)); d < distance {
+			closest, distance = volume, d
+		}
+	}
+
+	return closest, nil
+}
+
+// FormatDB formats the attenuation with one decimal, like "-12.5 dB".
+// Negative infinity is formatted as "-∞ dB".
+func FormatDB(db float64) string {
+	if math.IsInf(db, -1) {
+		return "-∞ dB"
+	}
+
+	return strconv.FormatFloat(db, 'f', 1, 64) + " dB"
+}
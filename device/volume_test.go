@@ -0,0 +1,76 @@
+package device
+
+import (
+	"math"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestVolumeToDB(t *testing.T) {
+	for _, test := range []struct {
+		volume uint8
+		db     float64
+	}{
+		{1, -80},
+		{20, -50},
+		{35, -37.5},
+		{50, -25},
+		{75, -10},
+		{100, 0},
+	} {
+		db, err := VolumeToDB(H95, test.volume)
+		assert.NoError(t, err)
+		assert.Equal(t, test.db, db, "volume %d", test.volume)
+	}
+
+	db, err := VolumeToDB(H95, 0)
+	assert.NoError(t, err)
+	assert.True(t, math.IsInf(db, -1))
+
+	_, err = VolumeToDB(H95, 101)
+	assert.IsError(t, err, errInvalidVolume)
+	_, err = VolumeToDB(Type(-1), 10)
+	assert.IsError(t, err, errInvalidDevice)
+}
+
+func TestVolumeFromDB(t *testing.T) {
+	for _, test := range []struct {
+		db     float64
+		volume uint8
+	}{
+		{0, 100},
+		{3, 100},
+		{-25, 50},
+		{-24.7, 50}, // Values between steps are rounded to the closest volume.
+		{-80, 1},
+		{-80.1, 0},
+		{math.Inf(-1), 0},
+	} {
+		volume, err := VolumeFromDB(H190, test.db)
+		assert.NoError(t, err)
+		assert.Equal(t, test.volume, volume, "%v dB", test.db)
+	}
+
+	_, err := VolumeFromDB(H190, math.NaN())
+	assert.Error(t, err)
+	_, err = VolumeFromDB(Type(-1), -10)
+	assert.IsError(t, err, errInvalidDevice)
+}
+
+func TestVolumeDBRoundTrip(t *testing.T) {
+	for volume := range uint8(101) {
+		db, err := VolumeToDB(H95, volume)
+		assert.NoError(t, err)
+
+		back, err := VolumeFromDB(H95, db)
+		assert.NoError(t, err)
+		assert.Equal(t, volume, back)
+	}
+}
+
+func TestFormatDB(t *testing.T) {
+	assert.Equal(t, "-∞ dB", FormatDB(math.Inf(-1)))
+	assert.Equal(t, "-12.5 dB", FormatDB(-12.5))
+	assert.Equal(t, "0.0 dB", FormatDB(0))
+}
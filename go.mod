@@ -9,6 +9,7 @@ require (
 	github.com/rymdport/easypgo v0.2.1
 	github.com/supersonic-app/go-upnpcast v0.0.0-20250610011303-aabd238ca576
 	golang.org/x/sync v0.17.0
+	golang.org/x/term v0.35.0
 )
 
 require (
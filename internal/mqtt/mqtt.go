@@ -0,0 +1,416 @@
+// Package mqtt implements the small part of MQTT 3.1.1 needed for bridging an amplifier to a broker.
+// Messages are only sent and received at QoS 0, which is enough for retained state and commands.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Packet types, shifted into the upper four bits of the first byte.
+const (
+	typeConnect    = 1 << 4
+	typeConnack    = 2 << 4
+	typePublish    = 3 << 4
+	typePuback     = 4 << 4
+	typeSubscribe  = 8 << 4
+	typeSuback     = 9 << 4
+	typePingreq    = 12 << 4
+	typeDisconnect = 14 << 4
+)
+
+const defaultKeepAlive = 30 * time.Second
+
+// maxRemainingLength is the largest length that can be encoded in a packet header.
+const maxRemainingLength = 268_435_455
+
+var (
+	errClosed              = errors.New("connection to the broker is closed")
+	errPasswordWithoutUser = errors.New("a password can only be given together with a user name")
+)
+
+// Message is a message published to a topic.
+type Message struct {
+	Topic   string
+	Payload []byte
+
+	// Retain makes the broker keep the message and send it to clients that subscribe later.
+	Retain bool
+}
+
+// Config configures the connection to the broker.
+type Config struct {
+	ClientID string
+	Username string
+	Password string // Only allowed together with a username, as of MQTT 3.1.1.
+
+	// KeepAlive is the longest time between packets before the broker drops the client. Defaults to 30 seconds.
+	KeepAlive time.Duration
+
+	// Will, if set, is published by the broker when the client disconnects without calling [Client.Close].
+	Will *Message
+}
+
+// Client is a connection to an MQTT broker.
+// This data type is thread safe.
+type Client struct {
+	conn      net.Conn
+	keepAlive time.Duration
+
+	writeLock sync.Mutex
+	packetID  uint16
+
+	subscribeLock sync.Mutex
+	subacks       chan []byte
+
+	messages chan Message
+	done     chan struct{}
+	err      error
+
+	// closing is closed by [Client.Close], to stop waiting on messages that are no longer read.
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+// Dial connects to the broker at the address, given as host:port, and waits for it to accept the client.
+func Dial(ctx context.Context, address string, config Config) (*Client, error) {
+	if config.Password != "" && config.Username == "" {
+		return nil, errPasswordWithoutUser
+	}
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		conn:      conn,
+		keepAlive: config.KeepAlive,
+		subacks:   make(chan []byte, 1),
+		messages:  make(chan Message, 16),
+		done:      make(chan struct{}),
+		closing:   make(chan struct{}),
+	}
+	if c.keepAlive <= 0 {
+		c.keepAlive = defaultKeepAlive
+	}
+
+	reader := bufio.NewReader(conn)
+	err = c.handshake(ctx, reader, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	go c.readLoop(reader)
+	go c.pingLoop()
+	return c, nil
+}
+
+func (c *Client) handshake(ctx context.Context, reader *bufio.Reader, config Config) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = c.conn.SetDeadline(deadline)
+		defer c.conn.SetDeadline(time.Time{})
+	}
+
+	err := c.writePacket(typeConnect, connectBody(config, c.keepAlive))
+	if err != nil {
+		return err
+	}
+
+	header, body, err := readPacket(reader)
+	if err != nil {
+		return err
+	} else if header&0xf0 != typeConnack || len(body) != 2 {
+		return fmt.Errorf("expected a connack packet, got type %d", header>>4)
+	}
+
+	return connackError(body[1])
+}
+
+func connectBody(config Config, keepAlive time.Duration) []byte {
+	flags := byte(0x02) // Clean session.
+	payload := appendString(nil, config.ClientID)
+	if will := config.Will; will != nil {
+		flags |= 0x04
+		if will.Retain {
+			flags |= 0x20
+		}
+		payload = appendString(payload, will.Topic)
+		payload = appendBytes(payload, will.Payload)
+	}
+	if config.Username != "" {
+		flags |= 0x80
+		payload = appendString(payload, config.Username)
+	}
+	if config.Password != "" {
+		flags |= 0x40
+		payload = appendString(payload, config.Password)
+	}
+
+	// Protocol level 4 is MQTT 3.1.1.
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(min(keepAlive/time.Second, 0xffff))) // #nosec G115 -- Clamped above.
+	return append(body, payload...)
+}
+
+func connackError(code byte) error {
+	switch code {
+	case 0:
+		return nil
+	case 1:
+		return errors.New("broker refused the connection: unacceptable protocol version")
+	case 2:
+		return errors.New("broker refused the connection: client identifier rejected")
+	case 3:
+		return errors.New("broker refused the connection: server unavailable")
+	case 4:
+		return errors.New("broker refused the connection: bad user name or password")
+	case 5:
+		return errors.New("broker refused the connection: not authorized")
+	}
+
+	return fmt.Errorf("broker refused the connection: unexpected return code %d", code)
+}
+
+// Publish sends a message at QoS 0.
+func (c *Client) Publish(message Message) error {
+	header := byte(typePublish)
+	if message.Retain {
+		header |= 0x01
+	}
+
+	body := appendString(nil, message.Topic)
+	return c.writePacket(header, append(body, message.Payload...))
+}
+
+// Subscribe subscribes to the topic filters at QoS 0 and waits for the broker to accept them.
+// Received messages are delivered on [Client.Messages].
+func (c *Client) Subscribe(ctx context.Context, filters ...string) error {
+	c.subscribeLock.Lock()
+	defer c.subscribeLock.Unlock()
+
+	c.writeLock.Lock()
+	c.packetID++
+	if c.packetID == 0 {
+		c.packetID = 1 // Zero is not a valid packet identifier.
+	}
+	id := c.packetID
+	c.writeLock.Unlock()
+
+	body := binary.BigEndian.AppendUint16(nil, id)
+	for _, filter := range filters {
+		body = appendString(body, filter)
+		body = append(body, 0)
+	}
+
+	err := c.writePacket(typeSubscribe|0x02, body)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case suback := <-c.subacks:
+		if len(suback) < 2 || binary.BigEndian.Uint16(suback) != id {
+			return errors.New("unexpected suback from broker")
+		}
+		for i, code := range suback[2:] {
+			if code == 0x80 && i < len(filters) {
+				return fmt.Errorf("broker refused the subscription to %q", filters[i])
+			}
+		}
+		return nil
+	case <-c.done:
+		return c.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Messages returns the channel that messages for subscribed topics are delivered on.
+// It is closed when the connection is closed.
+func (c *Client) Messages() <-chan Message {
+	return c.messages
+}
+
+// Done returns a channel that is closed when the connection is closed.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the reason that the connection was closed, once [Client.Done] is closed.
+func (c *Client) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// Close disconnects cleanly, which keeps the broker from publishing the will message.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() { close(c.closing) })
+	err := c.writePacket(typeDisconnect, nil)
+	return errors.Join(err, c.conn.Close())
+}
+
+func (c *Client) readLoop(reader *bufio.Reader) {
+	defer close(c.messages)
+	defer close(c.done)
+
+	for {
+		// The broker answers pings, so something should arrive within the keep alive.
+		_ = c.conn.SetReadDeadline(time.Now().Add(c.keepAlive * 3 / 2))
+
+		header, body, err := readPacket(reader)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				err = errClosed
+			}
+			c.err = err
+			c.conn.Close()
+			return
+		}
+
+		c.handlePacket(header, body)
+	}
+}
+
+func (c *Client) handlePacket(header byte, body []byte) {
+	switch header & 0xf0 {
+	case typePublish:
+		message, id, ok := parsePublish(header, body)
+		if !ok {
+			return
+		}
+		if id != 0 {
+			_ = c.writePacket(typePuback, binary.BigEndian.AppendUint16(nil, id))
+		}
+		// Messages are waited on, and not dropped, until the client is closed.
+		select {
+		case c.messages <- message:
+		case <-c.closing:
+		}
+	case typeSuback:
+		select {
+		case c.subacks <- body:
+		default:
+		}
+	}
+}
+
+// parsePublish returns the message and, for QoS 1 and up, the packet identifier to acknowledge.
+func parsePublish(header byte, body []byte) (Message, uint16, bool) {
+	if len(body) < 2 {
+		return Message{}, 0, false
+	}
+
+	length := int(binary.BigEndian.Uint16(body))
+	if len(body) < 2+length {
+		return Message{}, 0, false
+	}
+	message := Message{Topic: string(body[2 : 2+length]), Retain: header&0x01 != 0}
+	rest := body[2+length:]
+
+	id := uint16(0)
+	if header&0x06 != 0 {
+		if len(rest) < 2 {
+			return Message{}, 0, false
+		}
+		id, rest = binary.BigEndian.Uint16(rest), rest[2:]
+	}
+
+	message.Payload = rest
+	return message, id, true
+}
+
+func (c *Client) pingLoop() {
+	ticker := time.NewTicker(c.keepAlive / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if c.writePacket(typePingreq, nil) != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) writePacket(header byte, body []byte) error {
+	if len(body) > maxRemainingLength {
+		return errors.New("packet is too large")
+	}
+
+	packet := append([]byte{header}, appendRemainingLength(nil, len(body))...)
+	packet = append(packet, body...)
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	_ = c.conn.SetWriteDeadline(time.Now().Add(c.keepAlive))
+	_, err := c.conn.Write(packet)
+	return err
+}
+
+func readPacket(reader *bufio.Reader) (byte, []byte, error) {
+	header, err := reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		digit, err := reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		} else if i == 3 && digit&0x80 != 0 {
+			return 0, nil, errors.New("malformed remaining length")
+		}
+
+		length += int(digit&0x7f) * multiplier
+		multiplier *= 128
+		if digit&0x80 == 0 {
+			break
+		}
+	}
+
+	body := make([]byte, length)
+	_, err = io.ReadFull(reader, body)
+	return header, body, err
+}
+
+func appendRemainingLength(buf []byte, length int) []byte {
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		buf = append(buf, digit)
+		if length == 0 {
+			return buf
+		}
+	}
+}
+
+func appendString(buf []byte, s string) []byte {
+	return appendBytes(buf, []byte(s))
+}
+
+func appendBytes(buf, data []byte) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(data))) // #nosec G115 -- Topics and payloads in the header are short.
+	return append(buf, data...)
+}
@@ -0,0 +1,354 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestRemainingLength(t *testing.T) {
+	for _, test := range []struct {
+		length  int
+		encoded []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{16_383, []byte{0xff, 0x7f}},
+		{16_384, []byte{0x80, 0x80, 0x01}},
+		{2_097_151, []byte{0xff, 0xff, 0x7f}},
+		{maxRemainingLength, []byte{0xff, 0xff, 0xff, 0x7f}},
+	} {
+		encoded := appendRemainingLength(nil, test.length)
+		assert.Equal(t, test.encoded, encoded)
+
+		// Reading it back needs a body of that length, so the largest one is left out.
+		if test.length == maxRemainingLength {
+			continue
+		}
+
+		packet := append([]byte{typePublish}, encoded...)
+		packet = append(packet, make([]byte, test.length)...)
+		header, body, err := readPacket(bufio.NewReader(bytes.NewReader(packet)))
+		assert.NoError(t, err)
+		assert.Equal(t, typePublish, header)
+		assert.Equal(t, test.length, len(body))
+	}
+}
+
+func TestReadPacket(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		packet []byte
+		header byte
+		body   []byte
+		err    string
+	}{
+		{"empty body", []byte{typePingreq, 0x00}, typePingreq, []byte{}, ""},
+		{"with body", []byte{typeConnack, 0x02, 0x00, 0x05}, typeConnack, []byte{0x00, 0x05}, ""},
+		{"no packet", []byte{}, 0, nil, io.EOF.Error()},
+		{"no length", []byte{typeConnack}, 0, nil, io.EOF.Error()},
+		{"too long length", []byte{typePublish, 0x80, 0x80, 0x80, 0x80, 0x01}, 0, nil, "malformed remaining length"},
+		{"short body", []byte{typeConnack, 0x02, 0x00}, typeConnack, nil, io.ErrUnexpectedEOF.Error()},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			header, body, err := readPacket(bufio.NewReader(bytes.NewReader(test.packet)))
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.header, header)
+			assert.Equal(t, test.body, body)
+		})
+	}
+}
+
+func TestParsePublish(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		header  byte
+		body    []byte
+		message Message
+		id      uint16
+		ok      bool
+	}{
+		{"qos 0", typePublish, []byte("\x00\x03a/bON"), Message{Topic: "a/b", Payload: []byte("ON")}, 0, true},
+		{"retained", typePublish | 0x01, []byte("\x00\x01a20"), Message{Topic: "a", Payload: []byte("20"), Retain: true}, 0, true},
+		{"empty payload", typePublish, []byte("\x00\x01a"), Message{Topic: "a", Payload: []byte{}}, 0, true},
+		{"qos 1", typePublish | 0x02, []byte("\x00\x01a\x01\x02ON"), Message{Topic: "a", Payload: []byte("ON")}, 0x0102, true},
+		{"no topic length", typePublish, []byte{0x00}, Message{}, 0, false},
+		{"short topic", typePublish, []byte("\x00\x05a"), Message{}, 0, false},
+		{"qos 1 without id", typePublish | 0x02, []byte("\x00\x01a\x01"), Message{}, 0, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			message, id, ok := parsePublish(test.header, test.body)
+			assert.Equal(t, test.ok, ok)
+			assert.Equal(t, test.message, message)
+			assert.Equal(t, test.id, id)
+		})
+	}
+}
+
+func TestConnectBody(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		config    Config
+		keepAlive time.Duration
+		body      []byte
+	}{
+		{
+			name:      "client id only",
+			config:    Config{ClientID: "id"},
+			keepAlive: defaultKeepAlive,
+			body:      []byte("\x00\x04MQTT\x04\x02\x00\x1e\x00\x02id"),
+		},
+		{
+			name: "will and credentials",
+			config: Config{
+				ClientID: "id",
+				Username: "u",
+				Password: "p",
+				Will:     &Message{Topic: "t", Payload: []byte("x"), Retain: true},
+			},
+			keepAlive: 100 * time.Hour,
+			body:      []byte("\x00\x04MQTT\x04\xe6\xff\xff\x00\x02id\x00\x01t\x00\x01x\x00\x01u\x00\x01p"),
+		},
+		{
+			name:      "will without retain",
+			config:    Config{ClientID: "id", Will: &Message{Topic: "t", Payload: []byte("x")}},
+			keepAlive: time.Minute,
+			body:      []byte("\x00\x04MQTT\x04\x06\x00\x3c\x00\x02id\x00\x01t\x00\x01x"),
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.body, connectBody(test.config, test.keepAlive))
+		})
+	}
+}
+
+// fakeBroker accepts a single client and lets the test play the part of the broker.
+type fakeBroker struct {
+	t        *testing.T
+	listener net.Listener
+	conn     net.Conn
+	reader   *bufio.Reader
+}
+
+func newFakeBroker(t *testing.T) *fakeBroker {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	return &fakeBroker{t: t, listener: listener}
+}
+
+func (b *fakeBroker) accept() {
+	b.t.Helper()
+
+	conn, err := b.listener.Accept()
+	assert.NoError(b.t, err)
+	b.t.Cleanup(func() { conn.Close() })
+	assert.NoError(b.t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+	b.conn, b.reader = conn, bufio.NewReader(conn)
+}
+
+// expect reads the next packet and checks that it has the given type.
+func (b *fakeBroker) expect(packetType byte) (byte, []byte) {
+	b.t.Helper()
+
+	header, body, err := readPacket(b.reader)
+	assert.NoError(b.t, err)
+	assert.Equal(b.t, packetType, header&0xf0)
+	return header, body
+}
+
+func (b *fakeBroker) send(header byte, body []byte) {
+	b.t.Helper()
+
+	packet := append([]byte{header}, appendRemainingLength(nil, len(body))...)
+	_, err := b.conn.Write(append(packet, body...))
+	assert.NoError(b.t, err)
+}
+
+type dialed struct {
+	client *Client
+	err    error
+}
+
+// dialFakeBroker connects a client to the broker, which accepts it.
+func dialFakeBroker(t *testing.T, broker *fakeBroker) *Client {
+	t.Helper()
+
+	result := make(chan dialed, 1)
+	go func() {
+		client, err := Dial(context.Background(), broker.listener.Addr().String(), Config{ClientID: "hegelmote"})
+		result <- dialed{client, err}
+	}()
+
+	broker.accept()
+	broker.expect(typeConnect)
+	broker.send(typeConnack, []byte{0x00, 0x00})
+
+	got := <-result
+	assert.NoError(t, got.err)
+	return got.client
+}
+
+func TestClientLoopback(t *testing.T) {
+	broker := newFakeBroker(t)
+
+	config := Config{
+		ClientID:  "hegelmote",
+		KeepAlive: time.Minute,
+		Will:      &Message{Topic: "amp/availability", Payload: []byte("offline"), Retain: true},
+	}
+	result := make(chan dialed, 1)
+	go func() {
+		client, err := Dial(context.Background(), broker.listener.Addr().String(), config)
+		result <- dialed{client, err}
+	}()
+
+	broker.accept()
+	_, body := broker.expect(typeConnect)
+	assert.Equal(t, connectBody(config, config.KeepAlive), body)
+	broker.send(typeConnack, []byte{0x00, 0x00})
+
+	got := <-result
+	assert.NoError(t, got.err)
+	client := got.client
+
+	subscribed := make(chan error, 1)
+	go func() { subscribed <- client.Subscribe(context.Background(), "amp/+/set") }()
+
+	header, body := broker.expect(typeSubscribe)
+	assert.Equal(t, typeSubscribe|0x02, header)
+	assert.Equal(t, []byte("\x00\x01\x00\x09amp/+/set\x00"), body)
+	broker.send(typeSuback, []byte{0x00, 0x01, 0x00})
+	assert.NoError(t, <-subscribed)
+
+	// Messages at QoS 1 are acknowledged, even though only QoS 0 is asked for.
+	broker.send(typePublish|0x02, []byte("\x00\x0eamp/volume/set\x00\x0720"))
+	_, body = broker.expect(typePuback)
+	assert.Equal(t, []byte{0x00, 0x07}, body)
+
+	select {
+	case message := <-client.Messages():
+		assert.Equal(t, Message{Topic: "amp/volume/set", Payload: []byte("20")}, message)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+
+	assert.NoError(t, client.Publish(Message{Topic: "amp/volume", Payload: []byte("20"), Retain: true}))
+	header, body = broker.expect(typePublish)
+	assert.Equal(t, typePublish|0x01, header)
+	assert.Equal(t, []byte("\x00\x0aamp/volume20"), body)
+
+	assert.NoError(t, client.Close())
+	broker.expect(typeDisconnect)
+
+	select {
+	case <-client.Done():
+		assert.IsError(t, client.Err(), errClosed)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the connection to close")
+	}
+}
+
+func TestClientRefused(t *testing.T) {
+	broker := newFakeBroker(t)
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := Dial(context.Background(), broker.listener.Addr().String(), Config{ClientID: "hegelmote"})
+		result <- err
+	}()
+
+	broker.accept()
+	broker.expect(typeConnect)
+	broker.send(typeConnack, []byte{0x00, 0x05})
+	assert.EqualError(t, <-result, "broker refused the connection: not authorized")
+}
+
+func TestClientSubscriptionRefused(t *testing.T) {
+	broker := newFakeBroker(t)
+
+	client := dialFakeBroker(t, broker)
+	defer client.Close()
+
+	subscribed := make(chan error, 1)
+	go func() { subscribed <- client.Subscribe(context.Background(), "allowed", "denied") }()
+
+	broker.expect(typeSubscribe)
+	broker.send(typeSuback, []byte{0x00, 0x01, 0x00, 0x80})
+	assert.EqualError(t, <-subscribed, `broker refused the subscription to "denied"`)
+}
+
+func TestClientPasswordWithoutUsername(t *testing.T) {
+	broker := newFakeBroker(t)
+
+	_, err := Dial(context.Background(), broker.listener.Addr().String(), Config{ClientID: "hegelmote", Password: "secret"})
+	assert.IsError(t, err, errPasswordWithoutUser)
+}
+
+func TestClientCloseWithUnreadMessages(t *testing.T) {
+	broker := newFakeBroker(t)
+	client := dialFakeBroker(t, broker)
+
+	// More messages than fit in the channel, which nobody reads.
+	for range cap(client.messages) + 4 {
+		broker.send(typePublish, []byte("\x00\x0eamp/volume/set20"))
+	}
+
+	// Wait for the client to fill the channel before closing it.
+	deadline := time.Now().Add(time.Second)
+	for len(client.messages) < cap(client.messages) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.NoError(t, client.Close())
+
+	select {
+	case <-client.Done():
+		assert.IsError(t, client.Err(), errClosed)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the connection to close")
+	}
+}
+
+// TestMosquitto runs against a real broker, like a local mosquitto, given as
+// host:port in HEGELMOTE_TEST_BROKER. It is skipped when that is not set.
+func TestMosquitto(t *testing.T) {
+	address := os.Getenv("HEGELMOTE_TEST_BROKER")
+	if address == "" {
+		t.Skip("HEGELMOTE_TEST_BROKER is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	id := strconv.FormatInt(time.Now().UnixNano(), 36)
+	client, err := Dial(ctx, address, Config{ClientID: "hegelmote-test-" + id})
+	assert.NoError(t, err)
+	defer client.Close()
+
+	topic := "hegelmote-test/" + id
+	assert.NoError(t, client.Subscribe(ctx, topic))
+	assert.NoError(t, client.Publish(Message{Topic: topic, Payload: []byte("ON")}))
+
+	select {
+	case message := <-client.Messages():
+		assert.Equal(t, Message{Topic: topic, Payload: []byte("ON")}, message)
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for message")
+	}
+}
@@ -1,6 +1,7 @@
 package ui
 
 import (
+	"context"
 	"fmt"
 	"image/color"
 	"net/netip"
@@ -16,7 +17,7 @@ import (
 )
 
 func (m *mainUI) connect(host string, model device.Type) error {
-	err := m.amplifier.Connect(host, model)
+	err := m.amplifier.ConnectWithConfig(context.Background(), host, model, m.connectConfig)
 	if err != nil {
 		return err
 	}
@@ -26,26 +27,22 @@ func (m *mainUI) connect(host string, model device.Type) error {
 		return err
 	}
 
-	err = m.load()
-	if err != nil {
-		return err
+	if fyne.CurrentApp().Preferences().Bool(volumeMemoryKey) {
+		m.setVolumeMemory(true)
 	}
 
+	m.load()
 	m.inputSelector.Options = inputs
 	m.host = host
-	m.connectionLabel.SetText("Connected")
-	m.powerToggle.Enable()
 	m.fullRefresh()
 	return nil
 }
 
 func (m *mainUI) Disconnect() {
-	m.powerToggle.Disable()
 	err := m.amplifier.Disconnect()
 	if err != nil {
 		fyne.LogError("Error on disconnecting", err)
 	}
-	m.connectionLabel.SetText("Disconnected")
 }
 
 func (m *mainUI) setUpConnection() {
@@ -234,9 +231,12 @@ func (m *mainUI) onConnectionInfo() {
 		forget.Disable()
 	}
 
+	volumeMemory := &widget.Check{Text: "Remember volume for each input", Checked: prefs.Bool(volumeMemoryKey), OnChanged: m.setVolumeMemory}
+	volumeInDB := &widget.Check{Text: "Show volume in dB", Checked: m.volumeInDB, OnChanged: m.setVolumeInDB}
+
 	prop := &canvas.Rectangle{}
 	prop.SetMinSize(fyne.NewSquareSize(theme.Padding()))
 
-	infoDialog = dialog.NewCustom("Connection info", "Dismiss", container.NewVBox(info, container.NewGridWithRows(1, disconnect, forget), prop), m.window)
+	infoDialog = dialog.NewCustom("Connection info", "Dismiss", container.NewVBox(info, volumeMemory, volumeInDB, container.NewGridWithRows(1, disconnect, forget), prop), m.window)
 	infoDialog.Show()
 }
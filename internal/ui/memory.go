@@ -0,0 +1,60 @@
+package ui
+
+import (
+	"fyne.io/fyne/v2"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/Jacalz/hegelmote/remote"
+)
+
+const volumeMemoryKey = "volumeMemory"
+
+// preferencesVolumeStore stores the volume for each input in the app preferences.
+// Each model is stored separately, indexed by input and with -1 meaning no volume.
+type preferencesVolumeStore struct {
+	prefs fyne.Preferences
+	key   string
+}
+
+func newPreferencesVolumeStore(prefs fyne.Preferences, model device.Type) *preferencesVolumeStore {
+	return &preferencesVolumeStore{prefs: prefs, key: "inputVolumes" + model.String()}
+}
+
+func (p *preferencesVolumeStore) LoadVolumes() (map[device.Input]remote.Volume, error) {
+	volumes := map[device.Input]remote.Volume{}
+	for i, volume := range p.prefs.IntList(p.key) {
+		if volume >= 0 && volume <= 100 {
+			volumes[device.Input(i+1)] = remote.Volume(volume) // #nosec G115 -- Checked above.
+		}
+	}
+
+	return volumes, nil
+}
+
+func (p *preferencesVolumeStore) SaveVolumes(volumes map[device.Input]remote.Volume) error {
+	list := []int{}
+	for input, volume := range volumes {
+		for len(list) < int(input) {
+			list = append(list, -1)
+		}
+		list[input-1] = int(volume)
+	}
+
+	p.prefs.SetIntList(p.key, list)
+	return nil
+}
+
+func (m *mainUI) setVolumeMemory(enabled bool) {
+	prefs := fyne.CurrentApp().Preferences()
+	prefs.SetBool(volumeMemoryKey, enabled)
+	if !enabled {
+		m.amplifier.DisableVolumeMemory()
+		return
+	}
+
+	store := newPreferencesVolumeStore(prefs, m.amplifier.GetDeviceType())
+	err := m.amplifier.EnableVolumeMemory(store)
+	if err != nil {
+		fyne.LogError("Failed to load volume for each input", err)
+	}
+}
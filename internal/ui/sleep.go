@@ -0,0 +1,121 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/Jacalz/hegelmote/remote"
+)
+
+const sleepFadeDuration = 5 * time.Minute
+
+var sleepDurations = []time.Duration{
+	15 * time.Minute, 30 * time.Minute, 45 * time.Minute,
+	time.Hour, 90 * time.Minute, 2 * time.Hour,
+}
+
+func (m *mainUI) onSleepTimer() {
+	if m.sleepTimer != nil {
+		m.showActiveSleepTimer()
+		return
+	}
+
+	options := make([]string, 0, len(sleepDurations))
+	for _, duration := range sleepDurations {
+		options = append(options, formatSleepDuration(duration))
+	}
+
+	durations := &widget.Select{Options: options}
+	durations.SetSelectedIndex(1)
+	fade := &widget.Check{Text: "Fade out during the last five minutes", Checked: true}
+
+	content := container.NewVBox(durations, fade)
+	dialog.ShowCustomConfirm("Sleep timer", "Start", "Cancel", content, func(start bool) {
+		if !start {
+			return
+		}
+
+		config := remote.SleepTimerConfig{Duration: sleepDurations[durations.SelectedIndex()]}
+		if fade.Checked {
+			config.FadeDuration = sleepFadeDuration
+		}
+		m.startSleepTimer(config)
+	}, m.window)
+}
+
+func (m *mainUI) showActiveSleepTimer() {
+	timer := m.sleepTimer
+	msg := fmt.Sprintf("The amplifier turns off at %s.", timer.Deadline().Format(time.Kitchen))
+	dialog.ShowConfirm("Sleep timer", msg+"\nDo you want to cancel the sleep timer?", func(cancel bool) {
+		if cancel {
+			timer.Cancel()
+		}
+	}, m.window)
+}
+
+func (m *mainUI) startSleepTimer(config remote.SleepTimerConfig) {
+	config.OnDone = func(err error) {
+		fyne.Do(func() {
+			m.sleepTimer = nil
+			m.sleepButton.SetText("")
+			setEnabled(m.sleepButton, m.amplifier.GetConnectionState() == remote.Connected)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				fyne.LogError("Sleep timer failed", err)
+				dialog.ShowError(err, m.window)
+			}
+		})
+	}
+
+	timer, err := m.amplifier.StartSleepTimer(config)
+	if err != nil {
+		dialog.ShowError(err, m.window)
+		return
+	}
+
+	m.sleepTimer = timer
+	m.sleepButton.SetText(formatRemaining(timer.Remaining()))
+
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				fyne.Do(func() {
+					if m.sleepTimer == timer {
+						m.sleepButton.SetText(formatRemaining(timer.Remaining()))
+					}
+				})
+			case <-timer.Done():
+				return
+			}
+		}
+	}()
+}
+
+func formatSleepDuration(duration time.Duration) string {
+	if duration < time.Hour {
+		return fmt.Sprintf("%d minutes", int(duration.Minutes()))
+	} else if duration == time.Hour {
+		return "1 hour"
+	}
+
+	return fmt.Sprintf("%g hours", duration.Hours())
+}
+
+func formatRemaining(remaining time.Duration) string {
+	seconds := int((remaining + time.Second - 1) / time.Second)
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+
+	return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+}
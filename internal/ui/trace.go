@@ -0,0 +1,24 @@
+package ui
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+
+	"github.com/Jacalz/hegelmote/remote"
+)
+
+// traceEnv is the environment variable that turns on logging of every packet
+// exchanged with the amplifier, like HEGELMOTE_TRACE=1.
+const traceEnv = "HEGELMOTE_TRACE"
+
+// setUpTracing logs packets to stderr when tracing is turned on through the environment.
+func (m *mainUI) setUpTracing() {
+	trace, _ := strconv.ParseBool(os.Getenv(traceEnv))
+	if !trace {
+		return
+	}
+
+	handler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})
+	m.amplifier.SetTracer(remote.SlogTracer(handler))
+}
@@ -0,0 +1,49 @@
+package ui
+
+import (
+	"os"
+
+	"fyne.io/fyne/v2"
+
+	"github.com/Jacalz/hegelmote/remote"
+)
+
+const (
+	// recordEnv is the environment variable with a file to record a transcript of the connection to.
+	recordEnv = "HEGELMOTE_RECORD"
+
+	// replayEnv is the environment variable with a transcript to connect to instead of an amplifier.
+	replayEnv = "HEGELMOTE_REPLAY"
+)
+
+// setUpTranscript records or replays the connection when asked to through the environment.
+func (m *mainUI) setUpTranscript() {
+	if path := os.Getenv(replayEnv); path != "" {
+		file, err := os.Open(path) // #nosec G304 -- The path is chosen by the user.
+		if err != nil {
+			fyne.LogError("Failed to open transcript", err)
+			return
+		}
+		defer file.Close()
+
+		replay, err := remote.NewReplay(file)
+		if err != nil {
+			fyne.LogError("Failed to read transcript", err)
+			return
+		}
+
+		m.connectConfig.Dial = replay.Dial
+		return
+	}
+
+	if path := os.Getenv(recordEnv); path != "" {
+		// The file is left open for as long as the application runs.
+		file, err := os.Create(path) // #nosec G304 -- The path is chosen by the user.
+		if err != nil {
+			fyne.LogError("Failed to create transcript", err)
+			return
+		}
+
+		m.connectConfig.Dial = remote.NewRecorder(file).WrapDial(nil)
+	}
+}
@@ -17,10 +17,16 @@ import (
 	"github.com/Jacalz/hegelmote/remote"
 )
 
+const volumeInDBKey = "volumeInDB"
+
 type mainUI struct {
-	amplifier *remote.ControlWithListener
-	host      string
-	window    fyne.Window
+	amplifier     *remote.ControlWithListener
+	connectConfig remote.ConnectConfig
+	host          string
+	window        fyne.Window
+
+	sleepTimer *remote.SleepTimer
+	volumeInDB bool
 
 	poweredOn bool
 	volume    remote.Volume
@@ -28,7 +34,7 @@ type mainUI struct {
 	input     device.Input
 
 	// Widgets:
-	powerToggle                      *widget.Button
+	powerToggle, sleepButton         *widget.Button
 	volumeLabel, volumeDisplay       *widget.Label
 	volumeSlider                     *widget.Slider
 	volumeMute, volumeDown, volumeUp *widget.Button
@@ -104,7 +110,24 @@ func (m *mainUI) onPowerToggle() {
 }
 
 func (m *mainUI) onVolumeDrag(percentage float64) {
-	m.volumeDisplay.SetText(strconv.FormatUint(uint64(percentage), 10))
+	m.volumeDisplay.SetText(m.formatVolume(remote.Volume(percentage)))
+}
+
+func (m *mainUI) formatVolume(volume remote.Volume) string {
+	if m.volumeInDB {
+		db, err := device.VolumeToDB(m.amplifier.GetDeviceType(), volume)
+		if err == nil {
+			return device.FormatDB(db)
+		}
+	}
+
+	return strconv.FormatUint(uint64(volume), 10)
+}
+
+func (m *mainUI) setVolumeInDB(enabled bool) {
+	fyne.CurrentApp().Preferences().SetBool(volumeInDBKey, enabled)
+	m.volumeInDB = enabled
+	m.volumeDisplay.SetText(m.formatVolume(remote.Volume(m.volumeSlider.Value)))
 }
 
 func (m *mainUI) onVolumeDragEnd(percentage float64) {
@@ -172,55 +195,45 @@ func (m *mainUI) onInputChanged(input device.Input) {
 	m.refreshInput()
 }
 
+func (m *mainUI) onConnectionState(state remote.ConnectionState) {
+	fyne.Do(func() {
+		m.connectionLabel.SetText(state.String())
+		setEnabled(m.powerToggle, state == remote.Connected)
+		setEnabled(m.sleepButton, state == remote.Connected || m.sleepTimer != nil)
+	})
+}
+
 func (m *mainUI) onError(err error) {
 	fyne.LogError("Received error from state tracker", err)
 	dialog.ShowError(err, m.window)
 }
 
-func (m *mainUI) load() error {
-	on, err := m.amplifier.GetPower()
-	if err != nil {
-		return err
-	}
-
-	m.poweredOn = on
-
-	volume, err := m.amplifier.GetVolume()
-	if err != nil {
-		return err
-	}
-
-	m.volume = volume
-
-	muted, err := m.amplifier.GetVolumeMute()
-	if err != nil {
-		return err
-	}
-
-	m.muted = muted
-
-	input, err := m.amplifier.GetInput()
-	if err != nil {
-		return err
-	}
-
-	m.input = input
-	return nil
+func (m *mainUI) load() {
+	state := m.amplifier.Snapshot()
+	m.poweredOn = state.Power
+	m.volume = state.Volume
+	m.muted = state.Mute
+	m.input = state.Input
 }
 
 // Build sets up and builds the main user interface.
 func Build(a fyne.App, w fyne.Window) (*mainUI, fyne.CanvasObject) {
-	ui := &mainUI{window: w}
+	ui := &mainUI{window: w, volumeInDB: a.Preferences().Bool(volumeInDBKey)}
 	ui.amplifier = remote.NewControlWithListener(
 		ui.onPowerChanged,
 		ui.onVolumeChanged,
 		ui.onMuteChanged,
 		ui.onInputChanged,
-		ui.Disconnect,
+		func() {},
 		ui.onError,
 	)
+	ui.amplifier.OnConnectionState = ui.onConnectionState
+	ui.amplifier.Reconnect = &remote.ReconnectPolicy{Jitter: 0.2}
+	ui.setUpTracing()
+	ui.setUpTranscript()
 
 	ui.powerToggle = &widget.Button{Icon: img.PowerIcon, Text: "Toggle power", OnTapped: ui.onPowerToggle}
+	ui.sleepButton = &widget.Button{Icon: theme.HistoryIcon(), OnTapped: ui.onSleepTimer}
 
 	ui.volumeLabel = &widget.Label{Text: "Change volume:", TextStyle: fyne.TextStyle{Bold: true}}
 	ui.volumeDisplay = &widget.Label{Text: "0", Alignment: fyne.TextAlignCenter}
@@ -238,7 +251,7 @@ func Build(a fyne.App, w fyne.Window) (*mainUI, fyne.CanvasObject) {
 	ui.setUpConnection()
 
 	return ui, container.NewVBox(
-		ui.powerToggle,
+		container.NewBorder(nil, nil, nil, ui.sleepButton, ui.powerToggle),
 		widget.NewSeparator(),
 		ui.volumeLabel,
 		newVolumeContainer(ui.volumeSlider, ui.volumeDisplay),
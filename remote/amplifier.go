@@ -0,0 +1,30 @@
+package remote
+
+import (
+	"context"
+
+	"github.com/Jacalz/hegelmote/device"
+)
+
+// Amplifier is the set of commands shared by [Control] and [ControlWithListener].
+// It allows building functionality that works the same with either of them.
+type Amplifier interface {
+	GetDeviceType() device.Type
+
+	SetPowerContext(ctx context.Context, on bool) (bool, error)
+	GetPowerContext(ctx context.Context) (bool, error)
+
+	SetVolumeContext(ctx context.Context, volume Volume) (Volume, error)
+	GetVolumeContext(ctx context.Context) (Volume, error)
+
+	SetVolumeMuteContext(ctx context.Context, mute bool) (bool, error)
+	GetVolumeMuteContext(ctx context.Context) (bool, error)
+
+	SetInputContext(ctx context.Context, input device.Input) (device.Input, error)
+	GetInputContext(ctx context.Context) (device.Input, error)
+}
+
+var (
+	_ Amplifier = (*Control)(nil)
+	_ Amplifier = (*ControlWithListener)(nil)
+)
@@ -2,10 +2,16 @@
 package remote
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/Jacalz/hegelmote/device"
 )
@@ -14,12 +20,57 @@ import (
 type Control struct {
 	deviceType device.Type
 
-	conn io.ReadWriteCloser
+	conn    io.ReadWriteCloser
+	packets *PacketReader
+
+	// exchange, if set, replaces writing a packet and reading the response directly on conn.
+	exchange func(ctx context.Context, packet []byte) ([]byte, error)
+
+	limit atomic.Pointer[VolumeLimit]
+
+	// knownInput, if set, returns the selected input without asking the amplifier for it.
+	knownInput func() (device.Input, bool)
+
+	// knownVolume, if set, returns the volume without asking the amplifier for it.
+	knownVolume func() (Volume, bool)
+
+	commandsLock sync.RWMutex
+	commands     map[byte]Command
+
+	tracer atomic.Pointer[Tracer]
+}
+
+// TimeoutError is returned when a command did not get a response before the context was done.
+type TimeoutError struct {
+	// Packet is the command that was sent, without the trailing carriage return.
+	Packet string
+
+	// Err is the error from the context, like [context.DeadlineExceeded] or [context.Canceled].
+	Err error
+}
+
+func newTimeoutError(packet []byte, err error) *TimeoutError {
+	return &TimeoutError{Packet: string(bytes.TrimSuffix(packet, []byte{'\r'})), Err: err}
+}
+
+// Error returns a description of the command that timed out.
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("no response to %q: %v", e.Packet, e.Err)
+}
+
+// Unwrap returns the underlying context error.
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout always reports true. It makes the error match the net.Error interface.
+func (e *TimeoutError) Timeout() bool {
+	return true
 }
 
 // Connect connects to the supplied host address. A port should not be specified.
 func (c *Control) Connect(host string, model device.Type) error {
-	return c.connect(host, model)
+	return c.ConnectWithConfig(context.Background(), host, model, ConnectConfig{})
 }
 
 // Disconnect closes the remote connection.
@@ -30,6 +81,7 @@ func (c *Control) Disconnect() error {
 
 	err := c.conn.Close()
 	c.conn = nil
+	c.packets = nil
 	return err
 }
 
@@ -38,72 +90,117 @@ func (c *Control) GetDeviceType() device.Type {
 	return c.deviceType
 }
 
-func (c *Control) read(expectedCommand byte) ([]byte, error) {
-	buf := [len("-v.100\r")]byte{}
+func (c *Control) send(ctx context.Context, packet []byte) ([]byte, error) {
+	exchange := c.exchange
+	if exchange == nil {
+		exchange = c.writeAndRead
+	}
 
-	n, err := c.conn.Read(buf[:])
+	resp, err := exchange(ctx, packet)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := c.verifyResponse(buf, n)
+	if resp[1] != packet[1] {
+		return nil, fmt.Errorf("unexpected response: %q", resp)
+	}
+
+	return resp, nil
+}
+
+func (c *Control) writeAndRead(ctx context.Context, packet []byte) ([]byte, error) {
+	stop := c.watchContext(ctx)
+	defer stop()
+
+	sent := c.trace(TraceSent, packet, time.Time{})
+	_, err := c.conn.Write(packet)
 	if err != nil {
-		return nil, err
+		return nil, contextError(ctx, packet, err)
 	}
 
-	if resp[1] != expectedCommand {
-		return nil, fmt.Errorf("unexpected response: %q", buf[:])
+	resp, err := c.packets.ReadPacket()
+	if err != nil {
+		return nil, contextError(ctx, packet, err)
 	}
 
-	return resp, nil
+	c.trace(TraceReceived, resp, sent)
+	return verifyResponse(resp)
+}
+
+func (c *Control) setConn(conn io.ReadWriteCloser) {
+	c.conn = conn
+	c.packets = NewPacketReader(conn)
 }
 
-func (c *Control) verifyResponse(buf [7]byte, n int) ([]byte, error) {
-	if n < 5 {
-		return nil, fmt.Errorf("unexpected response: %q", buf[:])
+type deadlineSetter interface {
+	SetDeadline(t time.Time) error
+}
+
+// watchContext applies the deadline and cancellation of the context to the connection.
+// The returned function must be called to clear the deadline afterwards.
+func (c *Control) watchContext(ctx context.Context) func() {
+	conn, ok := c.conn.(deadlineSetter)
+	if !ok || ctx.Done() == nil {
+		return func() {}
 	}
 
-	if buf[1] == 'e' {
-		return nil, errorFromCode(buf[3]) // #nosec Gosec is stupid, see https://github.com/securego/gosec/issues/1406.
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
 	}
 
-	return buf[:n], nil
+	interrupted := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Unix(1, 0))
+		close(interrupted)
+	})
+
+	return func() {
+		if !stop() {
+			<-interrupted
+		}
+		_ = conn.SetDeadline(time.Time{})
+	}
 }
 
-func (c *Control) sendWithBoolResponse(packet []byte) (bool, error) {
-	_, err := c.conn.Write(packet)
-	if err != nil {
-		return false, err
+// contextError turns errors caused by the context being done into a [TimeoutError].
+func contextError(ctx context.Context, packet []byte, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return newTimeoutError(packet, ctxErr)
+	} else if errors.Is(err, os.ErrDeadlineExceeded) {
+		return newTimeoutError(packet, context.DeadlineExceeded)
 	}
 
-	return c.parseOnOffValue(packet[1])
+	return err
 }
 
-func (c *Control) parseOnOffValue(command byte) (bool, error) {
-	buf, err := c.read(command)
-	if err != nil {
-		return false, err
+func verifyResponse(resp []byte) ([]byte, error) {
+	if len(resp) < 5 {
+		return nil, fmt.Errorf("unexpected response: %q", resp)
+	}
+
+	if resp[1] == 'e' {
+		return nil, errorFromCode(resp[3]) // #nosec Gosec is stupid, see https://github.com/securego/gosec/issues/1406.
 	}
 
-	return buf[3] == '1', nil
+	return resp, nil
 }
 
-func (c *Control) sendWithNumericalResponse(packet []byte) (uint8, error) {
-	_, err := c.conn.Write(packet)
+func (c *Control) sendWithBoolResponse(ctx context.Context, packet []byte) (bool, error) {
+	resp, err := c.send(ctx, packet)
 	if err != nil {
-		return 0, err
+		return false, err
 	}
 
-	return c.parseNumberFromResponse(packet[1])
+	return resp[3] == '1', nil
 }
 
-func (c *Control) parseNumberFromResponse(command byte) (uint8, error) {
-	buf, err := c.read(command)
+func (c *Control) sendWithNumericalResponse(ctx context.Context, packet []byte) (uint8, error) {
+	resp, err := c.send(ctx, packet)
 	if err != nil {
 		return 0, err
 	}
 
-	return parseUint8FromBuf(buf)
+	return parseUint8FromBuf(resp)
 }
 
 func parseUint8FromBuf(buf []byte) (uint8, error) {
@@ -139,17 +236,28 @@ func createBooleanPacket(command byte, value bool) []byte {
 	return packet
 }
 
-// Mapping of error values. Index zero corresponds to error 1 and so on.
+// ProtocolError is an error code sent by the amplifier in response to a command.
+type ProtocolError struct {
+	// Code is the error code, where 1 is a malformed command, 2 an unknown command and 3 an invalid parameter.
+	Code uint8
+}
+
+// Error returns a description of the error code.
 // The following error codes were reverse engineered by sending incorrect commands.
-func errorFromCode(code byte) error {
-	switch code - '0' {
+func (e *ProtocolError) Error() string {
+	switch e.Code {
 	case 1:
-		return errors.New("malformed command")
+		return "malformed command"
 	case 2:
-		return errors.New("unknown command")
+		return "unknown command"
 	case 3:
-		return errors.New("invalid parameter")
+		return "invalid parameter"
 	default:
-		return fmt.Errorf("unexpected error code: %d", code)
+		return fmt.Sprintf("unexpected error code: %d", e.Code)
 	}
 }
+
+// errorFromCode returns the error for the error code digit of an error packet.
+func errorFromCode(code byte) error {
+	return &ProtocolError{Code: code - '0'}
+}
@@ -2,8 +2,12 @@ package remote
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"io"
 	"net"
 	"testing"
+	"time"
 
 	"github.com/Jacalz/hegelmote/device"
 	"github.com/alecthomas/assert/v2"
@@ -25,6 +29,11 @@ func (t *mockConnection) Write(buf []byte) (int, error) {
 	return t.writeBuf.Write(buf)
 }
 
+// SetDeadline does nothing as reads and writes never block.
+func (t *mockConnection) SetDeadline(_ time.Time) error {
+	return nil
+}
+
 // Close is the same as calling Reset() on both buffers.
 func (t *mockConnection) Close() error {
 	t.readBuf.Reset()
@@ -49,7 +58,7 @@ func (t *mockConnection) FlushToReader() {
 func newControlMock() (*Control, *mockConnection) {
 	control := &Control{deviceType: device.H95}
 	adapter := &mockConnection{}
-	control.conn = adapter
+	control.setConn(adapter)
 	return control, adapter
 }
 
@@ -95,8 +104,102 @@ func TestReturnedErrors(t *testing.T) {
 	_, err = control.SetPower(true)
 	assert.Equal(t, errorFromCode('3'), err)
 
+	protocolErr := &ProtocolError{}
+	assert.True(t, errors.As(err, &protocolErr))
+	assert.Equal(t, 3, protocolErr.Code)
+
 	mock.Fill("-e.0\r")
 
 	_, err = control.SetPower(true)
 	assert.Error(t, err)
 }
+
+func newControlPipe(t *testing.T) (*Control, net.Conn) {
+	t.Helper()
+
+	client, amplifier := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+		amplifier.Close()
+	})
+
+	control := &Control{deviceType: device.H95}
+	control.setConn(client)
+	return control, amplifier
+}
+
+func TestContextTimeout(t *testing.T) {
+	control, amplifier := newControlPipe(t)
+	go io.Copy(io.Discard, amplifier)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := control.GetVolumeContext(ctx)
+	timeout := &TimeoutError{}
+	assert.True(t, errors.As(err, &timeout))
+	assert.Equal(t, "-v.?", timeout.Packet)
+	assert.IsError(t, err, context.DeadlineExceeded)
+
+	// The connection should be usable again after the timeout.
+	go amplifier.Write([]byte("-v.20\r"))
+	volume, err := control.GetVolume()
+	assert.NoError(t, err)
+	assert.Equal(t, 20, volume)
+}
+
+func TestContextCancel(t *testing.T) {
+	control, amplifier := newControlPipe(t)
+	go io.Copy(io.Discard, amplifier)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	_, err := control.SetPowerContext(ctx, true)
+	assert.IsError(t, err, context.Canceled)
+
+	timeout := &TimeoutError{}
+	assert.True(t, errors.As(err, &timeout))
+}
+
+func TestProtocolErrorIsNotTimeout(t *testing.T) {
+	control, mock := newControlMock()
+	mock.Fill("-e.3\r")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := control.SetInputContext(ctx, 12)
+	assert.Error(t, err)
+
+	timeout := &TimeoutError{}
+	assert.False(t, errors.As(err, &timeout))
+}
+
+func TestCoalescedResponses(t *testing.T) {
+	control, mock := newControlMock()
+	mock.Fill("-p.1\r-v.20\r")
+
+	on, err := control.SetPower(true)
+	assert.NoError(t, err)
+	assert.True(t, on)
+
+	volume, err := control.GetVolume()
+	assert.NoError(t, err)
+	assert.Equal(t, 20, volume)
+}
+
+func TestSplitResponse(t *testing.T) {
+	control, amplifier := newControlPipe(t)
+
+	go func() {
+		buf := make([]byte, 8)
+		_, _ = amplifier.Read(buf)
+		_, _ = amplifier.Write([]byte("-v."))
+		_, _ = amplifier.Write([]byte("100\r"))
+	}()
+
+	volume, err := control.GetVolume()
+	assert.NoError(t, err)
+	assert.Equal(t, 100, volume)
+}
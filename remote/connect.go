@@ -0,0 +1,42 @@
+package remote
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/Jacalz/hegelmote/device"
+)
+
+// DefaultPort is the TCP port that the amplifiers listen for remote control on.
+const DefaultPort = 50001
+
+const defaultDialTimeout = 100 * time.Millisecond
+
+// ConnectConfig specifies how to connect to the amplifier.
+// The zero value connects the same way as [Control.Connect].
+type ConnectConfig struct {
+	// Port is the TCP port to connect to. Defaults to [DefaultPort], which is the only
+	// port allowed in the browser, where the webmote proxy makes the connection.
+	Port uint16
+
+	// Timeout limits how long to wait for the connection. Defaults to 100 milliseconds.
+	Timeout time.Duration
+
+	// KeepAlive is the interval between TCP keep-alive probes.
+	// Zero uses the system default and a negative value disables keep-alive.
+	KeepAlive time.Duration
+
+	// LocalAddr is the local address to connect from. Nil lets the system decide.
+	LocalAddr net.Addr
+
+	// Dial, if set, opens the connection instead of a [net.Dialer] using the settings above.
+	// The DialContext method of a custom [net.Dialer] or an SSH client can be passed here.
+	Dial func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// ConnectWithConfig connects to the supplied host address using the given configuration.
+// The host should not include a port, use [ConnectConfig.Port] instead.
+func (c *Control) ConnectWithConfig(ctx context.Context, host string, model device.Type, config ConnectConfig) error {
+	return c.connect(ctx, host, model, config)
+}
@@ -3,24 +3,31 @@
 package remote
 
 import (
+	"cmp"
 	"context"
 	"net"
-	"time"
+	"strconv"
 
 	"github.com/Jacalz/hegelmote/device"
 )
 
-func (c *Control) connect(host string, model device.Type) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+func (c *Control) connect(ctx context.Context, host string, model device.Type, config ConnectConfig) error {
+	ctx, cancel := context.WithTimeout(ctx, cmp.Or(config.Timeout, defaultDialTimeout))
 	defer cancel()
 
-	d := net.Dialer{}
-	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(host, "50001"))
+	dial := config.Dial
+	if dial == nil {
+		d := net.Dialer{KeepAlive: config.KeepAlive, LocalAddr: config.LocalAddr}
+		dial = d.DialContext
+	}
+
+	port := strconv.FormatUint(uint64(cmp.Or(config.Port, DefaultPort)), 10)
+	conn, err := dial(ctx, "tcp", net.JoinHostPort(host, port))
 	if err != nil {
 		return err
 	}
 
-	c.conn = conn
+	c.setConn(conn)
 	c.deviceType = model
 	return nil
 }
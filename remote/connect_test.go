@@ -0,0 +1,114 @@
+package remote
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/Jacalz/hegelmote/remote/hegelsim"
+	"github.com/alecthomas/assert/v2"
+)
+
+func newSimulator(t *testing.T, model device.Type) *hegelsim.Amplifier {
+	t.Helper()
+
+	amp, err := hegelsim.New(model)
+	assert.NoError(t, err)
+	assert.NoError(t, amp.Listen("127.0.0.1:0"))
+	t.Cleanup(func() { assert.NoError(t, amp.Close()) })
+	return amp
+}
+
+func connectToSimulator(t *testing.T, amp *hegelsim.Amplifier) *Control {
+	t.Helper()
+
+	control := &Control{}
+	err := control.ConnectWithConfig(context.Background(), "127.0.0.1", amp.Model(), ConnectConfig{Port: amp.Port()})
+	assert.NoError(t, err)
+	t.Cleanup(func() { control.Disconnect() })
+	return control
+}
+
+func listenToSimulator(t *testing.T, amp *hegelsim.Amplifier) *ControlWithListener {
+	t.Helper()
+
+	control := NewControlWithListener(nil, nil, nil, nil, nil, func(err error) { t.Errorf("unexpected error: %v", err) })
+	err := control.ConnectWithConfig(context.Background(), "127.0.0.1", amp.Model(), ConnectConfig{Port: amp.Port()})
+	assert.NoError(t, err)
+	t.Cleanup(func() { control.Disconnect() })
+	return control
+}
+
+func TestConnectWithConfig(t *testing.T) {
+	amp := newSimulator(t, device.H190)
+
+	control := &Control{}
+	err := control.ConnectWithConfig(context.Background(), "127.0.0.1", device.H190, ConnectConfig{
+		Port:      amp.Port(),
+		Timeout:   time.Second,
+		KeepAlive: -1,
+		LocalAddr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)},
+	})
+	assert.NoError(t, err)
+	defer control.Disconnect()
+
+	assert.Equal(t, device.H190, control.GetDeviceType())
+
+	on, err := control.SetPower(true)
+	assert.NoError(t, err)
+	assert.True(t, on)
+	assert.True(t, amp.State().Power)
+}
+
+func TestConnectWithCustomDial(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+
+	dialed := ""
+	config := ConnectConfig{
+		Port: amp.Port(),
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			dialed = address
+			d := net.Dialer{}
+			return d.DialContext(ctx, network, address)
+		},
+	}
+
+	control := &Control{}
+	err := control.ConnectWithConfig(context.Background(), "127.0.0.1", device.H95, config)
+	assert.NoError(t, err)
+	defer control.Disconnect()
+
+	assert.Equal(t, amp.Addr().String(), dialed)
+
+	volume, err := control.SetVolume(25)
+	assert.NoError(t, err)
+	assert.Equal(t, 25, volume)
+}
+
+func TestConnectCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	control := &Control{}
+	err := control.ConnectWithConfig(ctx, "127.0.0.1", device.H95, ConnectConfig{Port: 1})
+	assert.IsError(t, err, context.Canceled)
+}
+
+func TestListenerConnectWithConfig(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+
+	control := NewControlWithListener(
+		func(bool) {}, func(Volume) {}, func(bool) {}, func(device.Input) {}, func() {}, func(error) {},
+	)
+	err := control.ConnectWithConfig(context.Background(), "127.0.0.1", device.H95, ConnectConfig{Port: amp.Port()})
+	assert.NoError(t, err)
+	defer control.Disconnect()
+
+	assert.Equal(t, 3, amp.State().ResetDelay)
+
+	input, err := control.SetInput(7)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, input)
+}
@@ -3,42 +3,37 @@
 package remote
 
 import (
+	"cmp"
 	"context"
+	"fmt"
 
 	"github.com/Jacalz/hegelmote/device"
 	"github.com/coder/websocket"
 )
 
-func (c *Control) connect(host string, model device.Type) error {
-	ws, _, err := websocket.Dial(context.Background(), "ws://localhost:8086/proxy", nil)
+// The proxy does the actual connection, always to the default port, so only the timeout is used from the config.
+func (c *Control) connect(ctx context.Context, host string, model device.Type, config ConnectConfig) error {
+	if config.Port != 0 && config.Port != DefaultPort {
+		return fmt.Errorf("the proxy only connects to port %d", DefaultPort)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cmp.Or(config.Timeout, defaultDialTimeout))
+	defer cancel()
+
+	ws, _, err := websocket.Dial(ctx, "ws://localhost:8086/proxy", nil)
 	if err != nil {
 		return err
 	}
 
-	err = ws.Write(context.Background(), websocket.MessageText, []byte(host))
+	err = ws.Write(ctx, websocket.MessageText, []byte(host))
 	if err != nil {
 		return err
 	}
 
-	c.conn = &wsWrapper{ws: ws}
+	// Wrapping as a net.Conn gives us deadlines for cancelling reads and lets packets
+	// split over several messages be put together again. Note that the socket is closed
+	// if a read is interrupted.
+	c.setConn(websocket.NetConn(context.Background(), ws, websocket.MessageText))
 	c.deviceType = model
 	return nil
 }
-
-type wsWrapper struct {
-	ws *websocket.Conn
-}
-
-func (w *wsWrapper) Read(p []byte) (int, error) {
-	_, buf, err := w.ws.Read(context.Background())
-	copy(p, buf)
-	return len(buf), err
-}
-
-func (w *wsWrapper) Write(p []byte) (int, error) {
-	return len(p), w.ws.Write(context.Background(), websocket.MessageText, p)
-}
-
-func (w *wsWrapper) Close() error {
-	return w.ws.Close(websocket.StatusNormalClosure, "")
-}
@@ -0,0 +1,256 @@
+package remote
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Jacalz/hegelmote/device"
+)
+
+// Event is a change reported by [ControlWithListener] to subscribers.
+// It is one of [PowerChanged], [VolumeChanged], [MuteChanged], [InputChanged],
+// [ResetReceived], [ErrorReceived], [ConnectionStateChanged] or [Resynced].
+type Event interface {
+	isEvent()
+}
+
+// PowerChanged is sent when the amplifier is turned on or off.
+type PowerChanged struct {
+	PoweredOn bool
+}
+
+// VolumeChanged is sent when the volume changes.
+type VolumeChanged struct {
+	Volume Volume
+}
+
+// MuteChanged is sent when the amplifier is muted or unmuted.
+type MuteChanged struct {
+	Muted bool
+}
+
+// InputChanged is sent when another input is selected.
+type InputChanged struct {
+	Input device.Input
+}
+
+// ResetReceived is sent when the amplifier is about to reset the connection.
+type ResetReceived struct{}
+
+// ErrorReceived is sent when an error occurs outside of a command.
+type ErrorReceived struct {
+	Err error
+}
+
+// ConnectionStateChanged is sent when the state of the connection changes.
+type ConnectionStateChanged struct {
+	State ConnectionState
+}
+
+// Resynced is sent after reconnecting, once the state has been fetched again
+// and the changes made while disconnected have been sent. A [Manager] also
+// sends it after the current state, when events from an amplifier were missed.
+type Resynced struct{}
+
+func (PowerChanged) isEvent()           {}
+func (VolumeChanged) isEvent()          {}
+func (MuteChanged) isEvent()            {}
+func (InputChanged) isEvent()           {}
+func (ResetReceived) isEvent()          {}
+func (ErrorReceived) isEvent()          {}
+func (ConnectionStateChanged) isEvent() {}
+func (Resynced) isEvent()               {}
+
+// SlowConsumerPolicy decides what happens when the buffer of a subscriber is full.
+type SlowConsumerPolicy uint8
+
+const (
+	// DropNewest drops events that do not fit in the buffer.
+	DropNewest SlowConsumerPolicy = iota
+
+	// Block waits for the subscriber to receive the event. This holds up all
+	// other subscribers, including the callbacks, and should be used with care.
+	Block
+
+	// CloseSubscription closes the channel of a subscriber that falls behind.
+	CloseSubscription
+)
+
+const defaultEventBuffer = 16
+
+// SubscribeConfig configures a subscription to events.
+type SubscribeConfig struct {
+	// Buffer is the number of events buffered for the subscriber. Defaults to 16.
+	Buffer int
+
+	// Policy decides what happens when the buffer is full. Defaults to [DropNewest].
+	Policy SlowConsumerPolicy
+}
+
+type subscriber[T any] struct {
+	events chan T
+	policy SlowConsumerPolicy
+	done   <-chan struct{}
+}
+
+type subscribers[T any] struct {
+	lock sync.Mutex
+	subs map[*subscriber[T]]struct{}
+}
+
+// Subscribe returns a channel that receives all events until the context is done.
+// The channel is closed once the subscription ends.
+// Any number of subscribers can be active at the same time.
+func (c *ControlWithListener) Subscribe(ctx context.Context) <-chan Event {
+	return c.SubscribeWithConfig(ctx, SubscribeConfig{})
+}
+
+// SubscribeWithConfig is like [ControlWithListener.Subscribe] but uses the given configuration.
+func (c *ControlWithListener) SubscribeWithConfig(ctx context.Context, config SubscribeConfig) <-chan Event {
+	return c.subscribers.subscribe(ctx, config)
+}
+
+func (s *subscribers[T]) subscribe(ctx context.Context, config SubscribeConfig) <-chan T {
+	buffer := config.Buffer
+	if buffer <= 0 {
+		buffer = defaultEventBuffer
+	}
+
+	sub := &subscriber[T]{events: make(chan T, buffer), policy: config.Policy, done: ctx.Done()}
+
+	s.lock.Lock()
+	if s.subs == nil {
+		s.subs = map[*subscriber[T]]struct{}{}
+	}
+	s.subs[sub] = struct{}{}
+	s.lock.Unlock()
+
+	context.AfterFunc(ctx, func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		s.remove(sub)
+	})
+
+	return sub.events
+}
+
+// remove closes the channel of the subscriber, unless already removed.
+// The lock must be held when calling this method.
+func (s *subscribers[T]) remove(sub *subscriber[T]) {
+	if _, ok := s.subs[sub]; !ok {
+		return
+	}
+
+	delete(s.subs, sub)
+	close(sub.events)
+}
+
+func (s *subscribers[T]) publish(event T) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for sub := range s.subs {
+		select {
+		case sub.events <- event:
+			continue
+		default:
+		}
+
+		switch sub.policy {
+		case Block:
+			select {
+			case sub.events <- event:
+			case <-sub.done:
+				s.remove(sub)
+			}
+		case CloseSubscription:
+			s.remove(sub)
+		}
+	}
+}
+
+// followConfig is used for subscriptions that must never hold up the amplifier.
+// A subscription that falls behind is closed and replaced by [ControlWithListener.follow].
+var followConfig = SubscribeConfig{Buffer: 64, Policy: CloseSubscription}
+
+// follow passes the events, subscribed to using [followConfig], to the function until the context is done.
+// When the subscription falls behind, a new one is made and the events that were missed are replaced by
+// ones for the current state, see [ControlWithListener.catchUpEvents].
+func (c *ControlWithListener) follow(ctx context.Context, events <-chan Event, handle func(Event)) {
+	for {
+		for event := range events {
+			handle(event)
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		events = c.SubscribeWithConfig(ctx, followConfig)
+		for _, event := range c.catchUpEvents() {
+			handle(event)
+		}
+	}
+}
+
+// catchUpEvents returns events for the current connection state and the known state of the amplifier.
+// [Resynced] is sent last when connected, like after reconnecting.
+func (c *ControlWithListener) catchUpEvents() []Event {
+	connection := c.GetConnectionState()
+	events := []Event{ConnectionStateChanged{State: connection}}
+	if connection != Connected {
+		return events
+	}
+
+	state := c.Snapshot()
+	if !state.PowerUpdated.IsZero() {
+		events = append(events, PowerChanged{PoweredOn: state.Power})
+	}
+	if !state.VolumeUpdated.IsZero() {
+		events = append(events, VolumeChanged{Volume: state.Volume})
+	}
+	if !state.MuteUpdated.IsZero() {
+		events = append(events, MuteChanged{Muted: state.Mute})
+	}
+	if !state.InputUpdated.IsZero() {
+		events = append(events, InputChanged{Input: state.Input})
+	}
+
+	return append(events, Resynced{})
+}
+
+// emit passes the event on to the matching callback and then to all subscribers.
+func (c *ControlWithListener) emit(event Event) {
+	switch event := event.(type) {
+	case PowerChanged:
+		if c.OnPowerChange != nil {
+			c.OnPowerChange(event.PoweredOn)
+		}
+	case VolumeChanged:
+		if c.OnVolumeChange != nil {
+			c.OnVolumeChange(event.Volume)
+		}
+	case MuteChanged:
+		if c.OnMuteChange != nil {
+			c.OnMuteChange(event.Muted)
+		}
+	case InputChanged:
+		if c.OnInputChange != nil {
+			c.OnInputChange(event.Input)
+		}
+	case ResetReceived:
+		if c.OnReset != nil {
+			c.OnReset()
+		}
+	case ErrorReceived:
+		if c.OnError != nil {
+			c.OnError(event.Err)
+		}
+	case ConnectionStateChanged:
+		if c.OnConnectionState != nil {
+			c.OnConnectionState(event.State)
+		}
+	}
+
+	c.subscribers.publish(event)
+}
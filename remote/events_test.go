@@ -0,0 +1,148 @@
+package remote
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/alecthomas/assert/v2"
+)
+
+func receiveEvent(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+
+	select {
+	case event, ok := <-events:
+		assert.True(t, ok, "channel closed unexpectedly")
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+		return nil
+	}
+}
+
+func assertEvent(t *testing.T, events <-chan Event, expected Event) {
+	t.Helper()
+	assert.Equal(t, expected, receiveEvent(t, events))
+}
+
+func assertClosed(t *testing.T, events <-chan Event) {
+	t.Helper()
+
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for channel to close")
+		}
+	}
+}
+
+func TestSubscribeMultiple(t *testing.T) {
+	volumes := make(chan Volume, 1)
+	control, amplifier := newListenerPipe(t, func(v Volume) { volumes <- v })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := control.Subscribe(ctx)
+	second := control.Subscribe(context.Background())
+
+	_, err := amplifier.Write([]byte("-v.30\r-p.1\r-m.1\r-i.2\r-r.0\r"))
+	assert.NoError(t, err)
+
+	expected := []Event{
+		VolumeChanged{Volume: 30},
+		PowerChanged{PoweredOn: true},
+		MuteChanged{Muted: true},
+		InputChanged{Input: 2},
+		ResetReceived{},
+	}
+	for _, event := range expected {
+		assertEvent(t, first, event)
+		assertEvent(t, second, event)
+	}
+	assert.Equal(t, 30, <-volumes)
+
+	cancel()
+	assertClosed(t, first)
+
+	_, err = amplifier.Write([]byte("-v.31\r"))
+	assert.NoError(t, err)
+	assertEvent(t, second, VolumeChanged{Volume: 31})
+}
+
+func TestSubscribeErrors(t *testing.T) {
+	control, amplifier := newListenerPipe(t, func(Volume) {})
+	events := control.Subscribe(context.Background())
+
+	_, err := amplifier.Write([]byte("-x.1\r"))
+	assert.NoError(t, err)
+
+	event, ok := receiveEvent(t, events).(ErrorReceived)
+	assert.True(t, ok)
+	assert.Error(t, event.Err)
+}
+
+func TestSubscribeSlowConsumer(t *testing.T) {
+	control, amplifier := newListenerPipe(t, func(Volume) {})
+	dropping := control.SubscribeWithConfig(context.Background(), SubscribeConfig{Buffer: 1})
+	closing := control.SubscribeWithConfig(context.Background(), SubscribeConfig{Buffer: 1, Policy: CloseSubscription})
+
+	blockCtx, cancelBlock := context.WithCancel(context.Background())
+	defer cancelBlock()
+	blocking := control.SubscribeWithConfig(blockCtx, SubscribeConfig{Buffer: 1, Policy: Block})
+
+	tracking := control.Subscribe(context.Background())
+
+	_, err := amplifier.Write([]byte("-v.1\r-v.2\r-v.3\r"))
+	assert.NoError(t, err)
+
+	// The blocking subscriber holds up delivery until it receives.
+	assertEvent(t, tracking, VolumeChanged{Volume: 1})
+	assertEvent(t, blocking, VolumeChanged{Volume: 1})
+	assertEvent(t, tracking, VolumeChanged{Volume: 2})
+	assertEvent(t, blocking, VolumeChanged{Volume: 2})
+	assertEvent(t, tracking, VolumeChanged{Volume: 3})
+	assertEvent(t, blocking, VolumeChanged{Volume: 3})
+
+	assertEvent(t, dropping, VolumeChanged{Volume: 1})
+	select {
+	case event := <-dropping:
+		t.Fatalf("expected events to be dropped, got %v", event)
+	default:
+	}
+
+	assertEvent(t, closing, VolumeChanged{Volume: 1})
+	assertClosed(t, closing)
+
+	// Cancelling a blocked subscriber lets the others continue.
+	_, err = amplifier.Write([]byte("-m.1\r-m.0\r-p.1\r"))
+	assert.NoError(t, err)
+	assertEvent(t, tracking, MuteChanged{Muted: true})
+	cancelBlock()
+	assertEvent(t, tracking, MuteChanged{Muted: false})
+	assertEvent(t, tracking, PowerChanged{PoweredOn: true})
+	assertClosed(t, blocking)
+}
+
+func TestSubscribeConnectionState(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+
+	control := NewControlWithListener(nil, nil, nil, nil, nil, nil)
+	events := control.Subscribe(context.Background())
+
+	err := control.ConnectWithConfig(context.Background(), "127.0.0.1", device.H95, ConnectConfig{Port: amp.Port()})
+	assert.NoError(t, err)
+	assertEvent(t, events, ConnectionStateChanged{State: Connecting})
+	assertEvent(t, events, ConnectionStateChanged{State: Connected})
+
+	amp.SetVolume(12)
+	assertEvent(t, events, VolumeChanged{Volume: 12})
+
+	assert.NoError(t, control.Disconnect())
+	assertEvent(t, events, ConnectionStateChanged{State: Disconnected})
+}
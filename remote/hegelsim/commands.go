@@ -0,0 +1,201 @@
+package hegelsim
+
+import (
+	"strconv"
+	"time"
+)
+
+// Error codes sent by the amplifier, see ProtocolError in the remote package.
+const (
+	errMalformed    = '1'
+	errUnknown      = '2'
+	errInvalidParam = '3'
+)
+
+func errorPacket(code byte) []byte {
+	return []byte{'-', 'e', '.', code, '\r'}
+}
+
+func packet(command byte, value string) []byte {
+	out := make([]byte, 0, len("-v.100\r"))
+	out = append(out, '-', command, '.')
+	out = append(out, value...)
+	return append(out, '\r')
+}
+
+func boolPacket(command byte, value bool) []byte {
+	return packet(command, boolArgument(value))
+}
+
+// handlePacket applies a packet sent by a client and returns the response.
+// The returned bool reports if the state changed and other clients should be notified.
+// The lock must be held when calling this method.
+func (a *Amplifier) handlePacket(in []byte) ([]byte, bool) {
+	if len(in) < len("-p.?\r") || in[0] != '-' || in[2] != '.' {
+		return errorPacket(errMalformed), false
+	}
+
+	before := a.state
+	argument := string(in[3 : len(in)-1])
+
+	var resp []byte
+	switch in[1] {
+	case 'p':
+		resp = a.applyPower(argument)
+	case 'v':
+		resp = a.applyVolume(argument)
+	case 'm':
+		resp = a.applyMute(argument)
+	case 'i':
+		resp = a.applyInput(argument)
+	case 'r':
+		return a.applyResetDelay(argument), false
+	default:
+		return a.applyExtra(in[1], argument), false
+	}
+
+	return resp, before != a.state
+}
+
+func (a *Amplifier) applyExtra(command byte, argument string) []byte {
+	handler, ok := a.extra[command]
+	if !ok {
+		return errorPacket(errUnknown)
+	}
+
+	value, ok := handler(argument)
+	if !ok {
+		return errorPacket(errInvalidParam)
+	}
+
+	return packet(command, value)
+}
+
+func (a *Amplifier) applyPower(argument string) []byte {
+	on, ok := parseBool(argument, a.state.Power)
+	if !ok {
+		return errorPacket(errInvalidParam)
+	}
+
+	a.state.Power = on
+	return boolPacket('p', on)
+}
+
+func (a *Amplifier) applyMute(argument string) []byte {
+	muted, ok := parseBool(argument, a.state.Mute)
+	if !ok {
+		return errorPacket(errInvalidParam)
+	}
+
+	a.state.Mute = muted
+	return boolPacket('m', muted)
+}
+
+func (a *Amplifier) applyVolume(argument string) []byte {
+	switch argument {
+	case "?":
+	case "u":
+		a.state.Volume = min(a.state.Volume+1, 100)
+	case "d":
+		a.state.Volume = max(a.state.Volume, 1) - 1
+	default:
+		volume, ok := parseNumber(argument, 100)
+		if !ok {
+			return errorPacket(errInvalidParam)
+		}
+		a.state.Volume = volume
+	}
+
+	return packet('v', strconv.Itoa(int(a.state.Volume)))
+}
+
+func (a *Amplifier) applyInput(argument string) []byte {
+	if argument != "?" {
+		input, ok := parseNumber(argument, a.inputs)
+		if !ok || input == 0 {
+			return errorPacket(errInvalidParam)
+		}
+		a.state.Input = input
+	}
+
+	return packet('i', strconv.Itoa(int(a.state.Input)))
+}
+
+func (a *Amplifier) applyResetDelay(argument string) []byte {
+	switch argument {
+	case "?":
+		if !a.state.ResetStopped && a.resetTimer != nil {
+			a.state.ResetDelay = a.remainingResetMinutes()
+		}
+	case "~":
+		a.state.ResetDelay = 0
+		a.state.ResetStopped = true
+		if a.resetTimer != nil {
+			a.resetTimer.Stop()
+		}
+	default:
+		minutes, ok := parseNumber(argument, 255)
+		if !ok {
+			return errorPacket(errInvalidParam)
+		}
+
+		a.state.ResetDelay = minutes
+		a.state.ResetStopped = false
+		a.startResetTimer(minutes)
+	}
+
+	if a.state.ResetStopped {
+		return packet('r', "~")
+	}
+
+	return packet('r', strconv.Itoa(int(a.state.ResetDelay)))
+}
+
+// startResetTimer (re)starts the countdown until the connections are reset.
+// The lock must be held when calling this method.
+func (a *Amplifier) startResetTimer(minutes uint8) {
+	delay := time.Duration(minutes) * a.resetUnit()
+	if a.resetTimer == nil {
+		a.resetTimer = time.AfterFunc(delay, a.onResetTimer)
+	} else {
+		a.resetTimer.Reset(delay)
+	}
+	a.resetDeadline = time.Now().Add(delay)
+}
+
+func (a *Amplifier) remainingResetMinutes() uint8 {
+	unit := a.resetUnit()
+	remaining := (time.Until(a.resetDeadline) + unit - 1) / unit
+	return uint8(max(min(remaining, 255), 0)) // #nosec G115 -- Clamped to fit.
+}
+
+func (a *Amplifier) resetUnit() time.Duration {
+	if a.ResetUnit <= 0 {
+		return time.Minute
+	}
+	return a.ResetUnit
+}
+
+func parseBool(argument string, current bool) (bool, bool) {
+	switch argument {
+	case "0":
+		return false, true
+	case "1":
+		return true, true
+	case "t":
+		return !current, true
+	case "?":
+		return current, true
+	}
+
+	return false, false
+}
+
+func parseNumber(argument string, maximum int) (uint8, bool) {
+	number, err := strconv.Atoi(argument)
+	if err != nil || number < 0 || number > maximum {
+		return 0, false
+	}
+
+	return uint8(number), true // #nosec G115 -- Maximum is at most 255.
+}
@@ -0,0 +1,413 @@
+// Package hegelsim implements a simulated Hegel amplifier that speaks the IP control protocol.
+// It is intended for testing and development without access to real hardware.
+package hegelsim
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Jacalz/hegelmote/device"
+)
+
+// DefaultAddress is the address that real amplifiers listen for remote control on.
+const DefaultAddress = ":50001"
+
+// writeTimeout is how long writing to a client may take before it is disconnected.
+const writeTimeout = time.Second
+
+var errInvalidModel = errors.New("unsupported device type")
+
+// State describes the current state of the simulated amplifier.
+type State struct {
+	Power  bool
+	Volume uint8
+	Mute   bool
+	Input  device.Input
+
+	// ResetDelay is the number of minutes until the next reset.
+	ResetDelay   uint8
+	ResetStopped bool
+}
+
+// Amplifier is a simulated amplifier that clients can connect to over TCP.
+// Changes made by one client are sent as notifications to all other clients,
+// like the real amplifiers do. This data type is thread safe.
+type Amplifier struct {
+	// ResetUnit is the duration of one minute of reset delay.
+	// It defaults to one minute but can be shortened to speed up tests.
+	ResetUnit time.Duration
+
+	model  device.Type
+	inputs int
+
+	lock          sync.Mutex
+	state         State
+	resetTimer    *time.Timer
+	resetDeadline time.Time
+	listener      net.Listener
+	clients       map[*client]struct{}
+	closed        bool
+	extra         map[byte]CommandHandler
+}
+
+// CommandHandler handles a command that the simulator does not implement itself.
+// It returns the argument to respond with and false if the argument is invalid.
+type CommandHandler func(argument string) (string, bool)
+
+// New creates a new simulated amplifier of the given model.
+// The amplifier starts out powered off with the first input selected.
+func New(model device.Type) (*Amplifier, error) {
+	inputs, err := device.GetInputNames(model)
+	if err != nil {
+		return nil, errInvalidModel
+	}
+
+	return &Amplifier{
+		model:   model,
+		inputs:  len(inputs),
+		state:   State{Input: 1, ResetStopped: true},
+		clients: map[*client]struct{}{},
+	}, nil
+}
+
+// Listen starts listening on the given TCP address and serves clients in the background.
+// Use [DefaultAddress] to listen on the same port as the real amplifiers.
+func (a *Amplifier) Listen(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	err = a.setListener(listener)
+	if err != nil {
+		_ = listener.Close()
+		return err
+	}
+
+	go a.acceptClients(listener) // #nosec G104 -- Accept only fails once the listener is closed.
+	return nil
+}
+
+// Serve accepts connections on the listener until it is closed.
+func (a *Amplifier) Serve(listener net.Listener) error {
+	err := a.setListener(listener)
+	if err != nil {
+		return err
+	}
+
+	return a.acceptClients(listener)
+}
+
+func (a *Amplifier) setListener(listener net.Listener) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.closed {
+		return net.ErrClosed
+	}
+
+	a.listener = listener
+	return nil
+}
+
+func (a *Amplifier) acceptClients(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if a.isClosed() {
+				return nil
+			}
+			return err
+		}
+
+		c := &client{conn: conn}
+		a.lock.Lock()
+		a.clients[c] = struct{}{}
+		a.lock.Unlock()
+		go a.handleClient(c)
+	}
+}
+
+// Addr returns the address that the amplifier is listening on, or nil if not listening.
+func (a *Amplifier) Addr() net.Addr {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.listener == nil {
+		return nil
+	}
+
+	return a.listener.Addr()
+}
+
+// Port returns the TCP port that the amplifier is listening on, or zero if not listening.
+func (a *Amplifier) Port() uint16 {
+	addr, ok := a.Addr().(*net.TCPAddr)
+	if !ok {
+		return 0
+	}
+
+	return uint16(addr.Port) // #nosec G115 -- TCP ports always fit in uint16.
+}
+
+// Close stops listening and disconnects all clients.
+// Closing an already closed amplifier does nothing.
+func (a *Amplifier) Close() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.closed {
+		return nil
+	}
+
+	a.closed = true
+	if a.resetTimer != nil {
+		a.resetTimer.Stop()
+	}
+	a.disconnectClients()
+
+	if a.listener == nil {
+		return nil
+	}
+	return a.listener.Close()
+}
+
+// Model returns the device type that is being simulated.
+func (a *Amplifier) Model() device.Type {
+	return a.model
+}
+
+// State returns a copy of the current amplifier state.
+func (a *Amplifier) State() State {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.state
+}
+
+// SetPower changes the power state as if the front panel was used.
+func (a *Amplifier) SetPower(on bool) {
+	a.change(func() []byte { return a.applyPower(boolArgument(on)) })
+}
+
+// SetVolume changes the volume as if the front panel was used.
+// Values above 100 are capped.
+func (a *Amplifier) SetVolume(volume uint8) {
+	a.change(func() []byte { return a.applyVolume(strconv.Itoa(int(min(volume, 100)))) })
+}
+
+// SetMute changes the muting as if the front panel was used.
+func (a *Amplifier) SetMute(muted bool) {
+	a.change(func() []byte { return a.applyMute(boolArgument(muted)) })
+}
+
+// SetInput changes the input as if the front panel was used.
+func (a *Amplifier) SetInput(input device.Input) error {
+	if input == 0 || int(input) > a.inputs {
+		return errInvalidInput
+	}
+
+	a.change(func() []byte { return a.applyInput(strconv.Itoa(int(input))) })
+	return nil
+}
+
+// Reset makes the amplifier reset its network connections right away.
+func (a *Amplifier) Reset() {
+	a.lock.Lock()
+	clients := a.reset()
+	a.lock.Unlock()
+
+	sendReset(clients)
+}
+
+// HandleCommand makes the simulator respond to an extra command letter, like the
+// firmware specific commands of some models. Passing a nil handler removes it again.
+func (a *Amplifier) HandleCommand(command byte, handler CommandHandler) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if handler == nil {
+		delete(a.extra, command)
+		return
+	}
+
+	if a.extra == nil {
+		a.extra = map[byte]CommandHandler{}
+	}
+	a.extra[command] = handler
+}
+
+// Notify sends a notification with the given command and argument to all clients.
+func (a *Amplifier) Notify(command byte, argument string) {
+	resp := packet(command, argument)
+
+	a.lock.Lock()
+	recipients := a.recipients(nil, resp)
+	a.lock.Unlock()
+
+	send(resp, recipients)
+}
+
+var errInvalidInput = errors.New("unsupported input for device")
+
+type client struct {
+	conn      net.Conn
+	writeLock sync.Mutex
+}
+
+// write sends the packet to the client. A client that doesn't keep up with
+// reading is disconnected, so that it can't hold up the others for long.
+func (c *client) write(packet []byte) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	_ = c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := c.conn.Write(packet)
+	if err != nil {
+		_ = c.conn.Close()
+	}
+}
+
+func (a *Amplifier) handleClient(c *client) {
+	defer a.removeClient(c)
+
+	reader := bufio.NewReader(c.conn)
+	for {
+		packet, err := reader.ReadSlice('\r')
+		if err != nil {
+			if errors.Is(err, bufio.ErrBufferFull) {
+				c.write(errorPacket(errMalformed))
+				continue
+			}
+			return
+		}
+
+		a.lock.Lock()
+		resp, changed := a.handlePacket(packet)
+		var recipients []*client
+		if changed {
+			recipients = a.recipients(c, resp)
+		}
+		a.lock.Unlock()
+
+		c.write(resp)
+		send(resp, recipients)
+	}
+}
+
+func (a *Amplifier) removeClient(c *client) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	delete(a.clients, c)
+	_ = c.conn.Close()
+}
+
+func (a *Amplifier) isClosed() bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.closed
+}
+
+// change applies a state change made outside of the remote connections.
+// All clients are notified if the state changed.
+func (a *Amplifier) change(apply func() []byte) {
+	a.lock.Lock()
+	before := a.state
+	resp := apply()
+	var recipients []*client
+	if before != a.state {
+		recipients = a.recipients(nil, resp)
+	}
+	a.lock.Unlock()
+
+	send(resp, recipients)
+}
+
+// recipients returns the clients to notify of the packet, which are all
+// clients except the one that caused the change. The notification is sent
+// with [send] once the lock is released, as clients may be slow to read.
+// The lock must be held when calling this method.
+func (a *Amplifier) recipients(source *client, packet []byte) []*client {
+	if packet[1] == 'e' {
+		return nil
+	}
+
+	recipients := make([]*client, 0, len(a.clients))
+	for c := range a.clients {
+		if c != source {
+			recipients = append(recipients, c)
+		}
+	}
+
+	return recipients
+}
+
+// send writes the packet to each of the clients.
+// The lock must not be held when calling this function.
+func send(packet []byte, clients []*client) {
+	for _, c := range clients {
+		c.write(packet)
+	}
+}
+
+// reset drops all clients and returns them, to be passed to [sendReset]
+// once the lock is released.
+// The lock must be held when calling this method.
+func (a *Amplifier) reset() []*client {
+	if a.resetTimer != nil {
+		a.resetTimer.Stop()
+	}
+
+	a.state.ResetDelay = 0
+	a.state.ResetStopped = true
+
+	clients := make([]*client, 0, len(a.clients))
+	for c := range a.clients {
+		clients = append(clients, c)
+		delete(a.clients, c)
+	}
+
+	return clients
+}
+
+// sendReset sends a reset notification to the clients and closes their connections.
+// The lock must not be held when calling this function.
+func sendReset(clients []*client) {
+	send([]byte("-r.0\r"), clients)
+	for _, c := range clients {
+		_ = c.conn.Close()
+	}
+}
+
+// disconnectClients closes all client connections.
+// The lock must be held when calling this method.
+func (a *Amplifier) disconnectClients() {
+	for c := range a.clients {
+		_ = c.conn.Close()
+		delete(a.clients, c)
+	}
+}
+
+func (a *Amplifier) onResetTimer() {
+	a.lock.Lock()
+	if a.state.ResetStopped || a.closed {
+		a.lock.Unlock()
+		return
+	}
+
+	clients := a.reset()
+	a.lock.Unlock()
+
+	sendReset(clients)
+}
+
+func boolArgument(value bool) string {
+	if value {
+		return "1"
+	}
+	return "0"
+}
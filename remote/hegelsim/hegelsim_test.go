@@ -0,0 +1,275 @@
+package hegelsim
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/alecthomas/assert/v2"
+)
+
+type testClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (c *testClient) send(t *testing.T, packet string) string {
+	t.Helper()
+
+	_, err := c.conn.Write([]byte(packet))
+	assert.NoError(t, err)
+	return c.receive(t)
+}
+
+func (c *testClient) receive(t *testing.T) string {
+	t.Helper()
+
+	err := c.conn.SetReadDeadline(time.Now().Add(time.Second))
+	assert.NoError(t, err)
+
+	resp, err := c.reader.ReadString('\r')
+	assert.NoError(t, err)
+	return resp
+}
+
+func newTestAmplifier(t *testing.T, model device.Type) *Amplifier {
+	t.Helper()
+
+	amp, err := New(model)
+	assert.NoError(t, err)
+	assert.NoError(t, amp.Listen("127.0.0.1:0"))
+	t.Cleanup(func() { assert.NoError(t, amp.Close()) })
+	return amp
+}
+
+func newTestClient(t *testing.T, amp *Amplifier) *testClient {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", amp.Addr().String())
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return &testClient{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+func TestNewInvalidModel(t *testing.T) {
+	_, err := New(device.Type(-1))
+	assert.Error(t, err)
+}
+
+func TestCommands(t *testing.T) {
+	amp := newTestAmplifier(t, device.H95)
+	client := newTestClient(t, amp)
+
+	assert.Equal(t, "-p.0\r", client.send(t, "-p.?\r"))
+	assert.Equal(t, "-p.1\r", client.send(t, "-p.1\r"))
+	assert.Equal(t, "-p.0\r", client.send(t, "-p.t\r"))
+
+	assert.Equal(t, "-v.50\r", client.send(t, "-v.50\r"))
+	assert.Equal(t, "-v.51\r", client.send(t, "-v.u\r"))
+	assert.Equal(t, "-v.50\r", client.send(t, "-v.d\r"))
+	assert.Equal(t, "-v.50\r", client.send(t, "-v.?\r"))
+	assert.Equal(t, "-v.100\r", client.send(t, "-v.100\r"))
+	assert.Equal(t, "-v.100\r", client.send(t, "-v.u\r"))
+
+	assert.Equal(t, "-m.1\r", client.send(t, "-m.t\r"))
+	assert.Equal(t, "-m.0\r", client.send(t, "-m.0\r"))
+
+	assert.Equal(t, "-i.8\r", client.send(t, "-i.8\r"))
+	assert.Equal(t, "-i.8\r", client.send(t, "-i.?\r"))
+
+	assert.Equal(t, "-r.~\r", client.send(t, "-r.?\r"))
+	assert.Equal(t, "-r.3\r", client.send(t, "-r.3\r"))
+	assert.Equal(t, "-r.~\r", client.send(t, "-r.~\r"))
+
+	assert.Equal(t, State{Volume: 100, Input: 8, ResetStopped: true}, amp.State())
+}
+
+func TestErrors(t *testing.T) {
+	amp := newTestAmplifier(t, device.H95)
+	client := newTestClient(t, amp)
+
+	assert.Equal(t, "-e.1\r", client.send(t, "p.1\r"))
+	assert.Equal(t, "-e.1\r", client.send(t, "-p\r"))
+	assert.Equal(t, "-e.2\r", client.send(t, "-x.1\r"))
+	assert.Equal(t, "-e.3\r", client.send(t, "-p.2\r"))
+	assert.Equal(t, "-e.3\r", client.send(t, "-v.101\r"))
+	assert.Equal(t, "-e.3\r", client.send(t, "-i.0\r"))
+	assert.Equal(t, "-e.3\r", client.send(t, "-i.9\r"))
+	assert.Equal(t, "-e.3\r", client.send(t, "-r.256\r"))
+}
+
+func TestHandleCommand(t *testing.T) {
+	amp := newTestAmplifier(t, device.H95)
+	client := newTestClient(t, amp)
+
+	balance := "0"
+	amp.HandleCommand('b', func(argument string) (string, bool) {
+		if argument != "?" {
+			balance = argument
+		}
+		return balance, argument != "x"
+	})
+
+	assert.Equal(t, "-b.3\r", client.send(t, "-b.3\r"))
+	assert.Equal(t, "-b.3\r", client.send(t, "-b.?\r"))
+	assert.Equal(t, "-e.3\r", client.send(t, "-b.x\r"))
+
+	amp.Notify('b', "5")
+	assert.Equal(t, "-b.5\r", client.receive(t))
+
+	amp.HandleCommand('b', nil)
+	assert.Equal(t, "-e.2\r", client.send(t, "-b.?\r"))
+}
+
+func TestInputsPerModel(t *testing.T) {
+	amp := newTestAmplifier(t, device.H590)
+	client := newTestClient(t, amp)
+
+	assert.Equal(t, "-i.11\r", client.send(t, "-i.11\r"))
+	assert.Equal(t, "-e.3\r", client.send(t, "-i.12\r"))
+
+	assert.NoError(t, amp.SetInput(11))
+	assert.Error(t, amp.SetInput(12))
+}
+
+func TestNotifications(t *testing.T) {
+	amp := newTestAmplifier(t, device.H190)
+	sender := newTestClient(t, amp)
+	listener := newTestClient(t, amp)
+
+	assert.Equal(t, "-v.20\r", sender.send(t, "-v.20\r"))
+	assert.Equal(t, "-v.20\r", listener.receive(t))
+
+	// Queries and commands that change nothing are not broadcast.
+	assert.Equal(t, "-v.20\r", sender.send(t, "-v.?\r"))
+	assert.Equal(t, "-v.20\r", sender.send(t, "-v.20\r"))
+	assert.Equal(t, "-i.3\r", sender.send(t, "-i.3\r"))
+	assert.Equal(t, "-i.3\r", listener.receive(t))
+
+	amp.SetPower(true)
+	assert.Equal(t, "-p.1\r", sender.receive(t))
+	assert.Equal(t, "-p.1\r", listener.receive(t))
+
+	amp.SetVolume(200)
+	assert.Equal(t, "-v.100\r", sender.receive(t))
+	assert.Equal(t, "-v.100\r", listener.receive(t))
+
+	amp.SetMute(true)
+	assert.Equal(t, "-m.1\r", sender.receive(t))
+	assert.Equal(t, "-m.1\r", listener.receive(t))
+}
+
+func TestSplitAndCoalescedPackets(t *testing.T) {
+	amp := newTestAmplifier(t, device.H95)
+	client := newTestClient(t, amp)
+
+	_, err := client.conn.Write([]byte("-v."))
+	assert.NoError(t, err)
+	assert.Equal(t, "-v.42\r", client.send(t, "42\r"))
+
+	_, err = client.conn.Write([]byte("-p.1\r-m.1\r"))
+	assert.NoError(t, err)
+	assert.Equal(t, "-p.1\r", client.receive(t))
+	assert.Equal(t, "-m.1\r", client.receive(t))
+}
+
+func TestResetDelay(t *testing.T) {
+	amp, err := New(device.H95)
+	assert.NoError(t, err)
+	amp.ResetUnit = 10 * time.Millisecond
+	assert.NoError(t, amp.Listen("127.0.0.1:0"))
+	defer amp.Close()
+
+	sender := newTestClient(t, amp)
+	listener := newTestClient(t, amp)
+
+	assert.Equal(t, "-r.1\r", sender.send(t, "-r.1\r"))
+	assert.Equal(t, "-r.0\r", listener.receive(t))
+
+	_, err = listener.reader.ReadString('\r')
+	assert.Error(t, err)
+	assert.True(t, amp.State().ResetStopped)
+
+	// The amplifier keeps accepting connections after a reset.
+	client := newTestClient(t, amp)
+	assert.Equal(t, "-p.0\r", client.send(t, "-p.?\r"))
+}
+
+func TestReset(t *testing.T) {
+	amp := newTestAmplifier(t, device.H95)
+	client := newTestClient(t, amp)
+	assert.Equal(t, "-p.0\r", client.send(t, "-p.?\r"))
+
+	amp.Reset()
+	assert.Equal(t, "-r.0\r", client.receive(t))
+
+	_, err := client.reader.ReadString('\r')
+	assert.Error(t, err)
+}
+
+// pipeListener hands out in-memory connections, where writes wait for the other end to read.
+type pipeListener struct {
+	conns  chan net.Conn
+	closed chan struct{}
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{conns: make(chan net.Conn), closed: make(chan struct{})}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	close(l.closed)
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: "pipe", Net: "pipe"}
+}
+
+func (l *pipeListener) dial() net.Conn {
+	server, client := net.Pipe()
+	l.conns <- server
+	return client
+}
+
+func TestClientNotReading(t *testing.T) {
+	amp, err := New(device.H95)
+	assert.NoError(t, err)
+	listener := newPipeListener()
+	go amp.Serve(listener)
+	defer amp.Close()
+
+	conn := listener.dial()
+	defer conn.Close()
+	client := &testClient{conn: conn, reader: bufio.NewReader(conn)}
+	assert.Equal(t, "-p.0\r", client.send(t, "-p.?\r"))
+
+	// The client stops reading, which must not keep the state from being used.
+	changed := make(chan struct{})
+	go func() {
+		amp.SetVolume(30)
+		close(changed)
+	}()
+
+	start := time.Now()
+	for amp.State().Volume != 30 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.True(t, time.Since(start) < writeTimeout/2)
+
+	// The notification times out and the client is disconnected.
+	<-changed
+	_, err = client.reader.ReadString('\r')
+	assert.Error(t, err)
+}
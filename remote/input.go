@@ -1,6 +1,7 @@
 package remote
 
 import (
+	"context"
 	"errors"
 
 	"github.com/Jacalz/hegelmote/device"
@@ -11,29 +12,44 @@ var errInputIsZero = errors.New("input cannot be zero")
 // SetInputFromName tells the amplifier to switch to the corresponding source name.
 // The input name should match one for the given device type.
 func (c *Control) SetInputFromName(name string) (device.Input, error) {
+	return c.SetInputFromNameContext(context.Background(), name)
+}
+
+// SetInputFromNameContext is like [Control.SetInputFromName] but gives up when the context is done.
+func (c *Control) SetInputFromNameContext(ctx context.Context, name string) (device.Input, error) {
 	number, err := device.InputFromName(c.deviceType, name)
 	if err != nil {
 		return 0, err
 	}
 
-	return c.SetInput(number)
+	return c.SetInputContext(ctx, number)
 }
 
 // SetInput sets the input source to the given number.
 // This will fail if the source number does not exist on the device.
 func (c *Control) SetInput(number device.Input) (device.Input, error) {
+	return c.SetInputContext(context.Background(), number)
+}
+
+// SetInputContext is like [Control.SetInput] but gives up when the context is done.
+func (c *Control) SetInputContext(ctx context.Context, number device.Input) (device.Input, error) {
 	if number == 0 {
 		return 0, errInputIsZero
 	}
 
 	packet := createNumericalPacket('i', number)
-	return c.sendWithNumericalResponse(packet)
+	return c.sendWithNumericalResponse(ctx, packet)
 }
 
 // GetInputName returns the currently selected input source.
 // The source number will try to map number to a source name on the device type.
 func (c *Control) GetInputName() (string, error) {
-	input, err := c.GetInput()
+	return c.GetInputNameContext(context.Background())
+}
+
+// GetInputNameContext is like [Control.GetInputName] but gives up when the context is done.
+func (c *Control) GetInputNameContext(ctx context.Context) (string, error) {
+	input, err := c.GetInputContext(ctx)
 	if err != nil {
 		return "", err
 	}
@@ -43,5 +59,10 @@ func (c *Control) GetInputName() (string, error) {
 
 // GetInput returns the currently selected source number.
 func (c *Control) GetInput() (device.Input, error) {
-	return c.sendWithNumericalResponse([]byte("-i.?\r"))
+	return c.GetInputContext(context.Background())
+}
+
+// GetInputContext is like [Control.GetInput] but gives up when the context is done.
+func (c *Control) GetInputContext(ctx context.Context) (device.Input, error) {
+	return c.sendWithNumericalResponse(ctx, []byte("-i.?\r"))
 }
@@ -0,0 +1,171 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"maps"
+
+	"github.com/Jacalz/hegelmote/device"
+)
+
+// VolumeLimit is a ceiling for the volume, to protect speakers and ears.
+type VolumeLimit struct {
+	// Max is the highest volume allowed. Zero means no limit.
+	Max Volume
+
+	// PerInput overrides Max for specific inputs.
+	PerInput map[device.Input]Volume
+
+	// Clamp turns the volume back down to the limit when the amplifier
+	// reports a higher volume, like when using the IR remote. This is only
+	// done by [ControlWithListener], when connecting and when notified.
+	Clamp bool
+}
+
+// forInput returns the highest volume allowed for the given input.
+func (l *VolumeLimit) forInput(input device.Input) Volume {
+	if limit, ok := l.PerInput[input]; ok {
+		return limit
+	} else if l.Max == 0 {
+		return 100
+	}
+
+	return l.Max
+}
+
+// VolumeLimitError is returned when trying to set a volume above the limit.
+type VolumeLimitError struct {
+	Volume Volume
+	Limit  Volume
+
+	// Input is the input that the limit applies to, or zero if it applies to all inputs.
+	Input device.Input
+}
+
+// Error returns a description of the limit that was exceeded.
+func (e *VolumeLimitError) Error() string {
+	if e.Input != 0 {
+		return fmt.Sprintf("volume %d is above the limit of %d for input %d", e.Volume, e.Limit, e.Input)
+	}
+
+	return fmt.Sprintf("volume %d is above the limit of %d", e.Volume, e.Limit)
+}
+
+// SetVolumeLimit sets a limit that SetVolume and VolumeUp refuse to go above.
+// Passing nil removes the limit.
+func (c *Control) SetVolumeLimit(limit *VolumeLimit) {
+	if limit == nil {
+		c.limit.Store(nil)
+		return
+	}
+
+	limitCopy := *limit
+	limitCopy.PerInput = maps.Clone(limit.PerInput)
+	c.limit.Store(&limitCopy)
+}
+
+// GetVolumeLimit returns the current volume limit, or nil if there is none.
+func (c *Control) GetVolumeLimit() *VolumeLimit {
+	return c.limit.Load()
+}
+
+// volumeLimit returns the limit for the currently selected input. The input is only
+// fetched from the amplifier when there are limits per input and it isn't already known.
+func (c *Control) volumeLimit(ctx context.Context) (Volume, device.Input, error) {
+	limit := c.limit.Load()
+	if limit == nil {
+		return 100, 0, nil
+	} else if len(limit.PerInput) == 0 {
+		return limit.forInput(0), 0, nil
+	}
+
+	input, known := device.Input(0), false
+	if c.knownInput != nil {
+		input, known = c.knownInput()
+	}
+
+	if !known {
+		var err error
+		input, err = c.GetInputContext(ctx)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if _, ok := limit.PerInput[input]; !ok {
+		input = 0
+	}
+
+	return limit.forInput(input), input, nil
+}
+
+// currentVolume returns the volume to step up from. It is only fetched
+// from the amplifier when it isn't already known.
+func (c *Control) currentVolume(ctx context.Context) (Volume, error) {
+	if c.knownVolume != nil {
+		if volume, known := c.knownVolume(); known {
+			return volume, nil
+		}
+	}
+
+	return c.GetVolumeContext(ctx)
+}
+
+// checkVolumeLimit returns a [*VolumeLimitError] if the volume is above the limit.
+func (c *Control) checkVolumeLimit(ctx context.Context, volume Volume) error {
+	limit, input, err := c.volumeLimit(ctx)
+	if err != nil {
+		return err
+	} else if volume > limit {
+		return &VolumeLimitError{Volume: volume, Limit: limit, Input: input}
+	}
+
+	return nil
+}
+
+// clampVolume turns the volume down if it is above the limit and clamping is enabled.
+// The resulting volume is returned.
+func (c *Control) clampVolume(ctx context.Context, volume Volume) (Volume, error) {
+	if limit := c.limit.Load(); limit == nil || !limit.Clamp {
+		return volume, nil
+	}
+
+	limit, _, err := c.volumeLimit(ctx)
+	if err != nil || volume <= limit {
+		return volume, err
+	}
+
+	return c.sendWithNumericalResponse(ctx, createNumericalPacket('v', limit))
+}
+
+// SetVolumeLimit sets a limit that SetVolume and VolumeUp refuse to go above.
+// Passing nil removes the limit. If clamping is enabled, the volume is
+// turned down whenever the amplifier reports a volume above the limit.
+func (c *ControlWithListener) SetVolumeLimit(limit *VolumeLimit) {
+	c.control.SetVolumeLimit(limit)
+	go c.reportVolumeLimitError()
+}
+
+// GetVolumeLimit returns the current volume limit, or nil if there is none.
+func (c *ControlWithListener) GetVolumeLimit() *VolumeLimit {
+	return c.control.GetVolumeLimit()
+}
+
+// enforceVolumeLimit clamps the last known volume to the limit if needed.
+func (c *ControlWithListener) enforceVolumeLimit(ctx context.Context) error {
+	state := c.Snapshot()
+	if state.VolumeUpdated.IsZero() || c.GetConnectionState() != Connected {
+		return nil
+	}
+
+	_, err := c.control.clampVolume(ctx, state.Volume)
+	return err
+}
+
+// reportVolumeLimitError enforces the volume limit and reports any error to the callbacks.
+func (c *ControlWithListener) reportVolumeLimitError() {
+	err := c.enforceVolumeLimit(context.Background())
+	if err != nil {
+		c.emit(ErrorReceived{Err: err})
+	}
+}
@@ -0,0 +1,174 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestVolumeLimit(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+	amp.SetVolume(39)
+	control := connectToSimulator(t, amp)
+
+	control.SetVolumeLimit(&VolumeLimit{Max: 40})
+
+	_, err := control.SetVolume(41)
+	limitErr := &VolumeLimitError{}
+	assert.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, VolumeLimitError{Volume: 41, Limit: 40}, *limitErr)
+	assert.Equal(t, 39, amp.State().Volume)
+
+	volume, err := control.VolumeUp()
+	assert.NoError(t, err)
+	assert.Equal(t, 40, volume)
+
+	_, err = control.VolumeUp()
+	assert.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, 40, amp.State().Volume)
+
+	volume, err = control.VolumeDown()
+	assert.NoError(t, err)
+	assert.Equal(t, 39, volume)
+
+	control.SetVolumeLimit(nil)
+	assert.Zero(t, control.GetVolumeLimit())
+	volume, err = control.SetVolume(100)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, volume)
+}
+
+func TestVolumeLimitPerInput(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+	control := connectToSimulator(t, amp)
+
+	limit := &VolumeLimit{Max: 60, PerInput: map[device.Input]Volume{2: 30}}
+	control.SetVolumeLimit(limit)
+	limit.PerInput[2] = 90 // The limit is copied when set.
+
+	_, err := control.SetVolume(60)
+	assert.NoError(t, err)
+
+	_, err = control.SetInput(2)
+	assert.NoError(t, err)
+
+	_, err = control.SetVolume(31)
+	limitErr := &VolumeLimitError{}
+	assert.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, VolumeLimitError{Volume: 31, Limit: 30, Input: 2}, *limitErr)
+	assert.Contains(t, err.Error(), "input 2")
+
+	_, err = control.SetVolume(30)
+	assert.NoError(t, err)
+}
+
+func TestVolumeLimitGetDoesNotClamp(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+	amp.SetVolume(80)
+	control := connectToSimulator(t, amp)
+
+	control.SetVolumeLimit(&VolumeLimit{Max: 50, Clamp: true})
+	volume, err := control.GetVolume()
+	assert.NoError(t, err)
+	assert.Equal(t, 80, volume)
+	assert.Equal(t, 80, amp.State().Volume)
+}
+
+func TestListenerVolumeLimitClampOnConnect(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+	amp.SetVolume(80)
+
+	control := NewControlWithListener(nil, nil, nil, nil, nil, func(err error) { t.Errorf("unexpected error: %v", err) })
+	control.SetVolumeLimit(&VolumeLimit{Max: 50, Clamp: true})
+	err := control.ConnectWithConfig(context.Background(), "127.0.0.1", amp.Model(), ConnectConfig{Port: amp.Port()})
+	assert.NoError(t, err)
+	defer control.Disconnect()
+
+	assert.Equal(t, 50, amp.State().Volume)
+	assert.Equal(t, 50, control.Snapshot().Volume)
+
+	volume, err := control.GetVolume()
+	assert.NoError(t, err)
+	assert.Equal(t, 50, volume)
+}
+
+func TestListenerVolumeLimitPerInputUsesState(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+	assert.NoError(t, amp.SetInput(2))
+	control := listenToSimulator(t, amp)
+	control.SetVolumeLimit(&VolumeLimit{Max: 60, PerInput: map[device.Input]Volume{2: 30}})
+
+	var sent []string
+	control.SetTracer(func(event TraceEvent) {
+		if event.Direction == TraceSent {
+			sent = append(sent, event.Packet)
+		}
+	})
+
+	_, err := control.SetVolume(31)
+	limitErr := &VolumeLimitError{}
+	assert.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, VolumeLimitError{Volume: 31, Limit: 30, Input: 2}, *limitErr)
+
+	_, err = control.SetVolume(30)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-v.30"}, sent)
+}
+
+func TestListenerVolumeUpUsesState(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+	amp.SetVolume(39)
+	control := listenToSimulator(t, amp)
+	control.SetVolumeLimit(&VolumeLimit{Max: 40})
+
+	var sent []string
+	control.SetTracer(func(event TraceEvent) {
+		if event.Direction == TraceSent {
+			sent = append(sent, event.Packet)
+		}
+	})
+
+	volume, err := control.VolumeUp()
+	assert.NoError(t, err)
+	assert.Equal(t, 40, volume)
+
+	volume, err = control.VolumeUp()
+	limitErr := &VolumeLimitError{}
+	assert.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, 40, volume)
+	assert.Equal(t, []string{"-v.u"}, sent)
+}
+
+func TestListenerVolumeLimitClamp(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+	amp.SetVolume(70)
+	control := listenToSimulator(t, amp)
+	observer := listenToSimulator(t, amp)
+	events := observer.Subscribe(context.Background())
+
+	// Setting a clamped limit turns down the current volume right away.
+	control.SetVolumeLimit(&VolumeLimit{Max: 50, PerInput: map[device.Input]Volume{3: 20}, Clamp: true})
+	assertEvent(t, events, VolumeChanged{Volume: 50})
+
+	// Changes from the IR remote are clamped back down.
+	amp.SetVolume(90)
+	assertEvent(t, events, VolumeChanged{Volume: 90})
+	assertEvent(t, events, VolumeChanged{Volume: 50})
+
+	// Selecting an input with a lower limit also clamps.
+	assert.NoError(t, amp.SetInput(3))
+	assertEvent(t, events, InputChanged{Input: 3})
+	assertEvent(t, events, VolumeChanged{Volume: 20})
+
+	for deadline := time.Now().Add(time.Second); control.Snapshot().Volume != 20; {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the clamped volume")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 20, amp.State().Volume)
+}
@@ -1,8 +1,8 @@
 package remote
 
 import (
-	"fmt"
-	"io"
+	"context"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -27,6 +27,9 @@ func NewControlWithListener(
 		OnReset:        onReset,
 		OnError:        onError,
 	}
+	c.control.exchange = c.exchange
+	c.control.knownInput = c.knownInput
+	c.control.knownVolume = c.knownVolume
 
 	c.resetTicker.Stop()
 	go c.runResetLoop()
@@ -37,6 +40,9 @@ func NewControlWithListener(
 // sent from the amplifier. It also sends a reset to the amplifier with
 // a fixed delay to allow reconnecting in case of error.
 // This data type is thread safe.
+//
+// Changes are passed to the callbacks, which may be nil, and then to
+// every channel returned by [ControlWithListener.Subscribe].
 type ControlWithListener struct {
 	control Control
 
@@ -47,9 +53,30 @@ type ControlWithListener struct {
 	OnReset        func()
 	OnError        func(err error)
 
+	// OnConnectionState, if set, is called when the state of the connection changes.
+	OnConnectionState func(state ConnectionState)
+
+	// Reconnect, if set, makes the controller reconnect when the connection is lost.
+	// The state is fetched again after reconnecting and the change callbacks are
+	// called for anything that changed while being disconnected.
+	// It should be set before connecting.
+	Reconnect *ReconnectPolicy
+
 	resetTicker *time.Ticker
-	sending     atomic.Bool
 	closing     atomic.Bool
+	connState   atomic.Int32
+
+	lock    sync.Mutex
+	session *session
+	stop    chan struct{}
+	host    string
+	config  ConnectConfig
+
+	stateLock sync.Mutex
+	state     State
+
+	subscribers subscribers[Event]
+	memory      atomic.Pointer[volumeMemory]
 }
 
 // GetDeviceType returns the device type of the currently connected amplifier.
@@ -59,124 +86,227 @@ func (c *ControlWithListener) GetDeviceType() device.Type {
 
 // Connect connects to the amplifier and starts the listener.
 func (c *ControlWithListener) Connect(host string, model device.Type) error {
-	err := c.control.Connect(host, model)
+	return c.ConnectWithConfig(context.Background(), host, model, ConnectConfig{})
+}
+
+// ConnectWithConfig connects to the amplifier using the given configuration and starts the listener.
+// The state of the amplifier is fetched before returning, see [ControlWithListener.Snapshot].
+func (c *ControlWithListener) ConnectWithConfig(ctx context.Context, host string, model device.Type, config ConnectConfig) error {
+	c.setConnectionState(Connecting)
+
+	c.lock.Lock()
+	err := c.control.ConnectWithConfig(ctx, host, model, config)
 	if err != nil {
+		c.lock.Unlock()
+		c.setConnectionState(Disconnected)
 		return err
 	}
 
-	c.closing.Store(false)
+	c.stop = make(chan struct{})
+	c.host = host
+	c.config = config
+	c.lock.Unlock()
 
-	wrappedConn := &listenerConn{ReadWriteCloser: c.control.conn, reads: make(chan readResponse)}
-	c.control.conn = wrappedConn
-	go c.runChangeListener(wrappedConn)
+	c.closing.Store(false)
+	c.startSession(c.control.conn, c.control.packets)
+	c.setConnectionState(Connected)
 
 	c.resetTicker.Reset(resetInterval)
-	_, err = c.SetResetDelay(3)
-	return err
+	_, err = c.SetResetDelayContext(ctx, 3)
+	if err == nil {
+		err = c.fetchState(ctx)
+	}
+
+	if err != nil {
+		// Nothing should be left running, or reported as connected, after failing.
+		_ = c.Disconnect()
+		return err
+	}
+
+	return nil
 }
 
 // Disconnect disconnects from the amplifier and stops the listener.
+// Any ongoing attempts to reconnect are stopped as well.
 func (c *ControlWithListener) Disconnect() error {
 	c.resetTicker.Stop()
 	c.closing.Store(true)
-	return c.control.Disconnect()
+
+	c.lock.Lock()
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+	err := c.control.Disconnect()
+	c.lock.Unlock()
+
+	c.setConnectionState(Disconnected)
+	return err
 }
 
 // SetPower sets the amplifier to be on or off depending on the passed bool value.
 func (c *ControlWithListener) SetPower(on bool) (bool, error) {
-	return sendWithArgument(&c.sending, c.control.SetPower, on)
+	return c.SetPowerContext(context.Background(), on)
+}
+
+// SetPowerContext is like [ControlWithListener.SetPower] but gives up when the context is done.
+func (c *ControlWithListener) SetPowerContext(ctx context.Context, on bool) (bool, error) {
+	return c.control.SetPowerContext(ctx, on)
 }
 
 // TogglePower toggles between on or off given the current state.
 func (c *ControlWithListener) TogglePower() (bool, error) {
-	return send(&c.sending, c.control.TogglePower)
+	return c.TogglePowerContext(context.Background())
+}
+
+// TogglePowerContext is like [ControlWithListener.TogglePower] but gives up when the context is done.
+func (c *ControlWithListener) TogglePowerContext(ctx context.Context) (bool, error) {
+	return c.control.TogglePowerContext(ctx)
 }
 
 // GetPower returns the current power status.
 func (c *ControlWithListener) GetPower() (bool, error) {
-	return send(&c.sending, c.control.GetPower)
+	return c.GetPowerContext(context.Background())
+}
+
+// GetPowerContext is like [ControlWithListener.GetPower] but gives up when the context is done.
+func (c *ControlWithListener) GetPowerContext(ctx context.Context) (bool, error) {
+	return c.control.GetPowerContext(ctx)
 }
 
 // SetVolumeMute sets the amplifier to be muted or unmuted given the passed bool value.
 func (c *ControlWithListener) SetVolumeMute(muted bool) (bool, error) {
-	return sendWithArgument(&c.sending, c.control.SetVolumeMute, muted)
+	return c.SetVolumeMuteContext(context.Background(), muted)
+}
+
+// SetVolumeMuteContext is like [ControlWithListener.SetVolumeMute] but gives up when the context is done.
+func (c *ControlWithListener) SetVolumeMuteContext(ctx context.Context, muted bool) (bool, error) {
+	return c.control.SetVolumeMuteContext(ctx, muted)
 }
 
 // ToggleVolumeMute toggles the volume between muted and unmuted given current state.
 func (c *ControlWithListener) ToggleVolumeMute() (bool, error) {
-	return send(&c.sending, c.control.ToggleVolumeMute)
+	return c.ToggleVolumeMuteContext(context.Background())
+}
+
+// ToggleVolumeMuteContext is like [ControlWithListener.ToggleVolumeMute] but gives up when the context is done.
+func (c *ControlWithListener) ToggleVolumeMuteContext(ctx context.Context) (bool, error) {
+	return c.control.ToggleVolumeMuteContext(ctx)
 }
 
 // GetVolumeMute returns the curren state of volume being muted or not.
 func (c *ControlWithListener) GetVolumeMute() (bool, error) {
-	return send(&c.sending, c.control.GetVolumeMute)
+	return c.GetVolumeMuteContext(context.Background())
+}
+
+// GetVolumeMuteContext is like [ControlWithListener.GetVolumeMute] but gives up when the context is done.
+func (c *ControlWithListener) GetVolumeMuteContext(ctx context.Context) (bool, error) {
+	return c.control.GetVolumeMuteContext(ctx)
 }
 
 // SetVolume sets the volume to the given value.
 func (c *ControlWithListener) SetVolume(volume Volume) (Volume, error) {
-	return sendWithArgument(&c.sending, c.control.SetVolume, volume)
+	return c.SetVolumeContext(context.Background(), volume)
+}
+
+// SetVolumeContext is like [ControlWithListener.SetVolume] but gives up when the context is done.
+func (c *ControlWithListener) SetVolumeContext(ctx context.Context, volume Volume) (Volume, error) {
+	return c.control.SetVolumeContext(ctx, volume)
 }
 
 // VolumeDown decreases the volume one step.
 func (c *ControlWithListener) VolumeDown() (Volume, error) {
-	return send(&c.sending, c.control.VolumeDown)
+	return c.VolumeDownContext(context.Background())
+}
+
+// VolumeDownContext is like [ControlWithListener.VolumeDown] but gives up when the context is done.
+func (c *ControlWithListener) VolumeDownContext(ctx context.Context) (Volume, error) {
+	return c.control.VolumeDownContext(ctx)
 }
 
 // VolumeUp increases the volume one step.
 func (c *ControlWithListener) VolumeUp() (Volume, error) {
-	return send(&c.sending, c.control.VolumeUp)
+	return c.VolumeUpContext(context.Background())
+}
+
+// VolumeUpContext is like [ControlWithListener.VolumeUp] but gives up when the context is done.
+func (c *ControlWithListener) VolumeUpContext(ctx context.Context) (Volume, error) {
+	return c.control.VolumeUpContext(ctx)
 }
 
 // GetVolume returns the current volume value.
 func (c *ControlWithListener) GetVolume() (Volume, error) {
-	return send(&c.sending, c.control.GetVolume)
+	return c.GetVolumeContext(context.Background())
+}
+
+// GetVolumeContext is like [ControlWithListener.GetVolume] but gives up when the context is done.
+func (c *ControlWithListener) GetVolumeContext(ctx context.Context) (Volume, error) {
+	return c.control.GetVolumeContext(ctx)
 }
 
 // SetInput sets the input to the given value.
 func (c *ControlWithListener) SetInput(input device.Input) (device.Input, error) {
-	return sendWithArgument(&c.sending, c.control.SetInput, input)
+	return c.SetInputContext(context.Background(), input)
+}
+
+// SetInputContext is like [ControlWithListener.SetInput] but gives up when the context is done.
+func (c *ControlWithListener) SetInputContext(ctx context.Context, input device.Input) (device.Input, error) {
+	return c.control.SetInputContext(ctx, input)
 }
 
 // GetInput returns the currently selected input.
 func (c *ControlWithListener) GetInput() (device.Input, error) {
-	return send(&c.sending, c.control.GetInput)
+	return c.GetInputContext(context.Background())
+}
+
+// GetInputContext is like [ControlWithListener.GetInput] but gives up when the context is done.
+func (c *ControlWithListener) GetInputContext(ctx context.Context) (device.Input, error) {
+	return c.control.GetInputContext(ctx)
 }
 
 // SetResetDelay sets a timeout in minutes for when to reset the connection.
 func (c *ControlWithListener) SetResetDelay(delay Minutes) (Delay, error) {
-	return sendWithArgument(&c.sending, c.control.SetResetDelay, delay)
+	return c.SetResetDelayContext(context.Background(), delay)
+}
+
+// SetResetDelayContext is like [ControlWithListener.SetResetDelay] but gives up when the context is done.
+func (c *ControlWithListener) SetResetDelayContext(ctx context.Context, delay Minutes) (Delay, error) {
+	return c.control.SetResetDelayContext(ctx, delay)
 }
 
 // StopResetDelay stops the reset delay from ticking down.
 func (c *ControlWithListener) StopResetDelay() (Delay, error) {
-	return send(&c.sending, c.control.StopResetDelay)
+	return c.StopResetDelayContext(context.Background())
+}
+
+// StopResetDelayContext is like [ControlWithListener.StopResetDelay] but gives up when the context is done.
+func (c *ControlWithListener) StopResetDelayContext(ctx context.Context) (Delay, error) {
+	return c.control.StopResetDelayContext(ctx)
 }
 
 // GetResetDelay returns the current delay for reset.
 func (c *ControlWithListener) GetResetDelay() (Delay, error) {
-	return send(&c.sending, c.control.GetResetDelay)
+	return c.GetResetDelayContext(context.Background())
 }
 
-func (c *ControlWithListener) waitForResponse(conn *listenerConn) error {
-	buf := [len("-v.100\r")]byte{}
-	n, err := conn.ReadWriteCloser.Read(buf[:])
-	if c.sending.CompareAndSwap(true, false) {
-		conn.reads <- readResponse{n: n, buf: buf[:], err: err}
-		return nil
-	} else if err != nil {
-		return err
-	}
+// GetResetDelayContext is like [ControlWithListener.GetResetDelay] but gives up when the context is done.
+func (c *ControlWithListener) GetResetDelayContext(ctx context.Context) (Delay, error) {
+	return c.control.GetResetDelayContext(ctx)
+}
 
-	resp, err := c.control.verifyResponse(buf, n)
+// handleNotification passes on a change notification from the amplifier to the callbacks.
+// The state has already been updated by the session when this is called.
+func (c *ControlWithListener) handleNotification(packet []byte) error {
+	resp, err := verifyResponse(packet)
 	if err != nil {
 		return err
 	}
 
 	switch resp[1] {
 	case 'p':
-		c.OnPowerChange(resp[3] == '1')
+		c.emit(PowerChanged{PoweredOn: resp[3] == '1'})
 	case 'm':
-		c.OnMuteChange(resp[3] == '1')
+		c.emit(MuteChanged{Muted: resp[3] == '1'})
 	case 'v', 'i':
 		number, err := parseUint8FromBuf(resp)
 		if err != nil {
@@ -184,67 +314,35 @@ func (c *ControlWithListener) waitForResponse(conn *listenerConn) error {
 		}
 
 		if resp[1] == 'v' {
-			c.OnVolumeChange(number)
+			c.emit(VolumeChanged{Volume: number})
 		} else {
-			c.OnInputChange(number)
+			c.emit(InputChanged{Input: number})
+		}
+
+		// The callbacks may send commands, so the volume can be clamped from here as well.
+		if limit := c.control.limit.Load(); limit != nil && limit.Clamp {
+			return c.enforceVolumeLimit(context.Background())
 		}
 	case 'r':
 		if resp[3] == '0' {
-			c.OnReset()
+			c.emit(ResetReceived{})
 		}
-	case 'e':
-		return errorFromCode(resp[3])
 	default:
-		return fmt.Errorf("received unknown command \"%c\" from amplifier", resp[1])
+		return c.handleCommandNotification(resp)
 	}
 
 	return nil
 }
 
-func (c *ControlWithListener) runChangeListener(conn *listenerConn) {
-	for {
-		err := c.waitForResponse(conn)
-		if err != nil {
-			if !c.closing.Load() {
-				c.OnError(err)
-			}
-			return
-		}
-	}
-}
-
 func (c *ControlWithListener) runResetLoop() {
 	for range c.resetTicker.C {
+		if c.GetConnectionState() != Connected {
+			continue
+		}
+
 		_, err := c.SetResetDelay(3)
 		if err != nil {
-			c.OnError(err)
+			c.emit(ErrorReceived{Err: err})
 		}
 	}
 }
-
-type readResponse struct {
-	buf []byte
-	n   int
-	err error
-}
-
-type listenerConn struct {
-	io.ReadWriteCloser
-	reads chan readResponse
-}
-
-func (l *listenerConn) Read(p []byte) (int, error) {
-	got := <-l.reads
-	copy(p, got.buf)
-	return got.n, got.err
-}
-
-func send[T any](sending *atomic.Bool, cmd func() (T, error)) (T, error) {
-	sending.Store(true)
-	return cmd()
-}
-
-func sendWithArgument[T, U any](sending *atomic.Bool, cmd func(U) (T, error), input U) (T, error) {
-	sending.Store(true)
-	return cmd(input)
-}
@@ -0,0 +1,118 @@
+package remote
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/alecthomas/assert/v2"
+)
+
+func newListenerPipe(t *testing.T, onVolume func(Volume)) (*ControlWithListener, net.Conn) {
+	t.Helper()
+
+	client, amplifier := net.Pipe()
+	control := NewControlWithListener(
+		func(bool) {}, onVolume, func(bool) {}, func(device.Input) {}, func() {}, func(error) {},
+	)
+	control.control.setConn(client)
+	control.control.deviceType = device.H95
+	control.startSession(client, control.control.packets)
+
+	t.Cleanup(func() {
+		assert.NoError(t, control.Disconnect())
+		amplifier.Close()
+	})
+	return control, amplifier
+}
+
+func TestListenerContextTimeout(t *testing.T) {
+	volumes := make(chan Volume, 1)
+	control, amplifier := newListenerPipe(t, func(v Volume) { volumes <- v })
+	reader := bufio.NewReader(amplifier)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	received := make(chan struct{})
+	go func() {
+		_, _ = reader.ReadString('\r')
+		close(received)
+	}()
+
+	_, err := control.GetVolumeContext(ctx)
+	timeout := &TimeoutError{}
+	assert.True(t, errors.As(err, &timeout))
+	assert.IsError(t, err, context.DeadlineExceeded)
+
+	<-received
+
+	// A response arriving too late is handled as a notification.
+	_, err = amplifier.Write([]byte("-v.30\r"))
+	assert.NoError(t, err)
+	assert.Equal(t, 30, <-volumes)
+
+	go func() {
+		_, _ = reader.ReadString('\r')
+		_, _ = amplifier.Write([]byte("-v.31\r"))
+	}()
+
+	volume, err := control.GetVolume()
+	assert.NoError(t, err)
+	assert.Equal(t, 31, volume)
+}
+
+func TestListenerCoalescedNotifications(t *testing.T) {
+	volumes := make(chan Volume, 2)
+	_, amplifier := newListenerPipe(t, func(v Volume) { volumes <- v })
+
+	_, err := amplifier.Write([]byte("-v.30\r-v."))
+	assert.NoError(t, err)
+	_, err = amplifier.Write([]byte("31\r"))
+	assert.NoError(t, err)
+
+	assert.Equal(t, 30, <-volumes)
+	assert.Equal(t, 31, <-volumes)
+}
+
+func TestListenerConnectFailureTearsDown(t *testing.T) {
+	// The first connection fails while fetching the state and the second one succeeds.
+	replay := newReplay(t, `
+connect "amp:50001"
+send "-r.3\r"
+recv "-r.3\r"
+send "-p.?\r"
+recv "-e.2\r"
+close
+connect "amp:50001"
+send "-r.3\r"
+recv "-r.3\r"
+send "-p.?\r"
+recv "-p.1\r"
+send "-v.?\r"
+recv "-v.20\r"
+send "-m.?\r"
+recv "-m.0\r"
+send "-i.?\r"
+recv "-i.2\r"
+`)
+
+	control := NewControlWithListener(nil, nil, nil, nil, nil, func(err error) { t.Errorf("unexpected error: %v", err) })
+	err := control.ConnectWithConfig(context.Background(), "amp", device.H95, ConnectConfig{Dial: replay.Dial})
+	assert.EqualError(t, err, "unknown command")
+	assert.Equal(t, Disconnected, control.GetConnectionState())
+
+	_, err = control.GetVolume()
+	assert.Error(t, err)
+
+	err = control.ConnectWithConfig(context.Background(), "amp", device.H95, ConnectConfig{Dial: replay.Dial})
+	assert.NoError(t, err)
+	defer control.Disconnect()
+
+	assert.Equal(t, Connected, control.GetConnectionState())
+	assert.Equal(t, 20, control.Snapshot().Volume)
+}
@@ -0,0 +1,218 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/Jacalz/hegelmote/device"
+)
+
+// AmplifierEvent is an event from one of the amplifiers held by a [Manager].
+type AmplifierEvent struct {
+	// Name is the name that the amplifier was added with.
+	Name string
+
+	Event Event
+}
+
+// GroupResult holds the result of a group command for each amplifier, by name.
+// The error is nil for the amplifiers where the command succeeded.
+type GroupResult map[string]error
+
+// Err returns the errors of all failed amplifiers joined together, or nil if none failed.
+func (r GroupResult) Err() error {
+	errs := []error{}
+	for _, name := range slices.Sorted(maps.Keys(r)) {
+		if err := r[name]; err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Manager holds connections to several named amplifiers. Each amplifier is connected,
+// monitored and reconnected independently of the others.
+// This data type is thread safe.
+type Manager struct {
+	// Reconnect is the policy used for reconnecting amplifiers added after it is set.
+	// Nil uses the defaults of [ReconnectPolicy].
+	Reconnect *ReconnectPolicy
+
+	lock       sync.Mutex
+	amplifiers map[string]*managedAmplifier
+
+	subscribers subscribers[AmplifierEvent]
+}
+
+type managedAmplifier struct {
+	control *ControlWithListener
+	stop    context.CancelFunc
+
+	// cancelConnect gives up connecting when the amplifier is removed while being added.
+	cancelConnect context.CancelFunc
+}
+
+// NewManager returns a manager without any amplifiers.
+func NewManager() *Manager {
+	return &Manager{amplifiers: map[string]*managedAmplifier{}}
+}
+
+// Add connects to an amplifier and holds it under the given name.
+// The name is taken while connecting. The amplifier is not added if the connection
+// fails or if it is removed before the connection is done.
+func (m *Manager) Add(ctx context.Context, name, host string, model device.Type, config ConnectConfig) error {
+	control := NewControlWithListener(nil, nil, nil, nil, nil, nil)
+	control.Reconnect = m.Reconnect
+	if control.Reconnect == nil {
+		control.Reconnect = &ReconnectPolicy{}
+	}
+
+	connectCtx, cancelConnect := context.WithCancel(ctx)
+	defer cancelConnect()
+
+	forwardCtx, stop := context.WithCancel(context.Background())
+	amp := &managedAmplifier{control: control, stop: stop, cancelConnect: cancelConnect}
+
+	m.lock.Lock()
+	if _, ok := m.amplifiers[name]; ok {
+		m.lock.Unlock()
+		stop()
+		return fmt.Errorf("amplifier %q has already been added", name)
+	}
+	m.amplifiers[name] = amp
+	m.lock.Unlock()
+
+	events := control.SubscribeWithConfig(forwardCtx, followConfig)
+	go control.follow(forwardCtx, events, func(event Event) {
+		m.subscribers.publish(AmplifierEvent{Name: name, Event: event})
+	})
+
+	err := control.ConnectWithConfig(connectCtx, host, model, config)
+
+	// The name may have been removed, and even added again, while connecting.
+	m.lock.Lock()
+	removed := m.amplifiers[name] != amp
+	if err != nil && !removed {
+		delete(m.amplifiers, name)
+	}
+	m.lock.Unlock()
+
+	if err == nil && !removed {
+		return nil
+	}
+
+	_ = control.Disconnect()
+	stop()
+	if removed {
+		return fmt.Errorf("amplifier %q was removed while connecting", name)
+	}
+	return err
+}
+
+// Remove disconnects from the amplifier with the given name and stops holding it.
+// An amplifier that is still being added stops connecting.
+func (m *Manager) Remove(name string) error {
+	m.lock.Lock()
+	amp, ok := m.amplifiers[name]
+	delete(m.amplifiers, name)
+	m.lock.Unlock()
+
+	if !ok {
+		return fmt.Errorf("no amplifier named %q", name)
+	}
+
+	amp.cancelConnect()
+	err := amp.control.Disconnect()
+	amp.stop()
+	return err
+}
+
+// Close disconnects from and removes all amplifiers.
+func (m *Manager) Close() error {
+	errs := []error{}
+	for _, name := range m.Names() {
+		errs = append(errs, m.Remove(name))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Get returns the amplifier with the given name.
+func (m *Manager) Get(name string) (*ControlWithListener, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	amp, ok := m.amplifiers[name]
+	if !ok {
+		return nil, false
+	}
+
+	return amp.control, true
+}
+
+// Names returns the names of all amplifiers in sorted order.
+func (m *Manager) Names() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return slices.Sorted(maps.Keys(m.amplifiers))
+}
+
+// Run calls the function for every amplifier concurrently and returns once all are done.
+func (m *Manager) Run(ctx context.Context, run func(ctx context.Context, name string, amp *ControlWithListener) error) GroupResult {
+	m.lock.Lock()
+	amplifiers := maps.Clone(m.amplifiers)
+	m.lock.Unlock()
+
+	resultLock := sync.Mutex{}
+	result := make(GroupResult, len(amplifiers))
+
+	wg := sync.WaitGroup{}
+	for name, amp := range amplifiers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := run(ctx, name, amp.control)
+			resultLock.Lock()
+			result[name] = err
+			resultLock.Unlock()
+		}()
+	}
+
+	wg.Wait()
+	return result
+}
+
+// SetPowerAll turns all amplifiers on or off at once.
+func (m *Manager) SetPowerAll(ctx context.Context, on bool) GroupResult {
+	return m.Run(ctx, func(ctx context.Context, _ string, amp *ControlWithListener) error {
+		_, err := amp.SetPowerContext(ctx, on)
+		return err
+	})
+}
+
+// SetVolumeMuteAll mutes or unmutes all amplifiers at once.
+func (m *Manager) SetVolumeMuteAll(ctx context.Context, muted bool) GroupResult {
+	return m.Run(ctx, func(ctx context.Context, _ string, amp *ControlWithListener) error {
+		_, err := amp.SetVolumeMuteContext(ctx, muted)
+		return err
+	})
+}
+
+// Subscribe returns a channel that receives the events of all amplifiers, tagged with
+// the name of the amplifier, until the context is done. See [ControlWithListener.Subscribe].
+// Events are never waited on by the amplifiers. If the events of an amplifier fall behind,
+// the missed ones are replaced by its current state, followed by [Resynced].
+func (m *Manager) Subscribe(ctx context.Context) <-chan AmplifierEvent {
+	return m.SubscribeWithConfig(ctx, SubscribeConfig{})
+}
+
+// SubscribeWithConfig is like [Manager.Subscribe] but uses the given configuration.
+func (m *Manager) SubscribeWithConfig(ctx context.Context, config SubscribeConfig) <-chan AmplifierEvent {
+	return m.subscribers.subscribe(ctx, config)
+}
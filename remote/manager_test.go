@@ -0,0 +1,266 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/Jacalz/hegelmote/remote/hegelsim"
+	"github.com/alecthomas/assert/v2"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+
+	manager := NewManager()
+	manager.Reconnect = &ReconnectPolicy{InitialDelay: 10 * time.Millisecond}
+	t.Cleanup(func() { manager.Close() })
+	return manager
+}
+
+func addSimulator(t *testing.T, manager *Manager, name string, model device.Type) *hegelsim.Amplifier {
+	t.Helper()
+
+	amp := newSimulator(t, model)
+	err := manager.Add(context.Background(), name, "127.0.0.1", model, ConnectConfig{Port: amp.Port()})
+	assert.NoError(t, err)
+	return amp
+}
+
+// receiveAmplifierEvent returns the next event that is not about the connection.
+func receiveAmplifierEvent(t *testing.T, events <-chan AmplifierEvent) AmplifierEvent {
+	t.Helper()
+
+	for {
+		select {
+		case event := <-events:
+			switch event.Event.(type) {
+			case ConnectionStateChanged, Resynced:
+			default:
+				return event
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for event")
+			return AmplifierEvent{}
+		}
+	}
+}
+
+func TestManagerGroupCommands(t *testing.T) {
+	manager := newTestManager(t)
+	listeningRoom := addSimulator(t, manager, "listening room", device.H390)
+	lounge := addSimulator(t, manager, "lounge", device.H95)
+
+	assert.Equal(t, []string{"listening room", "lounge"}, manager.Names())
+
+	result := manager.SetPowerAll(context.Background(), true)
+	assert.Equal(t, GroupResult{"listening room": nil, "lounge": nil}, result)
+	assert.NoError(t, result.Err())
+	assert.True(t, listeningRoom.State().Power)
+	assert.True(t, lounge.State().Power)
+
+	result = manager.SetVolumeMuteAll(context.Background(), true)
+	assert.NoError(t, result.Err())
+	assert.True(t, listeningRoom.State().Mute)
+	assert.True(t, lounge.State().Mute)
+
+	result = manager.Run(context.Background(), func(ctx context.Context, name string, amp *ControlWithListener) error {
+		_, err := amp.SetInput(10)
+		return err
+	})
+	assert.NoError(t, result["listening room"])
+	assert.EqualError(t, result.Err(), "lounge: invalid parameter")
+	assert.Equal(t, 10, listeningRoom.State().Input)
+
+	amp, ok := manager.Get("lounge")
+	assert.True(t, ok)
+	assert.Equal(t, device.H95, amp.GetDeviceType())
+
+	assert.NoError(t, manager.Remove("lounge"))
+	assert.Equal(t, []string{"listening room"}, manager.Names())
+	assert.Error(t, manager.Remove("lounge"))
+	_, ok = manager.Get("lounge")
+	assert.False(t, ok)
+}
+
+func TestManagerAdd(t *testing.T) {
+	manager := newTestManager(t)
+	amp := addSimulator(t, manager, "lounge", device.H95)
+
+	err := manager.Add(context.Background(), "lounge", "127.0.0.1", device.H95, ConnectConfig{Port: amp.Port()})
+	assert.EqualError(t, err, `amplifier "lounge" has already been added`)
+
+	refused := errors.New("connection refused")
+	err = manager.Add(context.Background(), "office", "127.0.0.1", device.H95, ConnectConfig{
+		Dial: func(context.Context, string, string) (net.Conn, error) { return nil, refused },
+	})
+	assert.IsError(t, err, refused)
+	assert.Equal(t, []string{"lounge"}, manager.Names())
+}
+
+func TestManagerRemoveWhileAdding(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		dialErr error
+	}{
+		{"connected", nil},
+		{"failed", errors.New("connection refused")},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			manager := newTestManager(t)
+			sim := newSimulator(t, device.H95)
+
+			// The dial finishes after the amplifier has been removed, whether it is canceled or not.
+			dialing, release := make(chan struct{}), make(chan struct{})
+			conns := make(chan *trackedConn, 1)
+			dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+				close(dialing)
+				<-release
+				if test.dialErr != nil {
+					return nil, test.dialErr
+				}
+
+				conn, err := (&net.Dialer{}).DialContext(context.Background(), network, address)
+				if err != nil {
+					return nil, err
+				}
+
+				tracked := &trackedConn{Conn: conn}
+				conns <- tracked
+				return tracked, nil
+			}
+
+			added := make(chan error, 1)
+			go func() {
+				added <- manager.Add(context.Background(), "office", "127.0.0.1", device.H95, ConnectConfig{Port: sim.Port(), Dial: dial})
+			}()
+			<-dialing
+
+			removed := make(chan error, 1)
+			go func() { removed <- manager.Remove("office") }()
+			deadline := time.Now().Add(time.Second)
+			for len(manager.Names()) != 0 && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+			assert.Zero(t, manager.Names())
+
+			// The name can be taken again and is kept when the first attempt finishes.
+			addSimulator(t, manager, "office", device.H390)
+			close(release)
+
+			assert.EqualError(t, <-added, `amplifier "office" was removed while connecting`)
+			assert.NoError(t, <-removed)
+			assert.Equal(t, []string{"office"}, manager.Names())
+
+			amp, _ := manager.Get("office")
+			assert.Equal(t, device.H390, amp.GetDeviceType())
+			assert.Equal(t, Connected, amp.GetConnectionState())
+
+			if test.dialErr == nil {
+				assert.True(t, (<-conns).closed.Load())
+			}
+		})
+	}
+}
+
+func TestManagerRemoveCancelsAdd(t *testing.T) {
+	manager := newTestManager(t)
+
+	dialing := make(chan struct{})
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		close(dialing)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	added := make(chan error, 1)
+	go func() {
+		added <- manager.Add(context.Background(), "office", "127.0.0.1", device.H95, ConnectConfig{Dial: dial})
+	}()
+	<-dialing
+
+	assert.NoError(t, manager.Remove("office"))
+	select {
+	case err := <-added:
+		assert.EqualError(t, err, `amplifier "office" was removed while connecting`)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the amplifier to stop connecting")
+	}
+	assert.Zero(t, manager.Names())
+}
+
+func TestManagerEvents(t *testing.T) {
+	manager := newTestManager(t)
+	events := manager.SubscribeWithConfig(t.Context(), SubscribeConfig{Buffer: 64})
+
+	listeningRoom := addSimulator(t, manager, "listening room", device.H390)
+	lounge := addSimulator(t, manager, "lounge", device.H95)
+
+	lounge.SetVolume(30)
+	assert.Equal(t, AmplifierEvent{Name: "lounge", Event: VolumeChanged{Volume: 30}}, receiveAmplifierEvent(t, events))
+
+	listeningRoom.SetMute(true)
+	assert.Equal(t, AmplifierEvent{Name: "listening room", Event: MuteChanged{Muted: true}}, receiveAmplifierEvent(t, events))
+
+	// Only the amplifier that was reset reconnects.
+	listeningRoom.Reset()
+	assert.Equal(t, AmplifierEvent{Name: "listening room", Event: ResetReceived{}}, receiveAmplifierEvent(t, events))
+
+	amp, _ := manager.Get("listening room")
+	deadline := time.Now().Add(time.Second)
+	for amp.GetConnectionState() != Connected && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Equal(t, Connected, amp.GetConnectionState())
+
+	other, _ := manager.Get("lounge")
+	assert.Equal(t, Connected, other.GetConnectionState())
+
+	lounge.SetPower(true)
+	assert.Equal(t, AmplifierEvent{Name: "lounge", Event: PowerChanged{PoweredOn: true}}, receiveAmplifierEvent(t, events))
+}
+
+func TestManagerSlowSubscriber(t *testing.T) {
+	manager := newTestManager(t)
+	lounge := addSimulator(t, manager, "lounge", device.H95)
+	events := manager.SubscribeWithConfig(t.Context(), SubscribeConfig{Buffer: 1, Policy: Block})
+
+	// The amplifier keeps working while nobody reads the events.
+	for volume := range Volume(100) {
+		lounge.SetVolume(volume)
+	}
+
+	amp, _ := manager.Get("lounge")
+	for deadline := time.Now().Add(time.Second); amp.Snapshot().Volume != 99; {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the notifications")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	volume, err := amp.GetVolumeContext(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 99, volume)
+
+	// The missed events are replaced by the current state.
+	last := Volume(0)
+	for {
+		select {
+		case event := <-events:
+			switch event := event.Event.(type) {
+			case VolumeChanged:
+				last = event.Volume
+			case Resynced:
+				assert.Equal(t, 99, last)
+				return
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for the state to be caught up on")
+		}
+	}
+}
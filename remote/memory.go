@@ -0,0 +1,176 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"maps"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Jacalz/hegelmote/device"
+)
+
+const restoreTimeout = 5 * time.Second
+
+// VolumeStore persists the volume that was last used on each input.
+type VolumeStore interface {
+	LoadVolumes() (map[device.Input]Volume, error)
+	SaveVolumes(volumes map[device.Input]Volume) error
+}
+
+// FileVolumeStore stores the volumes as JSON in a file.
+// A missing file is treated as no volumes having been stored.
+type FileVolumeStore struct {
+	Path string
+}
+
+// LoadVolumes reads the volumes from the file.
+func (f *FileVolumeStore) LoadVolumes() (map[device.Input]Volume, error) {
+	data, err := os.ReadFile(f.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[device.Input]Volume{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	volumes := map[device.Input]Volume{}
+	err = json.Unmarshal(data, &volumes)
+	return volumes, err
+}
+
+// SaveVolumes writes the volumes to the file.
+func (f *FileVolumeStore) SaveVolumes(volumes map[device.Input]Volume) error {
+	data, err := json.Marshal(volumes)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(f.Path, data, 0o600)
+}
+
+type volumeMemory struct {
+	store VolumeStore
+
+	lock    sync.Mutex
+	volumes map[device.Input]Volume
+
+	saveLock sync.Mutex
+}
+
+func (m *volumeMemory) get(input device.Input) (Volume, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	volume, ok := m.volumes[input]
+	return volume, ok
+}
+
+func (m *volumeMemory) set(input device.Input, volume Volume) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if previous, ok := m.volumes[input]; ok && previous == volume {
+		return false
+	}
+
+	m.volumes[input] = volume
+	return true
+}
+
+// save writes the latest volumes to the store, one save at a time.
+func (m *volumeMemory) save() error {
+	if m.store == nil {
+		return nil
+	}
+
+	m.saveLock.Lock()
+	defer m.saveLock.Unlock()
+
+	m.lock.Lock()
+	volumes := maps.Clone(m.volumes)
+	m.lock.Unlock()
+
+	return m.store.SaveVolumes(volumes)
+}
+
+// EnableVolumeMemory makes the controller remember the last volume used on each input.
+// The remembered volume is restored, capped by the volume limit, whenever the input changes.
+// The volumes are loaded from and saved to the store, unless it is nil.
+func (c *ControlWithListener) EnableVolumeMemory(store VolumeStore) error {
+	memory := &volumeMemory{store: store, volumes: map[device.Input]Volume{}}
+	if store != nil {
+		volumes, err := store.LoadVolumes()
+		if err != nil {
+			return err
+		}
+		maps.Copy(memory.volumes, volumes)
+	}
+
+	c.memory.Store(memory)
+	return nil
+}
+
+// DisableVolumeMemory stops remembering the volume for each input.
+func (c *ControlWithListener) DisableVolumeMemory() {
+	c.memory.Store(nil)
+}
+
+// RememberedVolume returns the volume last used on the input, if any.
+func (c *ControlWithListener) RememberedVolume(input device.Input) (Volume, bool) {
+	memory := c.memory.Load()
+	if memory == nil {
+		return 0, false
+	}
+
+	return memory.get(input)
+}
+
+// updateVolumeMemory remembers volume changes and restores the volume on input changes.
+func (c *ControlWithListener) updateVolumeMemory(before, after State) {
+	memory := c.memory.Load()
+	if memory == nil || after.InputUpdated.IsZero() {
+		return
+	}
+
+	if !before.InputUpdated.IsZero() && before.Input != after.Input {
+		if volume, ok := memory.get(after.Input); ok {
+			go c.restoreVolume(after.Input, volume)
+		}
+		return
+	}
+
+	if before.VolumeUpdated != after.VolumeUpdated && memory.set(after.Input, after.Volume) {
+		go func() {
+			err := memory.save()
+			if err != nil {
+				c.emit(ErrorReceived{Err: err})
+			}
+		}()
+	}
+}
+
+// restoreVolume sets the remembered volume, as long as the input has not changed again.
+func (c *ControlWithListener) restoreVolume(input device.Input, volume Volume) {
+	ctx, cancel := context.WithTimeout(context.Background(), restoreTimeout)
+	defer cancel()
+
+	limit, _, err := c.control.volumeLimit(ctx)
+	if err != nil {
+		c.emit(ErrorReceived{Err: err})
+		return
+	}
+
+	volume = min(volume, limit)
+	state := c.Snapshot()
+	if state.Input != input || state.Volume == volume {
+		return
+	}
+
+	_, err = c.SetVolumeContext(ctx, volume)
+	if err != nil {
+		c.emit(ErrorReceived{Err: err})
+	}
+}
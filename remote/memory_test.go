@@ -0,0 +1,108 @@
+package remote
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/Jacalz/hegelmote/remote/hegelsim"
+	"github.com/alecthomas/assert/v2"
+)
+
+func waitForVolume(t *testing.T, amp *hegelsim.Amplifier, volume Volume) {
+	t.Helper()
+
+	for deadline := time.Now().Add(time.Second); amp.State().Volume != volume; {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for volume %d, got %d", volume, amp.State().Volume)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFileVolumeStore(t *testing.T) {
+	store := &FileVolumeStore{Path: filepath.Join(t.TempDir(), "volumes.json")}
+
+	volumes, err := store.LoadVolumes()
+	assert.NoError(t, err)
+	assert.Equal(t, map[device.Input]Volume{}, volumes)
+
+	assert.NoError(t, store.SaveVolumes(map[device.Input]Volume{1: 55, 7: 20}))
+	volumes, err = store.LoadVolumes()
+	assert.NoError(t, err)
+	assert.Equal(t, map[device.Input]Volume{1: 55, 7: 20}, volumes)
+}
+
+func TestVolumeMemory(t *testing.T) {
+	amp := newSimulator(t, device.H120)
+	control := listenToSimulator(t, amp)
+	store := &FileVolumeStore{Path: filepath.Join(t.TempDir(), "volumes.json")}
+	assert.NoError(t, control.EnableVolumeMemory(store))
+
+	_, err := control.SetVolume(55)
+	assert.NoError(t, err)
+	_, err = control.SetInput(7)
+	assert.NoError(t, err)
+	_, err = control.SetVolume(20)
+	assert.NoError(t, err)
+
+	// Changing input ourselves restores the volume.
+	_, err = control.SetInput(1)
+	assert.NoError(t, err)
+	waitForVolume(t, amp, 55)
+
+	// Changes from elsewhere are remembered and restored as well.
+	assert.NoError(t, amp.SetInput(7))
+	waitForVolume(t, amp, 20)
+	amp.SetVolume(25)
+	for volume, _ := control.RememberedVolume(7); volume != 25; volume, _ = control.RememberedVolume(7) {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Inputs without a remembered volume keep the current volume.
+	assert.NoError(t, amp.SetInput(3))
+	_, ok := control.RememberedVolume(3)
+	assert.False(t, ok)
+
+	// The restored volume is capped by the limit.
+	control.SetVolumeLimit(&VolumeLimit{Max: 40})
+	assert.NoError(t, amp.SetInput(1))
+	waitForVolume(t, amp, 40)
+
+	control.DisableVolumeMemory()
+	assert.NoError(t, amp.SetInput(7))
+	_, ok = control.RememberedVolume(7)
+	assert.False(t, ok)
+
+	// Saving happens in the background.
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		volumes, err := store.LoadVolumes()
+		if err == nil && volumes[1] == 40 {
+			assert.Equal(t, map[device.Input]Volume{1: 40, 7: 25}, volumes)
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for volumes to be saved, got %v (%v)", volumes, err)
+		}
+	}
+}
+
+func TestVolumeMemoryLoadsStore(t *testing.T) {
+	store := &FileVolumeStore{Path: filepath.Join(t.TempDir(), "volumes.json")}
+	assert.NoError(t, store.SaveVolumes(map[device.Input]Volume{2: 33}))
+
+	amp := newSimulator(t, device.H95)
+	control := listenToSimulator(t, amp)
+	assert.NoError(t, control.EnableVolumeMemory(store))
+
+	volume, ok := control.RememberedVolume(2)
+	assert.True(t, ok)
+	assert.Equal(t, 33, volume)
+
+	_, err := control.SetInput(2)
+	assert.NoError(t, err)
+	waitForVolume(t, amp, 33)
+
+	broken := &FileVolumeStore{Path: t.TempDir()}
+	assert.Error(t, control.EnableVolumeMemory(broken))
+}
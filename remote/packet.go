@@ -0,0 +1,67 @@
+package remote
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// maxPacketLength is the longest packet accepted before giving up on finding the end of it.
+const maxPacketLength = 64
+
+var errPacketTooLong = errors.New("packet is missing carriage return terminator")
+
+// PacketReader splits data read from the amplifier into packets terminated by a carriage return.
+// Partial packets are kept until the rest arrives and multiple packets
+// arriving in one read are returned in order on subsequent calls.
+type PacketReader struct {
+	reader io.Reader
+	err    error
+
+	pending []byte
+	chunk   [maxPacketLength]byte
+}
+
+// NewPacketReader creates a new packet reader that reads from the given reader.
+func NewPacketReader(r io.Reader) *PacketReader {
+	return &PacketReader{reader: r, pending: make([]byte, 0, 2*maxPacketLength)}
+}
+
+// ReadPacket returns the next packet, including the trailing carriage return.
+// Errors from the underlying reader are returned once all complete packets before them
+// have been read. Data of an incomplete packet is kept if a read fails, so reading
+// can be retried after errors like timeouts.
+func (p *PacketReader) ReadPacket() ([]byte, error) {
+	for {
+		if packet := p.nextPacket(); packet != nil {
+			return packet, nil
+		}
+
+		if p.err != nil {
+			err := p.err
+			p.err = nil
+			return nil, err
+		}
+
+		if len(p.pending) >= maxPacketLength {
+			p.pending = p.pending[:0]
+			return nil, errPacketTooLong
+		}
+
+		n, err := p.reader.Read(p.chunk[:])
+		p.pending = append(p.pending, p.chunk[:n]...)
+		p.err = err
+	}
+}
+
+func (p *PacketReader) nextPacket() []byte {
+	end := bytes.IndexByte(p.pending, '\r')
+	if end == -1 {
+		return nil
+	}
+
+	packet := bytes.Clone(p.pending[:end+1])
+	n := copy(p.pending, p.pending[end+1:])
+	p.pending = p.pending[:n]
+	return packet
+}
@@ -0,0 +1,79 @@
+package remote
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func readAllPackets(t *testing.T, packets *PacketReader) []string {
+	t.Helper()
+
+	read := []string{}
+	for {
+		packet, err := packets.ReadPacket()
+		if err == io.EOF {
+			return read
+		}
+
+		assert.NoError(t, err)
+		read = append(read, string(packet))
+	}
+}
+
+func TestReadPacketCoalesced(t *testing.T) {
+	packets := NewPacketReader(strings.NewReader("-p.1\r-v.100\r-i.8\r"))
+	assert.Equal(t, []string{"-p.1\r", "-v.100\r", "-i.8\r"}, readAllPackets(t, packets))
+}
+
+func TestReadPacketSplit(t *testing.T) {
+	packets := NewPacketReader(iotest.OneByteReader(strings.NewReader("-v.42\r-m.0\r")))
+	assert.Equal(t, []string{"-v.42\r", "-m.0\r"}, readAllPackets(t, packets))
+}
+
+func TestReadPacketErrorAfterData(t *testing.T) {
+	packets := NewPacketReader(iotest.DataErrReader(strings.NewReader("-p.0\r-p.1\r")))
+	assert.Equal(t, []string{"-p.0\r", "-p.1\r"}, readAllPackets(t, packets))
+}
+
+func TestReadPacketRetryAfterTimeout(t *testing.T) {
+	data := &bytes.Buffer{}
+	data.WriteString("-v.2")
+	packets := NewPacketReader(iotest.TimeoutReader(data))
+
+	_, err := packets.ReadPacket()
+	assert.IsError(t, err, iotest.ErrTimeout)
+
+	data.WriteString("5\r")
+	packets.reader = data
+
+	packet, err := packets.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, "-v.25\r", string(packet))
+}
+
+func TestReadPacketTooLong(t *testing.T) {
+	packets := NewPacketReader(strings.NewReader(strings.Repeat("x", maxPacketLength) + "-p.1\r"))
+
+	_, err := packets.ReadPacket()
+	assert.IsError(t, err, errPacketTooLong)
+
+	packet, err := packets.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, "-p.1\r", string(packet))
+}
+
+func TestReadPacketIsCopied(t *testing.T) {
+	packets := NewPacketReader(strings.NewReader("-p.1\r-p.0\r"))
+
+	first, err := packets.ReadPacket()
+	assert.NoError(t, err)
+
+	_, err = packets.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, "-p.1\r", string(first))
+}
@@ -1,17 +1,34 @@
 package remote
 
+import "context"
+
 // SetPower sets the power to either on or off.
 func (c *Control) SetPower(on bool) (bool, error) {
+	return c.SetPowerContext(context.Background(), on)
+}
+
+// SetPowerContext is like [Control.SetPower] but gives up when the context is done.
+func (c *Control) SetPowerContext(ctx context.Context, on bool) (bool, error) {
 	packet := createBooleanPacket('p', on)
-	return c.sendWithBoolResponse(packet)
+	return c.sendWithBoolResponse(ctx, packet)
 }
 
 // TogglePower toggles the power on and off.
 func (c *Control) TogglePower() (bool, error) {
-	return c.sendWithBoolResponse([]byte("-p.t\r"))
+	return c.TogglePowerContext(context.Background())
+}
+
+// TogglePowerContext is like [Control.TogglePower] but gives up when the context is done.
+func (c *Control) TogglePowerContext(ctx context.Context) (bool, error) {
+	return c.sendWithBoolResponse(ctx, []byte("-p.t\r"))
 }
 
 // GetPower returns the current power status.
 func (c *Control) GetPower() (bool, error) {
-	return c.sendWithBoolResponse([]byte("-p.?\r"))
+	return c.GetPowerContext(context.Background())
+}
+
+// GetPowerContext is like [Control.GetPower] but gives up when the context is done.
+func (c *Control) GetPowerContext(ctx context.Context) (bool, error) {
+	return c.sendWithBoolResponse(ctx, []byte("-p.?\r"))
 }
@@ -0,0 +1,279 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// lateReplyWindow is how long a reply to a command that timed out may still arrive.
+// Until then, a packet for the same command is taken as that reply and not as the
+// response to a newer command.
+const lateReplyWindow = 5 * time.Second
+
+var errNotConnected = errors.New("not connected to an amplifier")
+
+// request is a command waiting to be sent to the amplifier.
+type request struct {
+	ctx    context.Context
+	packet []byte
+	reply  chan readResponse
+
+	// sent is when the packet was written, if it was traced.
+	sent time.Time
+}
+
+func (r *request) respond(resp []byte, err error) {
+	r.reply <- readResponse{buf: resp, err: err}
+}
+
+func (r *request) isAnsweredBy(packet []byte) bool {
+	return len(packet) > 1 && (packet[1] == r.packet[1] || packet[1] == 'e')
+}
+
+type readResponse struct {
+	buf []byte
+	err error
+}
+
+// lateReply is a reply that may still arrive for a command that timed out.
+type lateReply struct {
+	command byte
+	expires time.Time
+}
+
+// session owns the connection to the amplifier for as long as it is open.
+// Commands are queued and written one at a time from a single goroutine.
+// An incoming packet for the same command as the one being waited on is
+// taken as the response and everything else is a notification of change.
+type session struct {
+	requests      chan *request
+	notifications chan readResponse
+	done          chan struct{}
+
+	// err is the reason for the session ending. It is set before notifications is closed.
+	err error
+
+	// The fields below are only used by the goroutine that owns the connection.
+	queue   []*request
+	waiting *request
+	pending []readResponse // Notifications that the callbacks have yet to take.
+	late    []lateReply
+}
+
+func (c *ControlWithListener) startSession(conn io.Writer, packets *PacketReader) {
+	s := &session{
+		requests:      make(chan *request),
+		notifications: make(chan readResponse),
+		done:          make(chan struct{}),
+	}
+
+	c.lock.Lock()
+	c.session = s
+	c.lock.Unlock()
+
+	incoming := make(chan readResponse)
+	go s.readPackets(packets, incoming)
+	go c.runSession(s, conn, incoming)
+	go c.runNotifications(s)
+}
+
+// currentSession returns the session of the latest connection, or nil if never connected.
+func (c *ControlWithListener) currentSession() *session {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.session
+}
+
+// exchange queues the packet for sending and waits for the response.
+func (c *ControlWithListener) exchange(ctx context.Context, packet []byte) ([]byte, error) {
+	s := c.currentSession()
+	if s == nil {
+		return nil, errNotConnected
+	}
+
+	req := &request{ctx: ctx, packet: packet, reply: make(chan readResponse, 1)}
+	select {
+	case s.requests <- req:
+	case <-s.done:
+		return nil, errNotConnected
+	case <-ctx.Done():
+		return nil, newTimeoutError(packet, ctx.Err())
+	}
+
+	select {
+	case got := <-req.reply:
+		return got.buf, got.err
+	case <-ctx.Done():
+		return nil, newTimeoutError(packet, ctx.Err())
+	}
+}
+
+func (s *session) readPackets(packets *PacketReader, incoming chan<- readResponse) {
+	for {
+		packet, err := packets.ReadPacket()
+		select {
+		case incoming <- readResponse{buf: packet, err: err}:
+		case <-s.done:
+			return
+		}
+
+		if err != nil && !errors.Is(err, errPacketTooLong) {
+			return
+		}
+	}
+}
+
+func (c *ControlWithListener) runSession(s *session, conn io.Writer, incoming <-chan readResponse) {
+	for {
+		if s.waiting == nil && len(s.queue) > 0 {
+			next := s.queue[0]
+			s.queue = s.queue[1:]
+			s.waiting = c.write(conn, next)
+			continue
+		}
+
+		var timeout <-chan struct{}
+		if s.waiting != nil {
+			timeout = s.waiting.ctx.Done()
+		}
+
+		// Notifications are only handed over when the callbacks are ready for them,
+		// so that callbacks sending commands never hold up reading from the amplifier.
+		var deliver chan<- readResponse
+		var notification readResponse
+		if len(s.pending) > 0 {
+			deliver, notification = s.notifications, s.pending[0]
+		}
+
+		select {
+		case req := <-s.requests:
+			s.queue = append(s.queue, req)
+		case <-timeout:
+			s.timeOut()
+		case deliver <- notification:
+			s.pending = s.pending[1:]
+		case got := <-incoming:
+			if got.err != nil && !errors.Is(got.err, errPacketTooLong) {
+				s.close(got.err)
+				return
+			}
+
+			c.handleIncoming(s, got)
+		}
+	}
+}
+
+// handleIncoming passes on a packet as the response to the request being
+// waited on, or otherwise as a notification.
+func (c *ControlWithListener) handleIncoming(s *session, got readResponse) {
+	late := got.err == nil && s.takeLateReply(got.buf)
+	if !late && got.err == nil && s.waiting != nil && s.waiting.isAnsweredBy(got.buf) {
+		c.traceIncoming(got, s.waiting)
+		resp, err := verifyResponse(got.buf)
+		if err == nil {
+			c.record(resp)
+		}
+
+		s.waiting.respond(resp, err)
+		s.waiting = nil
+		return
+	}
+
+	// Notifications are recorded here, and not when the callbacks get them, so
+	// that the state is updated in the same order as the packets arrived.
+	// Late replies are handled as notifications as well.
+	c.traceIncoming(got, nil)
+	if got.err == nil {
+		if resp, err := verifyResponse(got.buf); err == nil {
+			c.record(resp)
+		}
+	}
+
+	s.pending = append(s.pending, got)
+}
+
+// timeOut fails the request being waited on, whose reply may still arrive later.
+func (s *session) timeOut() {
+	s.late = append(s.late, lateReply{command: s.waiting.packet[1], expires: time.Now().Add(lateReplyWindow)})
+	s.waiting.respond(nil, newTimeoutError(s.waiting.packet, s.waiting.ctx.Err()))
+	s.waiting = nil
+}
+
+// takeLateReply reports if the packet is the reply to a command that timed out.
+// Replies arrive in order, so it is matched with the oldest such command.
+func (s *session) takeLateReply(packet []byte) bool {
+	now := time.Now()
+	for len(s.late) > 0 && now.After(s.late[0].expires) {
+		s.late = s.late[1:]
+	}
+
+	for i, late := range s.late {
+		if len(packet) > 1 && (packet[1] == late.command || packet[1] == 'e') {
+			s.late = append(s.late[:i], s.late[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// write sends the request to the amplifier and returns it if a response should be waited for.
+func (c *ControlWithListener) write(conn io.Writer, req *request) *request {
+	if err := req.ctx.Err(); err != nil {
+		req.respond(nil, newTimeoutError(req.packet, err))
+		return nil
+	}
+
+	req.sent = c.control.trace(TraceSent, req.packet, time.Time{})
+	_, err := conn.Write(req.packet)
+	if err != nil {
+		req.respond(nil, err)
+		return nil
+	}
+
+	return req
+}
+
+// close fails all outstanding requests and stops the session.
+// Notifications that arrived before are still passed on to the callbacks.
+func (s *session) close(err error) {
+	if s.waiting != nil {
+		s.waiting.respond(nil, err)
+	}
+	for _, req := range s.queue {
+		req.respond(nil, err)
+	}
+
+	s.err = err
+	close(s.done)
+
+	for _, notification := range s.pending {
+		s.notifications <- notification
+	}
+	close(s.notifications)
+}
+
+// runNotifications calls the callbacks from a separate goroutine so they can send commands.
+func (c *ControlWithListener) runNotifications(s *session) {
+	for got := range s.notifications {
+		err := got.err
+		if err == nil {
+			err = c.handleNotification(got.buf)
+		}
+
+		if err != nil && !c.closing.Load() {
+			c.emit(ErrorReceived{Err: err})
+		}
+	}
+
+	// A session that ended after being replaced by a new connection was already torn down.
+	c.lock.Lock()
+	current := c.session == s
+	c.lock.Unlock()
+
+	if current {
+		c.handleSessionEnd(s.err)
+	}
+}
@@ -0,0 +1,222 @@
+package remote
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestNotificationDuringCommand(t *testing.T) {
+	powered := make(chan bool, 1)
+	control, amplifier := newListenerPipe(t, func(Volume) {})
+	control.OnPowerChange = func(on bool) { powered <- on }
+
+	go func() {
+		_, _ = bufio.NewReader(amplifier).ReadString('\r')
+		_, _ = amplifier.Write([]byte("-p.1\r-v.20\r"))
+	}()
+
+	volume, err := control.GetVolume()
+	assert.NoError(t, err)
+	assert.Equal(t, 20, volume)
+	assert.True(t, <-powered)
+}
+
+func TestErrorResponseGoesToCommand(t *testing.T) {
+	control, amplifier := newListenerPipe(t, func(Volume) {})
+	control.OnError = func(err error) { t.Errorf("unexpected error: %v", err) }
+
+	go func() {
+		_, _ = bufio.NewReader(amplifier).ReadString('\r')
+		_, _ = amplifier.Write([]byte("-e.3\r"))
+	}()
+
+	_, err := control.SetInput(12)
+	assert.Equal(t, errorFromCode('3'), err)
+}
+
+func TestTimeoutDoesNotBlockQueue(t *testing.T) {
+	control, amplifier := newListenerPipe(t, func(Volume) {})
+	reader := bufio.NewReader(amplifier)
+
+	go func() {
+		_, _ = reader.ReadString('\r') // Never answered.
+		_, _ = reader.ReadString('\r')
+		_, _ = amplifier.Write([]byte("-i.2\r"))
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := control.GetPowerContext(ctx)
+	assert.IsError(t, err, context.DeadlineExceeded)
+
+	input, err := control.GetInput()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, input)
+}
+
+func TestLateReplyIsNotTakenAsResponse(t *testing.T) {
+	control, amplifier := newListenerPipe(t, func(Volume) {})
+	reader := bufio.NewReader(amplifier)
+
+	go func() {
+		_, _ = reader.ReadString('\r') // Answered after timing out.
+		_, _ = reader.ReadString('\r')
+		_, _ = amplifier.Write([]byte("-p.0\r-p.1\r"))
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := control.GetPowerContext(ctx)
+	assert.IsError(t, err, context.DeadlineExceeded)
+
+	on, err := control.SetPower(true)
+	assert.NoError(t, err)
+	assert.True(t, on)
+}
+
+func TestCommandsWhenDisconnected(t *testing.T) {
+	control := NewControlWithListener(
+		func(bool) {}, func(Volume) {}, func(bool) {}, func(device.Input) {}, func() {}, func(error) {},
+	)
+
+	_, err := control.GetPower()
+	assert.IsError(t, err, errNotConnected)
+
+	control, amplifier := newListenerPipe(t, func(Volume) {})
+	assert.NoError(t, amplifier.Close())
+
+	_, err = control.GetPower()
+	assert.Error(t, err)
+}
+
+func TestCallbacksCanSendCommands(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+
+	inputs := make(chan device.Input, 1)
+	var control *ControlWithListener
+	control = NewControlWithListener(
+		func(bool) {
+			input, err := control.GetInput()
+			assert.NoError(t, err)
+			inputs <- input
+		},
+		func(Volume) {}, func(bool) {}, func(device.Input) {}, func() {}, func(error) {},
+	)
+	err := control.ConnectWithConfig(context.Background(), "127.0.0.1", device.H95, ConnectConfig{Port: amp.Port()})
+	assert.NoError(t, err)
+	defer control.Disconnect()
+
+	assert.NoError(t, amp.SetInput(4))
+	amp.SetPower(true)
+	assert.Equal(t, 4, <-inputs)
+}
+
+func TestConcurrentCommands(t *testing.T) {
+	amp := newSimulator(t, device.H390)
+
+	notifications := atomic.Int32{}
+	control := NewControlWithListener(
+		func(bool) { notifications.Add(1) },
+		func(Volume) {},
+		func(bool) { notifications.Add(1) },
+		func(device.Input) {},
+		func() {},
+		func(err error) { t.Errorf("unexpected error: %v", err) },
+	)
+	err := control.ConnectWithConfig(context.Background(), "127.0.0.1", device.H390, ConnectConfig{Port: amp.Port()})
+	assert.NoError(t, err)
+	defer control.Disconnect()
+
+	// Power and mute are changed from the front panel while volume and input are
+	// changed remotely so responses and notifications never share command letters.
+	done := make(chan struct{})
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+				amp.SetPower(i%2 == 0)
+				amp.SetMute(i%3 == 0)
+			}
+		}
+	}()
+
+	const workers, iterations = 8, 50
+	wg := sync.WaitGroup{}
+	wg.Add(workers)
+	for range workers {
+		go func() {
+			defer wg.Done()
+			for range iterations {
+				volume := Volume(rand.IntN(101))
+				got, err := control.SetVolume(volume)
+				assert.NoError(t, err)
+				assert.Equal(t, volume, got)
+
+				input := device.Input(rand.IntN(10) + 1)
+				gotInput, err := control.SetInput(input)
+				assert.NoError(t, err)
+				assert.Equal(t, input, gotInput)
+
+				gotInput, err = control.GetInput()
+				assert.NoError(t, err)
+				assert.True(t, gotInput >= 1 && gotInput <= 10)
+
+				_, err = control.SetInput(0)
+				assert.True(t, errors.Is(err, errInputIsZero))
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(done)
+	assert.NotZero(t, notifications.Load())
+}
+
+func TestNotificationBurstWhileCallbacksSendCommands(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+
+	const burst = 64
+	sent := make(chan struct{})
+	inputs := make(chan device.Input, burst)
+	var control *ControlWithListener
+	control = NewControlWithListener(
+		func(bool) {
+			// The first command is sent once all notifications have arrived.
+			<-sent
+			input, err := control.GetInput()
+			assert.NoError(t, err)
+			inputs <- input
+		},
+		func(Volume) {}, func(bool) {}, func(device.Input) {}, func() {}, func(error) {},
+	)
+	err := control.ConnectWithConfig(context.Background(), "127.0.0.1", device.H95, ConnectConfig{Port: amp.Port()})
+	assert.NoError(t, err)
+	defer control.Disconnect()
+
+	for i := range burst {
+		amp.SetPower(i%2 == 0)
+	}
+	close(sent)
+
+	for range burst {
+		select {
+		case input := <-inputs:
+			assert.Equal(t, 1, input)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the callbacks")
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const defaultRampInterval = 50 * time.Millisecond
+
+// ErrRampInterrupted is returned when the volume was changed by someone else during a ramp.
+var ErrRampInterrupted = errors.New("volume was changed during ramp")
+
+// RampConfig specifies how quickly to ramp the volume.
+// The volume is changed one step at a time.
+type RampConfig struct {
+	// Duration is the total time that the ramp should take.
+	// It takes precedence over Interval when set.
+	Duration time.Duration
+
+	// Interval is the time between each step. Defaults to 50 milliseconds.
+	Interval time.Duration
+
+	// OnProgress, if set, is called with the volume after each step.
+	OnProgress func(volume Volume)
+}
+
+func (r *RampConfig) interval(steps int) time.Duration {
+	if r.Duration > 0 && steps > 0 {
+		// Durations shorter than one nanosecond per step ramp as fast as possible.
+		return max(r.Duration/time.Duration(steps), time.Nanosecond)
+	} else if r.Interval > 0 {
+		return r.Interval
+	}
+
+	return defaultRampInterval
+}
+
+// RampVolume gradually changes the volume to the target over time.
+// It stops with [ErrRampInterrupted] if the amplifier reports another
+// volume than expected, for example when changed from another remote.
+// The last volume that was set is returned together with any error.
+func (c *Control) RampVolume(ctx context.Context, target Volume, config RampConfig) (Volume, error) {
+	return rampVolume(ctx, c, target, config, nil)
+}
+
+// FadeToMute ramps the volume down to zero and then mutes the amplifier.
+// The volume from before the fade is returned so that it can be restored later.
+func (c *Control) FadeToMute(ctx context.Context, config RampConfig) (Volume, error) {
+	return fadeToMute(ctx, c, config, nil)
+}
+
+// RampVolume is like [Control.RampVolume] but also stops with [ErrRampInterrupted]
+// as soon as a volume change notification is received during the ramp.
+func (c *ControlWithListener) RampVolume(ctx context.Context, target Volume, config RampConfig) (Volume, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	return rampVolume(ctx, c, target, config, c.volumeChanges(ctx))
+}
+
+// FadeToMute is like [Control.FadeToMute] but stops as described for [ControlWithListener.RampVolume].
+func (c *ControlWithListener) FadeToMute(ctx context.Context, config RampConfig) (Volume, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	return fadeToMute(ctx, c, config, c.volumeChanges(ctx))
+}
+
+// volumeChanges returns a channel that is closed when the volume is changed by someone else.
+func (c *ControlWithListener) volumeChanges(ctx context.Context) <-chan struct{} {
+	events := c.Subscribe(ctx)
+	changed := make(chan struct{})
+	go func() {
+		notified := false
+		for event := range events {
+			if _, ok := event.(VolumeChanged); ok && !notified {
+				close(changed)
+				notified = true
+			}
+		}
+	}()
+	return changed
+}
+
+type volumeController interface {
+	GetVolumeContext(ctx context.Context) (Volume, error)
+	SetVolumeContext(ctx context.Context, volume Volume) (Volume, error)
+	SetVolumeMuteContext(ctx context.Context, mute bool) (bool, error)
+}
+
+func rampVolume(ctx context.Context, c volumeController, target Volume, config RampConfig, changed <-chan struct{}) (Volume, error) {
+	if target > 100 {
+		return 0, fmt.Errorf("invalid volume: %d", target)
+	}
+
+	current, err := c.GetVolumeContext(ctx)
+	if err != nil {
+		return current, err
+	}
+
+	steps := int(target) - int(current)
+	step := 1
+	if steps < 0 {
+		steps, step = -steps, -1
+	}
+
+	ticker := time.NewTicker(config.interval(steps))
+	defer ticker.Stop()
+
+	for current != target {
+		select {
+		case <-ticker.C:
+		case <-changed:
+			return current, ErrRampInterrupted
+		case <-ctx.Done():
+			return current, ctx.Err()
+		}
+
+		select {
+		case <-changed: // Prioritise changes that happened while waiting.
+			return current, ErrRampInterrupted
+		default:
+		}
+
+		next := Volume(int(current) + step) // #nosec G115 -- Always between current and target.
+		volume, err := c.SetVolumeContext(ctx, next)
+		if err != nil {
+			return current, err
+		} else if volume != next {
+			return volume, ErrRampInterrupted
+		}
+
+		current = volume
+		if config.OnProgress != nil {
+			config.OnProgress(current)
+		}
+	}
+
+	return current, nil
+}
+
+func fadeToMute(ctx context.Context, c volumeController, config RampConfig, changed <-chan struct{}) (Volume, error) {
+	original, err := c.GetVolumeContext(ctx)
+	if err != nil {
+		return original, err
+	}
+
+	_, err = rampVolume(ctx, c, 0, config, changed)
+	if err != nil {
+		return original, err
+	}
+
+	_, err = c.SetVolumeMuteContext(ctx, true)
+	return original, err
+}
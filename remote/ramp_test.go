@@ -0,0 +1,119 @@
+package remote
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestRampVolume(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+	amp.SetVolume(10)
+	control := connectToSimulator(t, amp)
+
+	progress := []Volume{}
+	config := RampConfig{Interval: time.Millisecond, OnProgress: func(v Volume) { progress = append(progress, v) }}
+	volume, err := control.RampVolume(context.Background(), 15, config)
+	assert.NoError(t, err)
+	assert.Equal(t, 15, volume)
+	assert.Equal(t, []Volume{11, 12, 13, 14, 15}, progress)
+
+	start := time.Now()
+	volume, err = control.RampVolume(context.Background(), 5, RampConfig{Duration: 50 * time.Millisecond})
+	assert.NoError(t, err)
+	assert.Equal(t, 5, volume)
+	assert.Equal(t, 5, amp.State().Volume)
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+
+	volume, err = control.RampVolume(context.Background(), 5, RampConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, 5, volume)
+
+	volume, err = control.RampVolume(context.Background(), 8, RampConfig{Duration: time.Nanosecond})
+	assert.NoError(t, err)
+	assert.Equal(t, 8, volume)
+
+	_, err = control.RampVolume(context.Background(), 101, RampConfig{})
+	assert.Error(t, err)
+}
+
+func TestRampInterval(t *testing.T) {
+	for _, test := range []struct {
+		config   RampConfig
+		steps    int
+		interval time.Duration
+	}{
+		{RampConfig{}, 10, defaultRampInterval},
+		{RampConfig{Interval: time.Second}, 10, time.Second},
+		{RampConfig{Duration: time.Second, Interval: time.Millisecond}, 10, 100 * time.Millisecond},
+		{RampConfig{Duration: time.Second}, 0, defaultRampInterval},
+		{RampConfig{Duration: 5 * time.Nanosecond}, 10, time.Nanosecond},
+	} {
+		assert.Equal(t, test.interval, test.config.interval(test.steps), "%+v %d", test.config, test.steps)
+	}
+}
+
+func TestRampVolumeCancel(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+	control := connectToSimulator(t, amp)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := RampConfig{Interval: time.Millisecond, OnProgress: func(v Volume) {
+		if v == 3 {
+			cancel()
+		}
+	}}
+	volume, err := control.RampVolume(ctx, 50, config)
+	assert.IsError(t, err, context.Canceled)
+	assert.Equal(t, 3, volume)
+	assert.Equal(t, 3, amp.State().Volume)
+}
+
+func TestRampVolumeInterrupted(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+	control := connectToSimulator(t, amp)
+
+	config := RampConfig{Interval: time.Millisecond, OnProgress: func(v Volume) {
+		if v == 2 {
+			amp.SetVolume(70)
+		}
+	}}
+	volume, err := control.RampVolume(context.Background(), 20, config)
+	assert.IsError(t, err, ErrRampInterrupted)
+	assert.Equal(t, 70, volume)
+}
+
+func TestListenerRampVolumeInterrupted(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+	control := listenToSimulator(t, amp)
+
+	config := RampConfig{Interval: 20 * time.Millisecond, OnProgress: func(v Volume) {
+		if v == 2 {
+			amp.SetVolume(70)
+		}
+	}}
+	volume, err := control.RampVolume(context.Background(), 20, config)
+	assert.IsError(t, err, ErrRampInterrupted)
+	assert.Equal(t, 2, volume)
+	assert.Equal(t, 70, amp.State().Volume)
+	assert.Equal(t, 70, control.Snapshot().Volume)
+}
+
+func TestFadeToMute(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+	amp.SetVolume(8)
+	control := listenToSimulator(t, amp)
+
+	original, err := control.FadeToMute(context.Background(), RampConfig{Interval: time.Millisecond})
+	assert.NoError(t, err)
+	assert.Equal(t, 8, original)
+
+	state := amp.State()
+	assert.Equal(t, 0, state.Volume)
+	assert.True(t, state.Mute)
+}
@@ -0,0 +1,227 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Response is a response or notification from the amplifier, see [Control.SendRaw].
+type Response struct {
+	// Command is the letter of the command, like 'v' for the volume.
+	Command byte
+
+	// Arg is the argument of the packet, like "20" for "-v.20".
+	Arg string
+
+	// Value is the argument as parsed by the command, or nil if it has no parser.
+	// The built in commands parse to a bool for 'p' and 'm', a uint8 for 'v' and 'i'
+	// and a [Delay] for 'r'.
+	Value any
+}
+
+// String returns the response formatted as a packet, like "-v.20".
+func (r Response) String() string {
+	return "-" + string(r.Command) + "." + r.Arg
+}
+
+// Command describes a command letter that is not built in to this package,
+// like commands only supported by some firmware versions.
+type Command struct {
+	// Parse, if set, parses the argument of responses and notifications into [Response.Value].
+	Parse func(arg string) (any, error)
+
+	// OnNotification, if set, is called when a [ControlWithListener] receives a notification
+	// for the command. It is called from the same goroutine as the other callbacks.
+	OnNotification func(resp Response)
+}
+
+var builtinCommands = map[byte]Command{
+	'p': {Parse: parseBoolArg},
+	'v': {Parse: parseUint8Arg},
+	'm': {Parse: parseBoolArg},
+	'i': {Parse: parseUint8Arg},
+	'r': {Parse: parseDelayArg},
+}
+
+// RegisterCommand adds a command letter that is not built in. Responses to [Control.SendRaw]
+// are parsed by it and notifications are passed on to it instead of being reported as errors.
+// Registering a letter again replaces the earlier command. The built in letters can not be replaced.
+func (c *Control) RegisterCommand(letter byte, cmd Command) error {
+	if !isCommandLetter(letter) {
+		return fmt.Errorf("invalid command letter %q", letter)
+	}
+
+	if _, ok := builtinCommands[letter]; ok || letter == 'e' {
+		return fmt.Errorf("command letter %q is built in", letter)
+	}
+
+	c.commandsLock.Lock()
+	defer c.commandsLock.Unlock()
+
+	if c.commands == nil {
+		c.commands = map[byte]Command{}
+	}
+	c.commands[letter] = cmd
+	return nil
+}
+
+// SendRaw sends a command with the given letter and argument, like 'v' and "u" for "-v.u",
+// and returns the response. The volume limit applies to volume commands sent this way as well.
+func (c *Control) SendRaw(command byte, arg string) (Response, error) {
+	return c.SendRawContext(context.Background(), command, arg)
+}
+
+// SendRawContext is like [Control.SendRaw] but gives up when the context is done.
+func (c *Control) SendRawContext(ctx context.Context, command byte, arg string) (Response, error) {
+	if !isCommandLetter(command) || command == 'e' {
+		return Response{}, fmt.Errorf("invalid command letter %q", command)
+	}
+
+	if arg == "" || strings.IndexByte(arg, '\r') != -1 || len(arg) > maxPacketLength-len("-x.\r") {
+		return Response{}, fmt.Errorf("invalid argument: %q", arg)
+	}
+
+	if command == 'v' {
+		err := c.checkRawVolume(ctx, arg)
+		if err != nil {
+			return Response{}, err
+		}
+	}
+
+	packet := make([]byte, 0, len("-x.\r")+len(arg))
+	packet = append(packet, '-', command, '.')
+	packet = append(packet, arg...)
+	packet = append(packet, '\r')
+
+	resp, err := c.send(ctx, packet)
+	if err != nil {
+		return Response{}, err
+	}
+
+	cmd, _ := c.lookupCommand(command)
+	return parseResponse(cmd, resp)
+}
+
+// checkRawVolume applies the volume limit like [Control.SetVolume] and [Control.VolumeUp] do.
+func (c *Control) checkRawVolume(ctx context.Context, arg string) error {
+	if c.limit.Load() == nil {
+		return nil
+	}
+
+	if arg == "u" {
+		volume, err := c.currentVolume(ctx)
+		if err != nil {
+			return err
+		}
+
+		return c.checkVolumeLimit(ctx, volume+1)
+	}
+
+	volume, err := strconv.ParseUint(arg, 10, 8)
+	if err != nil {
+		return nil // Queries, steps down and invalid values are left to the amplifier.
+	}
+
+	return c.checkVolumeLimit(ctx, Volume(volume))
+}
+
+func (c *Control) lookupCommand(letter byte) (Command, bool) {
+	if cmd, ok := builtinCommands[letter]; ok {
+		return cmd, true
+	}
+
+	c.commandsLock.RLock()
+	defer c.commandsLock.RUnlock()
+	cmd, ok := c.commands[letter]
+	return cmd, ok
+}
+
+// handleCommandNotification passes a notification for a registered command on to it.
+func (c *ControlWithListener) handleCommandNotification(packet []byte) error {
+	cmd, ok := c.control.lookupCommand(packet[1])
+	if !ok {
+		return fmt.Errorf("received unknown command \"%c\" from amplifier", packet[1])
+	}
+
+	resp, err := parseResponse(cmd, packet)
+	if err != nil {
+		return err
+	}
+
+	if cmd.OnNotification != nil {
+		cmd.OnNotification(resp)
+	}
+
+	return nil
+}
+
+// RegisterCommand adds a command letter that is not built in, see [Control.RegisterCommand].
+func (c *ControlWithListener) RegisterCommand(letter byte, cmd Command) error {
+	return c.control.RegisterCommand(letter, cmd)
+}
+
+// SendRaw sends a command with the given letter and argument and returns the response.
+// Changes made using built in commands are reported like any other change.
+func (c *ControlWithListener) SendRaw(command byte, arg string) (Response, error) {
+	return c.SendRawContext(context.Background(), command, arg)
+}
+
+// SendRawContext is like [ControlWithListener.SendRaw] but gives up when the context is done.
+func (c *ControlWithListener) SendRawContext(ctx context.Context, command byte, arg string) (Response, error) {
+	return c.control.SendRawContext(ctx, command, arg)
+}
+
+func parseResponse(cmd Command, packet []byte) (Response, error) {
+	resp := Response{Command: packet[1], Arg: string(bytes.TrimSuffix(packet[3:], []byte{'\r'}))}
+	if cmd.Parse == nil {
+		return resp, nil
+	}
+
+	value, err := cmd.Parse(resp.Arg)
+	if err != nil {
+		return Response{}, fmt.Errorf("invalid response %q: %w", resp, err)
+	}
+
+	resp.Value = value
+	return resp, nil
+}
+
+func isCommandLetter(letter byte) bool {
+	return ('a' <= letter && letter <= 'z') || ('A' <= letter && letter <= 'Z')
+}
+
+func parseBoolArg(arg string) (any, error) {
+	switch arg {
+	case "0":
+		return false, nil
+	case "1":
+		return true, nil
+	default:
+		return nil, fmt.Errorf("invalid bool value: %q", arg)
+	}
+}
+
+func parseUint8Arg(arg string) (any, error) {
+	number, err := strconv.ParseUint(arg, 10, 8)
+	if err != nil {
+		return nil, err
+	}
+
+	return uint8(number), nil
+}
+
+func parseDelayArg(arg string) (any, error) {
+	if arg == "~" {
+		return Delay{Stopped: true}, nil
+	}
+
+	minutes, err := strconv.ParseUint(arg, 10, 8)
+	if err != nil {
+		return nil, err
+	}
+
+	return Delay{Minutes: uint8(minutes)}, nil
+}
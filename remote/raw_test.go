@@ -0,0 +1,119 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestSendRaw(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+	control := connectToSimulator(t, amp)
+
+	resp, err := control.SendRaw('v', "20")
+	assert.NoError(t, err)
+	assert.Equal(t, Response{Command: 'v', Arg: "20", Value: uint8(20)}, resp)
+	assert.Equal(t, "-v.20", resp.String())
+	assert.Equal(t, 20, amp.State().Volume)
+
+	resp, err = control.SendRaw('p', "t")
+	assert.NoError(t, err)
+	assert.Equal(t, Response{Command: 'p', Arg: "1", Value: true}, resp)
+
+	resp, err = control.SendRaw('r', "~")
+	assert.NoError(t, err)
+	assert.Equal(t, Response{Command: 'r', Arg: "~", Value: Delay{Stopped: true}}, resp)
+
+	_, err = control.SendRaw('x', "?")
+	assert.EqualError(t, err, "unknown command")
+
+	_, err = control.SendRaw('v', "101")
+	assert.EqualError(t, err, "invalid parameter")
+
+	_, err = control.SendRaw('-', "?")
+	assert.Error(t, err)
+	_, err = control.SendRaw('v', "1\r-p.1")
+	assert.Error(t, err)
+	_, err = control.SendRaw('v', "")
+	assert.Error(t, err)
+}
+
+func TestSendRawVolumeLimit(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+	amp.SetVolume(40)
+	control := connectToSimulator(t, amp)
+	control.SetVolumeLimit(&VolumeLimit{Max: 40})
+
+	limitErr := &VolumeLimitError{}
+	_, err := control.SendRaw('v', "41")
+	assert.True(t, errors.As(err, &limitErr))
+	_, err = control.SendRaw('v', "u")
+	assert.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, 40, amp.State().Volume)
+
+	resp, err := control.SendRaw('v', "d")
+	assert.NoError(t, err)
+	assert.Equal[any](t, uint8(39), resp.Value)
+}
+
+func TestRegisterCommand(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+	amp.HandleCommand('b', func(argument string) (string, bool) {
+		return strings.Replace(argument, "?", "3", 1), true
+	})
+	control := connectToSimulator(t, amp)
+
+	resp, err := control.SendRaw('b', "3")
+	assert.NoError(t, err)
+	assert.Equal(t, Response{Command: 'b', Arg: "3"}, resp)
+
+	err = control.RegisterCommand('b', Command{Parse: func(arg string) (any, error) { return strconv.Atoi(arg) }})
+	assert.NoError(t, err)
+
+	resp, err = control.SendRaw('b', "?")
+	assert.NoError(t, err)
+	assert.Equal(t, Response{Command: 'b', Arg: "3", Value: 3}, resp)
+
+	_, err = control.SendRaw('b', "left")
+	assert.Error(t, err)
+
+	assert.Error(t, control.RegisterCommand('v', Command{}))
+	assert.Error(t, control.RegisterCommand('e', Command{}))
+	assert.Error(t, control.RegisterCommand('.', Command{}))
+}
+
+func TestRegisterCommandNotifications(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+
+	errs := make(chan error, 1)
+	control := NewControlWithListener(nil, nil, nil, nil, nil, func(err error) { errs <- err })
+	notified := make(chan Response, 1)
+	err := control.RegisterCommand('b', Command{
+		Parse:          parseUint8Arg,
+		OnNotification: func(resp Response) { notified <- resp },
+	})
+	assert.NoError(t, err)
+
+	err = control.ConnectWithConfig(context.Background(), "127.0.0.1", amp.Model(), ConnectConfig{Port: amp.Port()})
+	assert.NoError(t, err)
+	defer control.Disconnect()
+
+	amp.Notify('b', "7")
+	assert.Equal(t, Response{Command: 'b', Arg: "7", Value: uint8(7)}, <-notified)
+
+	// Unknown commands are reported without stopping the listener.
+	amp.Notify('q', "1")
+	assert.EqualError(t, <-errs, `received unknown command "q" from amplifier`)
+
+	amp.Notify('b', "x")
+	assert.Error(t, <-errs)
+
+	amp.Notify('b', "8")
+	assert.Equal(t, Response{Command: 'b', Arg: "8", Value: uint8(8)}, <-notified)
+	assert.Equal(t, Connected, control.GetConnectionState())
+}
@@ -0,0 +1,204 @@
+package remote
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// ConnectionState describes the state of the connection to the amplifier.
+type ConnectionState int32
+
+// Possible states of the connection to the amplifier.
+const (
+	Disconnected ConnectionState = iota // Not connected, either never connected or disconnected on request.
+	Connecting                          // Connecting for the first time.
+	Connected                           // Connected and ready to send commands.
+	Reconnecting                        // The connection was lost and reconnecting is in progress.
+	GaveUp                              // Reconnecting failed too many times and was stopped.
+)
+
+// String returns a human readable name for the connection state.
+func (s ConnectionState) String() string {
+	switch s {
+	case Disconnected:
+		return "Disconnected"
+	case Connecting:
+		return "Connecting"
+	case Connected:
+		return "Connected"
+	case Reconnecting:
+		return "Reconnecting"
+	case GaveUp:
+		return "Gave up reconnecting"
+	}
+
+	return "Unknown"
+}
+
+const (
+	defaultInitialDelay = 500 * time.Millisecond
+	defaultMaxDelay     = 30 * time.Second
+	defaultMultiplier   = 2
+)
+
+// ReconnectPolicy specifies how to reconnect when the connection to the amplifier is lost.
+// The delay between attempts starts at InitialDelay and grows by Multiplier up to MaxDelay.
+type ReconnectPolicy struct {
+	// InitialDelay is the delay before the first attempt. Defaults to 500 milliseconds.
+	InitialDelay time.Duration
+
+	// MaxDelay limits how long the delay may grow. Defaults to 30 seconds.
+	MaxDelay time.Duration
+
+	// Multiplier is how much the delay grows after each attempt. Defaults to 2.
+	Multiplier float64
+
+	// Jitter is the fraction of the delay, from 0 to 1, to randomly add or subtract.
+	// It keeps several clients from reconnecting in lockstep.
+	Jitter float64
+
+	// MaxAttempts is the number of attempts before giving up. Zero means never giving up.
+	MaxAttempts int
+}
+
+func (p *ReconnectPolicy) delay(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = defaultMultiplier
+	}
+
+	maxDelay := float64(cmp.Or(p.MaxDelay, defaultMaxDelay))
+	delay := float64(cmp.Or(p.InitialDelay, defaultInitialDelay)) * math.Pow(multiplier, float64(attempt))
+	delay = min(delay, maxDelay)
+
+	if jitter := min(max(p.Jitter, 0), 1); jitter > 0 {
+		delay += delay * jitter * (2*rand.Float64() - 1) // #nosec G404 -- No need for secure randomness.
+	}
+
+	return time.Duration(delay)
+}
+
+// GetConnectionState returns the current state of the connection.
+func (c *ControlWithListener) GetConnectionState() ConnectionState {
+	return ConnectionState(c.connState.Load())
+}
+
+func (c *ControlWithListener) setConnectionState(state ConnectionState) {
+	if ConnectionState(c.connState.Swap(int32(state))) == state {
+		return
+	}
+
+	c.emit(ConnectionStateChanged{State: state})
+}
+
+// handleSessionEnd is called when the connection was lost without calling Disconnect.
+func (c *ControlWithListener) handleSessionEnd(err error) {
+	if c.closing.Load() {
+		return
+	}
+
+	if c.Reconnect == nil {
+		c.setConnectionState(Disconnected)
+		c.emit(ErrorReceived{Err: err})
+		return
+	}
+
+	c.reconnect(c.Reconnect, err)
+}
+
+func (c *ControlWithListener) reconnect(policy *ReconnectPolicy, cause error) {
+	c.lock.Lock()
+	stop, host, config := c.stop, c.host, c.config
+	c.lock.Unlock()
+
+	if stop == nil {
+		return // Disconnected while shutting down the old session.
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	c.setConnectionState(Reconnecting)
+	for attempt := 0; policy.MaxAttempts <= 0 || attempt < policy.MaxAttempts; attempt++ {
+		select {
+		case <-time.After(policy.delay(attempt)):
+		case <-ctx.Done():
+			return
+		}
+
+		err := c.redial(ctx, host, config)
+		if err == nil {
+			c.setConnectionState(Connected)
+			c.resync(ctx)
+			return
+		} else if ctx.Err() != nil {
+			return
+		}
+
+		cause = err
+	}
+
+	c.setConnectionState(GaveUp)
+	c.emit(ErrorReceived{Err: cause})
+}
+
+// redial opens a new connection with the same settings and takes it into use.
+func (c *ControlWithListener) redial(ctx context.Context, host string, config ConnectConfig) error {
+	fresh := Control{}
+	err := fresh.ConnectWithConfig(ctx, host, c.control.deviceType, config)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	if ctx.Err() != nil {
+		c.lock.Unlock()
+		return fresh.Disconnect()
+	}
+
+	// The connection of the session that ended is of no more use.
+	_ = c.control.Disconnect()
+	c.control.conn, c.control.packets = fresh.conn, fresh.packets
+	c.lock.Unlock()
+
+	c.startSession(fresh.conn, fresh.packets)
+
+	// Errors here make the new session end, which then starts another reconnection.
+	_, _ = c.SetResetDelayContext(ctx, 3)
+	return nil
+}
+
+// resync fetches the state again and calls the callbacks for anything that
+// changed, or was not known before, while disconnected. [Resynced] is sent last.
+func (c *ControlWithListener) resync(ctx context.Context) {
+	before := c.Snapshot()
+	if c.fetchState(ctx) != nil {
+		return
+	}
+
+	after := c.Snapshot()
+	if before.PowerUpdated.IsZero() || before.Power != after.Power {
+		c.emit(PowerChanged{PoweredOn: after.Power})
+	}
+	if before.VolumeUpdated.IsZero() || before.Volume != after.Volume {
+		c.emit(VolumeChanged{Volume: after.Volume})
+	}
+	if before.MuteUpdated.IsZero() || before.Mute != after.Mute {
+		c.emit(MuteChanged{Muted: after.Mute})
+	}
+	if before.InputUpdated.IsZero() || before.Input != after.Input {
+		c.emit(InputChanged{Input: after.Input})
+	}
+
+	c.emit(Resynced{})
+}
@@ -0,0 +1,210 @@
+package remote
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestReconnectPolicyDelay(t *testing.T) {
+	policy := &ReconnectPolicy{}
+	assert.Equal(t, defaultInitialDelay, policy.delay(0))
+	assert.Equal(t, 2*defaultInitialDelay, policy.delay(1))
+	assert.Equal(t, defaultMaxDelay, policy.delay(100))
+
+	policy = &ReconnectPolicy{InitialDelay: time.Second, MaxDelay: 5 * time.Second, Multiplier: 3}
+	assert.Equal(t, time.Second, policy.delay(0))
+	assert.Equal(t, 3*time.Second, policy.delay(1))
+	assert.Equal(t, 5*time.Second, policy.delay(2))
+
+	policy.Jitter = 0.5
+	for range 100 {
+		delay := policy.delay(0)
+		assert.True(t, delay >= time.Second/2 && delay <= 3*time.Second/2)
+	}
+}
+
+type stateRecorder struct {
+	lock   sync.Mutex
+	states []ConnectionState
+	seen   chan ConnectionState
+}
+
+func (r *stateRecorder) record(state ConnectionState) {
+	r.lock.Lock()
+	r.states = append(r.states, state)
+	r.lock.Unlock()
+	r.seen <- state
+}
+
+func (r *stateRecorder) waitFor(t *testing.T, state ConnectionState) {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case got := <-r.seen:
+			if got == state {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for state %s", state)
+		}
+	}
+}
+
+func TestReconnectAfterReset(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+
+	resets := make(chan struct{}, 1)
+	volumes := make(chan Volume, 4)
+	recorder := &stateRecorder{seen: make(chan ConnectionState, 16)}
+	control := NewControlWithListener(
+		func(bool) {}, func(v Volume) { volumes <- v }, func(bool) {}, func(device.Input) {},
+		func() { resets <- struct{}{} },
+		func(err error) { t.Errorf("unexpected error: %v", err) },
+	)
+	control.OnConnectionState = recorder.record
+	control.Reconnect = &ReconnectPolicy{InitialDelay: 20 * time.Millisecond}
+
+	err := control.ConnectWithConfig(context.Background(), "127.0.0.1", device.H95, ConnectConfig{Port: amp.Port()})
+	assert.NoError(t, err)
+	defer control.Disconnect()
+
+	_, err = control.SetVolume(10)
+	assert.NoError(t, err)
+
+	amp.Reset()
+	amp.SetVolume(40) // Changed while the client is disconnected.
+	<-resets
+
+	recorder.waitFor(t, Reconnecting)
+	recorder.waitFor(t, Connected)
+	assert.Equal(t, 40, <-volumes)
+
+	volume, err := control.VolumeUp()
+	assert.NoError(t, err)
+	assert.Equal(t, 41, volume)
+	assert.Equal(t, 3, amp.State().ResetDelay)
+
+	assert.NoError(t, control.Disconnect())
+	recorder.waitFor(t, Disconnected)
+
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	assert.Equal(t, []ConnectionState{Connecting, Connected, Reconnecting, Connected, Disconnected}, recorder.states)
+}
+
+// trackedConn is a connection that remembers being closed.
+type trackedConn struct {
+	net.Conn
+	closed atomic.Bool
+}
+
+func (c *trackedConn) Close() error {
+	c.closed.Store(true)
+	return c.Conn.Close()
+}
+
+func TestReconnectClosesLostConnection(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+
+	conns := make(chan *trackedConn, 4)
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := (&net.Dialer{}).DialContext(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+
+		tracked := &trackedConn{Conn: conn}
+		conns <- tracked
+		return tracked, nil
+	}
+
+	recorder := &stateRecorder{seen: make(chan ConnectionState, 16)}
+	control := NewControlWithListener(nil, nil, nil, nil, nil, nil)
+	control.OnConnectionState = recorder.record
+	control.Reconnect = &ReconnectPolicy{InitialDelay: 20 * time.Millisecond}
+
+	err := control.ConnectWithConfig(context.Background(), "127.0.0.1", device.H95, ConnectConfig{Port: amp.Port(), Dial: dial})
+	assert.NoError(t, err)
+	defer control.Disconnect()
+	first := <-conns
+
+	amp.Reset()
+	recorder.waitFor(t, Reconnecting)
+	recorder.waitFor(t, Connected)
+
+	second := <-conns
+	assert.True(t, first.closed.Load())
+	assert.False(t, second.closed.Load())
+}
+
+func TestReconnectGivesUp(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+
+	errs := make(chan error, 1)
+	recorder := &stateRecorder{seen: make(chan ConnectionState, 16)}
+	control := NewControlWithListener(
+		func(bool) {}, func(Volume) {}, func(bool) {}, func(device.Input) {}, func() {},
+		func(err error) { errs <- err },
+	)
+	control.OnConnectionState = recorder.record
+	control.Reconnect = &ReconnectPolicy{InitialDelay: time.Millisecond, MaxAttempts: 3}
+
+	err := control.ConnectWithConfig(context.Background(), "127.0.0.1", device.H95, ConnectConfig{Port: amp.Port()})
+	assert.NoError(t, err)
+	defer control.Disconnect()
+
+	assert.NoError(t, amp.Close())
+	recorder.waitFor(t, GaveUp)
+	assert.Error(t, <-errs)
+
+	_, err = control.GetPower()
+	assert.Error(t, err)
+}
+
+func TestDisconnectStopsReconnecting(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+
+	recorder := &stateRecorder{seen: make(chan ConnectionState, 16)}
+	control := NewControlWithListener(
+		func(bool) {}, func(Volume) {}, func(bool) {}, func(device.Input) {}, func() {},
+		func(err error) { t.Errorf("unexpected error: %v", err) },
+	)
+	control.OnConnectionState = recorder.record
+	control.Reconnect = &ReconnectPolicy{InitialDelay: time.Hour}
+
+	err := control.ConnectWithConfig(context.Background(), "127.0.0.1", device.H95, ConnectConfig{Port: amp.Port()})
+	assert.NoError(t, err)
+
+	amp.Reset()
+	recorder.waitFor(t, Reconnecting)
+
+	assert.NoError(t, control.Disconnect())
+	recorder.waitFor(t, Disconnected)
+}
+
+func TestNoReconnectByDefault(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+
+	errs := make(chan error, 1)
+	control := NewControlWithListener(
+		func(bool) {}, func(Volume) {}, func(bool) {}, func(device.Input) {}, func() {},
+		func(err error) { errs <- err },
+	)
+
+	err := control.ConnectWithConfig(context.Background(), "127.0.0.1", device.H95, ConnectConfig{Port: amp.Port()})
+	assert.NoError(t, err)
+	defer control.Disconnect()
+
+	amp.Reset()
+	assert.Error(t, <-errs)
+	assert.Equal(t, Disconnected, control.GetConnectionState())
+}
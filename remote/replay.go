@@ -0,0 +1,225 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+var errNoMoreConnections = errors.New("no more connections in transcript")
+
+// Replay serves a transcript written by [Recorder], or by hand, back to a client.
+// Pass [Replay.Dial] as [ConnectConfig.Dial] to connect to it instead of an amplifier.
+//
+// The replay is deterministic and does not wait for the recorded times.
+// Data recorded as read is returned once every write recorded before it has been made,
+// one read at a time, and writes must match the recorded writes exactly.
+// Each connect line starts a new connection, which a reconnecting [ControlWithListener]
+// will dial. A transcript without connect lines is served as one connection.
+// This data type is thread safe.
+type Replay struct {
+	lock        sync.Mutex
+	connections [][]transcriptEntry
+}
+
+// NewReplay reads a transcript to be replayed.
+func NewReplay(r io.Reader) (*Replay, error) {
+	entries, err := parseTranscript(r)
+	if err != nil {
+		return nil, err
+	}
+
+	replay := &Replay{}
+	for i, entry := range entries {
+		if entry.kind == entryConnect || i == 0 {
+			replay.connections = append(replay.connections, nil)
+		}
+
+		last := len(replay.connections) - 1
+		replay.connections[last] = append(replay.connections[last], entry)
+	}
+
+	return replay, nil
+}
+
+// Dial opens the next connection of the transcript. The address is not checked against it.
+func (r *Replay) Dial(ctx context.Context, network, address string) (net.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if len(r.connections) == 0 {
+		return nil, errNoMoreConnections
+	}
+
+	entries := r.connections[0]
+	r.connections = r.connections[1:]
+
+	conn := &replayConn{entries: entries, address: replayAddr(address)}
+	conn.cond = sync.NewCond(&conn.lock)
+	conn.writeNext = conn.nextSend(0)
+	return conn, nil
+}
+
+type replayAddr string
+
+func (a replayAddr) Network() string {
+	return "replay"
+}
+
+func (a replayAddr) String() string {
+	return string(a)
+}
+
+// replayConn is a connection serving one connection of a transcript.
+type replayConn struct {
+	entries []transcriptEntry
+	address replayAddr
+
+	lock      sync.Mutex
+	cond      *sync.Cond
+	readNext  int
+	writeNext int
+	pending   []byte
+	closed    bool
+	deadline  time.Time
+	timer     *time.Timer
+}
+
+func (c *replayConn) Read(p []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for {
+		if c.closed {
+			return 0, net.ErrClosed
+		}
+
+		if len(c.pending) > 0 {
+			n := copy(p, c.pending)
+			c.pending = c.pending[n:]
+			return n, nil
+		}
+
+		if !c.deadline.IsZero() && !time.Now().Before(c.deadline) {
+			return 0, os.ErrDeadlineExceeded
+		}
+
+		if entry, ok := c.nextRead(); ok {
+			if entry.kind == entryEOF {
+				return 0, io.EOF
+			}
+
+			c.pending = entry.data
+			c.readNext++
+			continue
+		}
+
+		c.cond.Wait()
+	}
+}
+
+// nextRead returns the next entry to read, if every write recorded before it has been made.
+func (c *replayConn) nextRead() (transcriptEntry, bool) {
+	for ; c.readNext < len(c.entries); c.readNext++ {
+		entry := c.entries[c.readNext]
+		if entry.kind == entryRecv || entry.kind == entryEOF {
+			return entry, c.writeNext > c.readNext
+		}
+	}
+
+	return transcriptEntry{}, false
+}
+
+// nextSend returns the index of the next recorded write, starting at from.
+func (c *replayConn) nextSend(from int) int {
+	for i := from; i < len(c.entries); i++ {
+		if c.entries[i].kind == entrySend {
+			return i
+		}
+	}
+
+	return len(c.entries)
+}
+
+func (c *replayConn) Write(p []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+
+	if c.writeNext == len(c.entries) {
+		return 0, fmt.Errorf("unexpected write of %q after the end of the transcript", p)
+	}
+
+	expected := c.entries[c.writeNext]
+	if !bytes.Equal(expected.data, p) {
+		return 0, fmt.Errorf("transcript line %d: expected write of %q, got %q", expected.line, expected.data, p)
+	}
+
+	c.writeNext = c.nextSend(c.writeNext + 1)
+	c.cond.Broadcast()
+	return len(p), nil
+}
+
+func (c *replayConn) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.closed = true
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.cond.Broadcast()
+	return nil
+}
+
+func (c *replayConn) LocalAddr() net.Addr {
+	return replayAddr("replay")
+}
+
+func (c *replayConn) RemoteAddr() net.Addr {
+	return c.address
+}
+
+func (c *replayConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *replayConn) SetReadDeadline(t time.Time) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.deadline = t
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	if !t.IsZero() {
+		c.timer = time.AfterFunc(time.Until(t), c.wake)
+	}
+
+	c.cond.Broadcast()
+	return nil
+}
+
+// SetWriteDeadline does nothing as writes never block.
+func (c *replayConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+func (c *replayConn) wake() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.cond.Broadcast()
+}
@@ -0,0 +1,151 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/alecthomas/assert/v2"
+)
+
+func newReplay(t *testing.T, transcript string) *Replay {
+	t.Helper()
+
+	replay, err := NewReplay(strings.NewReader(transcript))
+	assert.NoError(t, err)
+	return replay
+}
+
+func connectToReplay(t *testing.T, replay *Replay) *Control {
+	t.Helper()
+
+	control := &Control{}
+	err := control.ConnectWithConfig(context.Background(), "amp", device.H95, ConnectConfig{Dial: replay.Dial})
+	assert.NoError(t, err)
+	t.Cleanup(func() { control.Disconnect() })
+	return control
+}
+
+func TestReplay(t *testing.T) {
+	replay := newReplay(t, `
+# The volume response is split over two reads.
+send "-v.?\r"
+recv "-v.2"
+recv "0\r"
+
+send "-i.9\r"
+recv "-e.3\r"
+
+send "-p.?\r"
+`)
+	control := connectToReplay(t, replay)
+
+	volume, err := control.GetVolume()
+	assert.NoError(t, err)
+	assert.Equal(t, 20, volume)
+
+	_, err = control.SendRaw('i', "9")
+	assert.EqualError(t, err, "invalid parameter")
+
+	_, err = control.GetVolume()
+	assert.EqualError(t, err, `transcript line 10: expected write of "-p.?\r", got "-v.?\r"`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = control.GetPowerContext(ctx)
+	assert.IsError(t, err, context.DeadlineExceeded)
+
+	_, err = control.GetPower()
+	assert.EqualError(t, err, `unexpected write of "-p.?\r" after the end of the transcript`)
+
+	_, err = replay.Dial(context.Background(), "tcp", "amp:50001")
+	assert.IsError(t, err, errNoMoreConnections)
+}
+
+func TestReplayEOF(t *testing.T) {
+	control := connectToReplay(t, newReplay(t, `
+send "-p.1\r"
+eof
+`))
+
+	_, err := control.SetPower(true)
+	assert.Error(t, err)
+}
+
+func TestReplayListener(t *testing.T) {
+	connection := func(volume string) string {
+		return `
+connect "amp:50001"
+send "-r.3\r"
+recv "-r.3\r"
+send "-p.?\r"
+recv "-p.1\r"
+send "-v.?\r"
+recv "-v.` + volume + `\r"
+send "-m.?\r"
+recv "-m.0\r"
+send "-i.?\r"
+recv "-i.2\r"
+`
+	}
+
+	// The amplifier reports a change and then resets the connection. The volume is
+	// changed again while disconnected and found when reconnecting.
+	replay := newReplay(t, connection("20")+`
+recv "-v.25\r"
+recv "-r.0\r"
+eof
+`+connection("30"))
+
+	control := NewControlWithListener(nil, nil, nil, nil, nil, func(err error) { t.Errorf("unexpected error: %v", err) })
+	control.Reconnect = &ReconnectPolicy{InitialDelay: time.Millisecond}
+	events := control.SubscribeWithConfig(t.Context(), SubscribeConfig{Buffer: 64})
+
+	err := control.ConnectWithConfig(context.Background(), "amp", device.H95, ConnectConfig{Dial: replay.Dial})
+	assert.NoError(t, err)
+	defer control.Disconnect()
+
+	assertEvent(t, events, ConnectionStateChanged{State: Connecting})
+	assertEvent(t, events, ConnectionStateChanged{State: Connected})
+	assertEvent(t, events, VolumeChanged{Volume: 25})
+	assertEvent(t, events, ResetReceived{})
+	assertEvent(t, events, ConnectionStateChanged{State: Reconnecting})
+	assertEvent(t, events, ConnectionStateChanged{State: Connected})
+	assertEvent(t, events, VolumeChanged{Volume: 30})
+	assertEvent(t, events, Resynced{})
+
+	assert.Equal(t, 30, control.Snapshot().Volume)
+	assert.Equal(t, 2, control.Snapshot().Input)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	session := func(control *Control) []any {
+		volume, err := control.SetVolume(35)
+		assert.NoError(t, err)
+		input, err := control.SetInput(4)
+		assert.NoError(t, err)
+		delay, err := control.StopResetDelay()
+		assert.NoError(t, err)
+		_, err = control.SendRaw('z', "1")
+		return []any{volume, input, delay, err.Error()}
+	}
+
+	amp := newSimulator(t, device.H95)
+	transcript := &bytes.Buffer{}
+	recorder := NewRecorder(transcript)
+
+	control := &Control{}
+	err := control.ConnectWithConfig(context.Background(), "127.0.0.1", device.H95, ConnectConfig{
+		Port: amp.Port(),
+		Dial: recorder.WrapDial(nil),
+	})
+	assert.NoError(t, err)
+	recorded := session(control)
+	assert.NoError(t, control.Disconnect())
+
+	replayed := session(connectToReplay(t, newReplay(t, transcript.String())))
+	assert.Equal(t, recorded, replayed)
+}
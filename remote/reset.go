@@ -1,5 +1,7 @@
 package remote
 
+import "context"
+
 // Delay specifies the status of the connection reset.
 type Delay struct {
 	Minutes Minutes
@@ -11,28 +13,38 @@ type Minutes = uint8
 
 // SetResetDelay sets a timeout, in minutes, for when to reset.
 func (c *Control) SetResetDelay(delay Minutes) (Delay, error) {
+	return c.SetResetDelayContext(context.Background(), delay)
+}
+
+// SetResetDelayContext is like [Control.SetResetDelay] but gives up when the context is done.
+func (c *Control) SetResetDelayContext(ctx context.Context, delay Minutes) (Delay, error) {
 	packet := createNumericalPacket('r', delay)
-	return c.reset(packet)
+	return c.reset(ctx, packet)
 }
 
 // StopResetDelay stops the delayed reset from happening.
 func (c *Control) StopResetDelay() (Delay, error) {
-	return c.reset([]byte("-r.~\r"))
+	return c.StopResetDelayContext(context.Background())
+}
+
+// StopResetDelayContext is like [Control.StopResetDelay] but gives up when the context is done.
+func (c *Control) StopResetDelayContext(ctx context.Context) (Delay, error) {
+	return c.reset(ctx, []byte("-r.~\r"))
 }
 
 // GetResetDelay returns the current delay until reset.
 // Returns the delay or a bool indicating if it is stopped or not.
 func (c *Control) GetResetDelay() (Delay, error) {
-	return c.reset([]byte("-r.?\r"))
+	return c.GetResetDelayContext(context.Background())
 }
 
-func (c *Control) reset(packet []byte) (Delay, error) {
-	_, err := c.conn.Write(packet)
-	if err != nil {
-		return Delay{}, err
-	}
+// GetResetDelayContext is like [Control.GetResetDelay] but gives up when the context is done.
+func (c *Control) GetResetDelayContext(ctx context.Context) (Delay, error) {
+	return c.reset(ctx, []byte("-r.?\r"))
+}
 
-	buf, err := c.read('r')
+func (c *Control) reset(ctx context.Context, packet []byte) (Delay, error) {
+	buf, err := c.send(ctx, packet)
 	if err != nil {
 		return Delay{}, err
 	}
@@ -0,0 +1,205 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Jacalz/hegelmote/device"
+)
+
+// Names of the steps that a scene is applied in.
+const (
+	SceneStepPower  = "power"
+	SceneStepInput  = "input"
+	SceneStepVolume = "volume"
+	SceneStepMute   = "mute"
+)
+
+const (
+	inputRetryInterval = 250 * time.Millisecond
+	inputReadyTimeout  = 10 * time.Second
+	rollbackTimeout    = 5 * time.Second
+)
+
+// Scene describes a target state for the amplifier, like "Vinyl evening".
+// Fields that are left out are not changed when applying the scene.
+// Scenes can be stored as JSON.
+type Scene struct {
+	Name string `json:"name"`
+
+	Power *bool `json:"power,omitempty"`
+
+	// Input is the name of the input, as returned by [device.GetInputNames].
+	Input string `json:"input,omitempty"`
+
+	Volume *Volume `json:"volume,omitempty"`
+	Mute   *bool   `json:"mute,omitempty"`
+}
+
+// SceneError describes which step of a scene that failed.
+type SceneError struct {
+	Scene string
+
+	// Step is the step that failed, one of the SceneStep constants.
+	Step string
+	Err  error
+
+	// RollbackErr is set if the steps that succeeded could not be undone.
+	RollbackErr error
+}
+
+// Error returns a description of the failed step.
+func (e *SceneError) Error() string {
+	msg := fmt.Sprintf("scene %q failed to set %s: %v", e.Scene, e.Step, e.Err)
+	if e.RollbackErr != nil {
+		msg += fmt.Sprintf(" (rollback failed: %v)", e.RollbackErr)
+	}
+	return msg
+}
+
+// Unwrap returns the error that made the step fail.
+func (e *SceneError) Unwrap() error {
+	return e.Err
+}
+
+type sceneStep struct {
+	name  string
+	apply func(ctx context.Context) (undo func(ctx context.Context) error, err error)
+}
+
+// Apply changes the amplifier to the state of the scene. The power is turned on first,
+// the input is changed once the amplifier accepts it and the volume is set last,
+// unmuting only after the volume has been set. Turning the power off is done last.
+// If a step fails, the steps that already succeeded are rolled back and a [*SceneError] is returned.
+func (s *Scene) Apply(ctx context.Context, amp Amplifier) error {
+	var input device.Input
+	if s.Input != "" {
+		var err error
+		input, err = device.InputFromName(amp.GetDeviceType(), s.Input)
+		if err != nil {
+			return &SceneError{Scene: s.Name, Step: SceneStepInput, Err: err}
+		}
+	}
+
+	var undos []func(ctx context.Context) error
+	for _, step := range s.steps(amp, input) {
+		undo, err := step.apply(ctx)
+		if err != nil {
+			return &SceneError{Scene: s.Name, Step: step.name, Err: err, RollbackErr: rollback(ctx, undos)}
+		}
+
+		if undo != nil {
+			undos = append(undos, undo)
+		}
+	}
+
+	return nil
+}
+
+func (s *Scene) steps(amp Amplifier, input device.Input) []sceneStep {
+	steps := []sceneStep{}
+	poweredOn := false
+
+	if s.Power != nil && *s.Power {
+		steps = append(steps, sceneStep{SceneStepPower, func(ctx context.Context) (func(context.Context) error, error) {
+			undo, err := change(ctx, true, amp.GetPowerContext, amp.SetPowerContext)
+			poweredOn = undo != nil
+			return undo, err
+		}})
+	}
+
+	if input != 0 {
+		steps = append(steps, sceneStep{SceneStepInput, func(ctx context.Context) (func(context.Context) error, error) {
+			set := amp.SetInputContext
+			if poweredOn {
+				set = retryUntilReady(set)
+			}
+			return change(ctx, input, amp.GetInputContext, set)
+		}})
+	}
+
+	volume := func(ctx context.Context) (func(context.Context) error, error) {
+		return change(ctx, *s.Volume, amp.GetVolumeContext, amp.SetVolumeContext)
+	}
+	mute := func(ctx context.Context) (func(context.Context) error, error) {
+		return change(ctx, *s.Mute, amp.GetVolumeMuteContext, amp.SetVolumeMuteContext)
+	}
+
+	// Mute before changing volume, but only unmute once the volume is set.
+	if s.Mute != nil && *s.Mute {
+		steps = append(steps, sceneStep{SceneStepMute, mute})
+	}
+	if s.Volume != nil {
+		steps = append(steps, sceneStep{SceneStepVolume, volume})
+	}
+	if s.Mute != nil && !*s.Mute {
+		steps = append(steps, sceneStep{SceneStepMute, mute})
+	}
+
+	if s.Power != nil && !*s.Power {
+		steps = append(steps, sceneStep{SceneStepPower, func(ctx context.Context) (func(context.Context) error, error) {
+			return change(ctx, false, amp.GetPowerContext, amp.SetPowerContext)
+		}})
+	}
+
+	return steps
+}
+
+// change sets the target value and returns a function to restore the previous value.
+// Nothing is done, and no function is returned, if the value already is as expected.
+func change[T comparable](
+	ctx context.Context, target T,
+	get func(context.Context) (T, error), set func(context.Context, T) (T, error),
+) (func(context.Context) error, error) {
+	previous, err := get(ctx)
+	if err != nil {
+		return nil, err
+	} else if previous == target {
+		return nil, nil
+	}
+
+	_, err = set(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context) error {
+		_, err := set(ctx, previous)
+		return err
+	}, nil
+}
+
+// retryUntilReady retries setting the input while the amplifier is starting up.
+func retryUntilReady(set func(context.Context, device.Input) (device.Input, error)) func(context.Context, device.Input) (device.Input, error) {
+	return func(ctx context.Context, input device.Input) (device.Input, error) {
+		deadline := time.Now().Add(inputReadyTimeout)
+		for {
+			result, err := set(ctx, input)
+			if err == nil || time.Now().After(deadline) {
+				return result, err
+			}
+
+			select {
+			case <-time.After(inputRetryInterval):
+			case <-ctx.Done():
+				return result, errors.Join(err, ctx.Err())
+			}
+		}
+	}
+}
+
+// rollback undoes the steps in reverse order. It keeps going even if the
+// context that applied the scene is done, but gives up after a while.
+func rollback(ctx context.Context, undos []func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+
+	var errs []error
+	for i := len(undos) - 1; i >= 0; i-- {
+		errs = append(errs, undos[i](ctx))
+	}
+
+	return errors.Join(errs...)
+}
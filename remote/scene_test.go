@@ -0,0 +1,151 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/Jacalz/hegelmote/remote/hegelsim"
+	"github.com/alecthomas/assert/v2"
+)
+
+// recordingAmplifier records the commands that change state and can fail them on request.
+type recordingAmplifier struct {
+	Amplifier
+	calls      []string
+	failVolume error
+	failInputs int
+}
+
+func (r *recordingAmplifier) SetPowerContext(ctx context.Context, on bool) (bool, error) {
+	r.calls = append(r.calls, fmt.Sprintf("power %t", on))
+	return r.Amplifier.SetPowerContext(ctx, on)
+}
+
+func (r *recordingAmplifier) SetInputContext(ctx context.Context, input device.Input) (device.Input, error) {
+	r.calls = append(r.calls, fmt.Sprintf("input %d", input))
+	if r.failInputs > 0 {
+		r.failInputs--
+		return 0, errors.New("not ready")
+	}
+	return r.Amplifier.SetInputContext(ctx, input)
+}
+
+func (r *recordingAmplifier) SetVolumeContext(ctx context.Context, volume Volume) (Volume, error) {
+	r.calls = append(r.calls, fmt.Sprintf("volume %d", volume))
+	if r.failVolume != nil {
+		return 0, r.failVolume
+	}
+	return r.Amplifier.SetVolumeContext(ctx, volume)
+}
+
+func (r *recordingAmplifier) SetVolumeMuteContext(ctx context.Context, mute bool) (bool, error) {
+	r.calls = append(r.calls, fmt.Sprintf("mute %t", mute))
+	return r.Amplifier.SetVolumeMuteContext(ctx, mute)
+}
+
+func newRecordingAmplifier(t *testing.T, amp *hegelsim.Amplifier) *recordingAmplifier {
+	t.Helper()
+	return &recordingAmplifier{Amplifier: connectToSimulator(t, amp)}
+}
+
+const vinylEvening = `{"name":"Vinyl evening","power":true,"input":"Phono","volume":35,"mute":false}`
+
+func TestSceneJSON(t *testing.T) {
+	scene := Scene{}
+	assert.NoError(t, json.Unmarshal([]byte(vinylEvening), &scene))
+	assert.Equal(t, "Vinyl evening", scene.Name)
+	assert.Equal(t, "Phono", scene.Input)
+	assert.Equal(t, 35, *scene.Volume)
+
+	out, err := json.Marshal(&scene)
+	assert.NoError(t, err)
+	assert.Equal(t, vinylEvening, string(out))
+
+	out, err = json.Marshal(&Scene{Name: "Empty"})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"name":"Empty"}`, string(out))
+}
+
+func TestSceneApply(t *testing.T) {
+	amp := newSimulator(t, device.H190V)
+	amp.SetMute(true)
+	recorder := newRecordingAmplifier(t, amp)
+
+	scene := Scene{}
+	assert.NoError(t, json.Unmarshal([]byte(vinylEvening), &scene))
+	assert.NoError(t, scene.Apply(context.Background(), recorder))
+
+	assert.Equal(t, []string{"power true", "input 10", "volume 35", "mute false"}, recorder.calls)
+	assert.Equal(t, hegelsim.State{Power: true, Volume: 35, Input: 10, ResetStopped: true}, amp.State())
+
+	// Applying again changes nothing.
+	recorder.calls = nil
+	assert.NoError(t, scene.Apply(context.Background(), recorder))
+	assert.Equal(t, nil, recorder.calls)
+}
+
+func TestSceneApplyOrder(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+	amp.SetPower(true)
+	recorder := newRecordingAmplifier(t, amp)
+
+	on, off, volume := true, false, Volume(20)
+	scene := Scene{Name: "Quiet off", Power: &off, Volume: &volume, Mute: &on}
+	assert.NoError(t, scene.Apply(context.Background(), recorder))
+	assert.Equal(t, []string{"mute true", "volume 20", "power false"}, recorder.calls)
+}
+
+func TestSceneApplyRollback(t *testing.T) {
+	amp := newSimulator(t, device.H190V)
+	assert.NoError(t, amp.SetInput(2))
+	before := amp.State()
+	recorder := newRecordingAmplifier(t, amp)
+
+	failure := errors.New("volume broke")
+	recorder.failVolume = failure
+
+	scene := Scene{}
+	assert.NoError(t, json.Unmarshal([]byte(vinylEvening), &scene))
+	err := scene.Apply(context.Background(), recorder)
+	assert.IsError(t, err, failure)
+
+	sceneErr := &SceneError{}
+	assert.True(t, errors.As(err, &sceneErr))
+	assert.Equal(t, SceneStepVolume, sceneErr.Step)
+	assert.Equal(t, "Vinyl evening", sceneErr.Scene)
+	assert.NoError(t, sceneErr.RollbackErr)
+
+	assert.Equal(t, []string{"power true", "input 10", "volume 35", "input 2", "power false"}, recorder.calls)
+	assert.Equal(t, before, amp.State())
+}
+
+func TestSceneApplyUnknownInput(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+	recorder := newRecordingAmplifier(t, amp)
+
+	on := true
+	scene := Scene{Name: "Records", Power: &on, Input: "Phono"}
+	err := scene.Apply(context.Background(), recorder)
+
+	sceneErr := &SceneError{}
+	assert.True(t, errors.As(err, &sceneErr))
+	assert.Equal(t, SceneStepInput, sceneErr.Step)
+	assert.Equal(t, nil, recorder.calls)
+	assert.False(t, amp.State().Power)
+}
+
+func TestSceneApplyWaitsForInput(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+	recorder := newRecordingAmplifier(t, amp)
+	recorder.failInputs = 2
+
+	on := true
+	scene := Scene{Name: "Network", Power: &on, Input: "Network"}
+	assert.NoError(t, scene.Apply(context.Background(), recorder))
+	assert.Equal(t, []string{"power true", "input 8", "input 8", "input 8"}, recorder.calls)
+	assert.Equal(t, 8, amp.State().Input)
+}
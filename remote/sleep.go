@@ -0,0 +1,225 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// SleepTimerConfig specifies when and how a sleep timer turns the amplifier off.
+type SleepTimerConfig struct {
+	// Duration is the time until the amplifier is turned off.
+	Duration time.Duration
+
+	// FadeDuration, if set, fades the volume out during the last part of the countdown.
+	// The volume from before the fade is restored once the amplifier is off.
+	FadeDuration time.Duration
+
+	// OnDone, if set, is called when the timer has finished or was cancelled.
+	OnDone func(err error)
+}
+
+// SleepTimer counts down and then turns the amplifier off.
+// It keeps counting while disconnected and waits for the connection
+// to come back when it needs to send commands.
+// This data type is thread safe.
+type SleepTimer struct {
+	control  *ControlWithListener
+	config   SleepTimerConfig
+	deadline time.Time
+	cancel   context.CancelFunc
+	done     chan struct{}
+
+	lock sync.Mutex
+	err  error
+}
+
+// StartSleepTimer starts a sleep timer that turns the amplifier off after the configured duration.
+func (c *ControlWithListener) StartSleepTimer(config SleepTimerConfig) (*SleepTimer, error) {
+	if config.Duration <= 0 {
+		return nil, errors.New("sleep timer duration must be positive")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	timer := &SleepTimer{
+		control:  c,
+		config:   config,
+		deadline: time.Now().Add(config.Duration),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+
+	go timer.run(ctx)
+	return timer, nil
+}
+
+// Remaining returns the time left until the amplifier is turned off.
+func (s *SleepTimer) Remaining() time.Duration {
+	return max(time.Until(s.deadline), 0)
+}
+
+// Deadline returns the time at which the amplifier is turned off.
+func (s *SleepTimer) Deadline() time.Time {
+	return s.deadline
+}
+
+// Cancel stops the timer. If the volume is being faded out, it is set back to where it was before the fade.
+func (s *SleepTimer) Cancel() {
+	s.cancel()
+}
+
+// Done returns a channel that is closed when the timer has finished or was cancelled.
+func (s *SleepTimer) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the reason that the timer stopped, or nil if it finished successfully.
+// It returns [context.Canceled] if the timer was cancelled.
+func (s *SleepTimer) Err() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.err
+}
+
+func (s *SleepTimer) run(ctx context.Context) {
+	err := s.countdown(ctx)
+
+	s.lock.Lock()
+	s.err = err
+	s.lock.Unlock()
+
+	s.cancel()
+	close(s.done)
+	if s.config.OnDone != nil {
+		s.config.OnDone(err)
+	}
+}
+
+func (s *SleepTimer) countdown(ctx context.Context) error {
+	fade := min(max(s.config.FadeDuration, 0), s.config.Duration)
+	err := sleepUntil(ctx, s.deadline.Add(-fade))
+	if err != nil {
+		return err
+	}
+
+	if fade == 0 {
+		return s.retry(ctx, func() error {
+			_, err := s.control.SetPowerContext(ctx, false)
+			return err
+		})
+	}
+
+	var original Volume
+	err = s.retry(ctx, func() error {
+		var err error
+		original, err = s.control.GetVolumeContext(ctx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	s.fadeOut(ctx)
+	if err := sleepUntil(ctx, s.deadline); err != nil {
+		s.restoreVolume(ctx, original)
+		return err
+	}
+
+	// Mute while restoring the volume so that it does not blast out before turning off.
+	steps := []func() error{
+		func() error { _, err := s.control.SetVolumeMuteContext(ctx, true); return err },
+		func() error { _, err := s.control.SetVolumeContext(ctx, original); return err },
+		func() error { _, err := s.control.SetPowerContext(ctx, false); return err },
+		func() error { _, err := s.control.SetVolumeMuteContext(ctx, false); return err },
+	}
+	for _, step := range steps {
+		if err := s.retry(ctx, step); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fadeOut ramps the volume down until the deadline. The fade is given up if
+// someone else changes the volume, but is continued after reconnecting.
+func (s *SleepTimer) fadeOut(ctx context.Context) {
+	for {
+		_, err := s.control.RampVolume(ctx, 0, RampConfig{Duration: s.Remaining()})
+		if err == nil || ctx.Err() != nil || s.Remaining() == 0 || s.control.GetConnectionState() == Connected {
+			return
+		}
+
+		if s.waitForConnection(ctx) != nil {
+			return
+		}
+	}
+}
+
+// restoreVolume sets the volume from before the fade after the timer was cancelled.
+// The context of the timer is done by then, so the volume is set without it.
+func (s *SleepTimer) restoreVolume(ctx context.Context, volume Volume) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), restoreTimeout)
+	defer cancel()
+
+	_, err := s.control.SetVolumeContext(ctx, volume)
+	if err != nil {
+		s.control.emit(ErrorReceived{Err: err})
+	}
+}
+
+// retry runs the operation until it succeeds, waiting for the connection
+// to come back whenever it fails because of being disconnected. It is run
+// again right away if the connection already came back in the meantime.
+func (s *SleepTimer) retry(ctx context.Context, operation func() error) error {
+	for {
+		before := s.control.currentSession()
+		err := operation()
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+
+		if s.control.GetConnectionState() == Connected {
+			if s.control.currentSession() == before {
+				return err // Failed on a working connection.
+			}
+			continue
+		}
+
+		err = s.waitForConnection(ctx)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *SleepTimer) waitForConnection(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events := s.control.Subscribe(ctx)
+	if s.control.GetConnectionState() == Connected {
+		return nil
+	}
+
+	for event := range events {
+		if changed, ok := event.(ConnectionStateChanged); ok && changed.State == Connected {
+			return nil
+		}
+	}
+
+	return ctx.Err()
+}
+
+func sleepUntil(ctx context.Context, deadline time.Time) error {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,158 @@
+package remote
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestSleepTimer(t *testing.T) {
+	amp := newSimulator(t, device.H190)
+	amp.SetPower(true)
+	control := listenToSimulator(t, amp)
+
+	done := make(chan error, 1)
+	timer, err := control.StartSleepTimer(SleepTimerConfig{
+		Duration: 20 * time.Millisecond,
+		OnDone:   func(err error) { done <- err },
+	})
+	assert.NoError(t, err)
+	assert.True(t, timer.Remaining() > 0)
+
+	assert.NoError(t, <-done)
+	<-timer.Done()
+	assert.NoError(t, timer.Err())
+	assert.Equal(t, 0, timer.Remaining())
+	assert.False(t, amp.State().Power)
+
+	_, err = control.StartSleepTimer(SleepTimerConfig{})
+	assert.Error(t, err)
+}
+
+func TestSleepTimerFade(t *testing.T) {
+	amp := newSimulator(t, device.H190)
+	amp.SetPower(true)
+	amp.SetVolume(20)
+	control := listenToSimulator(t, amp)
+
+	// Changes made by the timer are seen as notifications by other clients.
+	observer := listenToSimulator(t, amp)
+	events := observer.SubscribeWithConfig(context.Background(), SubscribeConfig{Buffer: 64})
+
+	timer, err := control.StartSleepTimer(SleepTimerConfig{
+		Duration:     150 * time.Millisecond,
+		FadeDuration: 100 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	<-timer.Done()
+	assert.NoError(t, timer.Err())
+
+	lowest := Volume(100)
+	for len(events) > 0 {
+		if changed, ok := (<-events).(VolumeChanged); ok {
+			lowest = min(lowest, changed.Volume)
+		}
+	}
+	assert.Equal(t, 0, lowest)
+
+	state := amp.State()
+	assert.False(t, state.Power)
+	assert.False(t, state.Mute)
+	assert.Equal(t, 20, state.Volume)
+}
+
+func TestSleepTimerCancel(t *testing.T) {
+	amp := newSimulator(t, device.H190)
+	amp.SetPower(true)
+	control := listenToSimulator(t, amp)
+
+	timer, err := control.StartSleepTimer(SleepTimerConfig{Duration: time.Hour, FadeDuration: time.Minute})
+	assert.NoError(t, err)
+	assert.True(t, timer.Remaining() > 59*time.Minute)
+
+	timer.Cancel()
+	<-timer.Done()
+	assert.IsError(t, timer.Err(), context.Canceled)
+	assert.True(t, amp.State().Power)
+}
+
+func TestSleepTimerCancelDuringFade(t *testing.T) {
+	amp := newSimulator(t, device.H190)
+	amp.SetPower(true)
+	amp.SetVolume(20)
+	control := listenToSimulator(t, amp)
+
+	timer, err := control.StartSleepTimer(SleepTimerConfig{Duration: 2 * time.Second, FadeDuration: 2 * time.Second})
+	assert.NoError(t, err)
+
+	for deadline := time.Now().Add(time.Second); amp.State().Volume == 20; {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the fade to start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	timer.Cancel()
+	<-timer.Done()
+	assert.IsError(t, timer.Err(), context.Canceled)
+
+	state := amp.State()
+	assert.True(t, state.Power)
+	assert.Equal(t, 20, state.Volume)
+}
+
+func TestSleepTimerSurvivesReset(t *testing.T) {
+	amp := newSimulator(t, device.H190)
+	amp.SetPower(true)
+
+	control := NewControlWithListener(nil, nil, nil, nil, nil, nil)
+	control.Reconnect = &ReconnectPolicy{InitialDelay: 50 * time.Millisecond}
+	err := control.ConnectWithConfig(context.Background(), "127.0.0.1", device.H190, ConnectConfig{Port: amp.Port()})
+	assert.NoError(t, err)
+	defer control.Disconnect()
+
+	timer, err := control.StartSleepTimer(SleepTimerConfig{Duration: 20 * time.Millisecond})
+	assert.NoError(t, err)
+	amp.Reset()
+
+	<-timer.Done()
+	assert.NoError(t, timer.Err())
+	assert.False(t, amp.State().Power)
+}
+
+func TestSleepTimerRetriesAfterReconnecting(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+
+	recorder := &stateRecorder{seen: make(chan ConnectionState, 16)}
+	control := NewControlWithListener(nil, nil, nil, nil, nil, nil)
+	control.OnConnectionState = recorder.record
+	control.Reconnect = &ReconnectPolicy{InitialDelay: time.Millisecond}
+	err := control.ConnectWithConfig(context.Background(), "127.0.0.1", device.H95, ConnectConfig{Port: amp.Port()})
+	assert.NoError(t, err)
+	defer control.Disconnect()
+
+	// The first attempt fails because of the connection being lost, which is back before retrying.
+	attempts := 0
+	timer := &SleepTimer{control: control}
+	err = timer.retry(context.Background(), func() error {
+		attempts++
+		if attempts > 1 {
+			_, err := control.GetPower()
+			return err
+		}
+
+		amp.Reset()
+		recorder.waitFor(t, Reconnecting)
+		recorder.waitFor(t, Connected)
+		return errNotConnected
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+
+	// Failing on a working connection is not retried.
+	err = timer.retry(context.Background(), func() error { return errInputIsZero })
+	assert.IsError(t, err, errInputIsZero)
+}
@@ -0,0 +1,114 @@
+package remote
+
+import (
+	"context"
+	"time"
+
+	"github.com/Jacalz/hegelmote/device"
+)
+
+// State is the most recent state reported by the amplifier, either as
+// responses to commands or as notifications. Each field has a time for
+// when it was last updated. A zero time means that the value is not yet known.
+type State struct {
+	Power        bool
+	PowerUpdated time.Time
+
+	Volume        Volume
+	VolumeUpdated time.Time
+
+	Mute        bool
+	MuteUpdated time.Time
+
+	Input        device.Input
+	InputUpdated time.Time
+}
+
+// Known reports if all values of the state have been received from the amplifier.
+func (s State) Known() bool {
+	return !s.PowerUpdated.IsZero() && !s.VolumeUpdated.IsZero() &&
+		!s.MuteUpdated.IsZero() && !s.InputUpdated.IsZero()
+}
+
+// Snapshot returns a copy of the most recently known state of the amplifier.
+// The state is fetched when connecting and then kept up to date without
+// any further round trips to the amplifier.
+func (c *ControlWithListener) Snapshot() State {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	return c.state
+}
+
+// record updates the state from a verified packet sent by the amplifier.
+func (c *ControlWithListener) record(packet []byte) {
+	now := time.Now()
+
+	c.stateLock.Lock()
+	before := c.state
+	c.updateState(packet, now)
+	after := c.state
+	c.stateLock.Unlock()
+
+	c.updateVolumeMemory(before, after)
+}
+
+// updateState applies the packet to the state.
+// The state lock must be held when calling this method.
+func (c *ControlWithListener) updateState(packet []byte, now time.Time) {
+	switch packet[1] {
+	case 'p':
+		c.state.Power = packet[3] == '1'
+		c.state.PowerUpdated = now
+	case 'm':
+		c.state.Mute = packet[3] == '1'
+		c.state.MuteUpdated = now
+	case 'v', 'i':
+		number, err := parseUint8FromBuf(packet)
+		if err != nil {
+			return
+		}
+
+		if packet[1] == 'v' {
+			c.state.Volume = number
+			c.state.VolumeUpdated = now
+		} else {
+			c.state.Input = number
+			c.state.InputUpdated = now
+		}
+	}
+}
+
+// knownInput returns the selected input, if it has been received from the amplifier.
+func (c *ControlWithListener) knownInput() (device.Input, bool) {
+	state := c.Snapshot()
+	return state.Input, !state.InputUpdated.IsZero()
+}
+
+// knownVolume returns the volume, if it has been received from the amplifier.
+func (c *ControlWithListener) knownVolume() (Volume, bool) {
+	state := c.Snapshot()
+	return state.Volume, !state.VolumeUpdated.IsZero()
+}
+
+// fetchState queries the full state from the amplifier.
+// The responses are recorded like any other response and
+// a volume above a clamped limit is turned down afterwards.
+func (c *ControlWithListener) fetchState(ctx context.Context) error {
+	if _, err := c.GetPowerContext(ctx); err != nil {
+		return err
+	}
+
+	if _, err := c.GetVolumeContext(ctx); err != nil {
+		return err
+	}
+
+	if _, err := c.GetVolumeMuteContext(ctx); err != nil {
+		return err
+	}
+
+	if _, err := c.GetInputContext(ctx); err != nil {
+		return err
+	}
+
+	return c.enforceVolumeLimit(ctx)
+}
@@ -0,0 +1,96 @@
+package remote
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestSnapshot(t *testing.T) {
+	amp := newSimulator(t, device.H190)
+	amp.SetPower(true)
+	amp.SetVolume(25)
+	assert.NoError(t, amp.SetInput(4))
+
+	volumes := make(chan Volume, 1)
+	control := NewControlWithListener(
+		func(bool) {}, func(v Volume) { volumes <- v }, func(bool) {}, func(device.Input) {}, func() {},
+		func(err error) { t.Errorf("unexpected error: %v", err) },
+	)
+	assert.False(t, control.Snapshot().Known())
+
+	before := time.Now()
+	err := control.ConnectWithConfig(context.Background(), "127.0.0.1", device.H190, ConnectConfig{Port: amp.Port()})
+	assert.NoError(t, err)
+	defer control.Disconnect()
+
+	state := control.Snapshot()
+	assert.True(t, state.Known())
+	assert.True(t, state.Power)
+	assert.Equal(t, 25, state.Volume)
+	assert.False(t, state.Mute)
+	assert.Equal(t, 4, state.Input)
+	assert.False(t, state.VolumeUpdated.Before(before))
+
+	// Replies to commands update the state.
+	_, err = control.SetVolumeMute(true)
+	assert.NoError(t, err)
+	assert.True(t, control.Snapshot().Mute)
+	assert.True(t, control.Snapshot().MuteUpdated.After(state.MuteUpdated))
+
+	// Notifications update the state before the callbacks are called.
+	amp.SetVolume(60)
+	assert.Equal(t, 60, <-volumes)
+	assert.Equal(t, 60, control.Snapshot().Volume)
+	assert.True(t, control.Snapshot().VolumeUpdated.After(state.VolumeUpdated))
+	assert.Equal(t, state.InputUpdated, control.Snapshot().InputUpdated)
+}
+
+func TestSnapshotIgnoresErrors(t *testing.T) {
+	control, amplifier := newListenerPipe(t, func(Volume) {})
+	go func() {
+		buf := make([]byte, 16)
+		_, _ = amplifier.Read(buf)
+		_, _ = amplifier.Write([]byte("-e.3\r"))
+	}()
+
+	_, err := control.SetVolume(10)
+	assert.Error(t, err)
+	assert.Equal(t, State{}, control.Snapshot())
+}
+
+func TestSnapshotFollowsPacketOrder(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+
+	entered := make(chan Volume, 1)
+	release := make(chan struct{})
+	control := NewControlWithListener(
+		nil, func(v Volume) { entered <- v; <-release }, nil, nil, nil,
+		func(err error) { t.Errorf("unexpected error: %v", err) },
+	)
+	err := control.ConnectWithConfig(context.Background(), "127.0.0.1", device.H95, ConnectConfig{Port: amp.Port()})
+	assert.NoError(t, err)
+	defer control.Disconnect()
+
+	// The first notification holds up the callbacks, so the second one waits for them.
+	amp.SetVolume(31)
+	assert.Equal(t, 31, <-entered)
+	amp.SetVolume(32)
+
+	deadline := time.Now().Add(time.Second)
+	for control.Snapshot().Volume != 32 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Equal(t, 32, control.Snapshot().Volume)
+
+	// The reply arrives after both notifications and must not be overwritten by them.
+	_, err = control.SetVolume(40)
+	assert.NoError(t, err)
+
+	close(release)
+	assert.Equal(t, 32, <-entered)
+	assert.Equal(t, 40, control.Snapshot().Volume)
+}
@@ -0,0 +1,114 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"time"
+)
+
+// TraceDirection tells if a traced packet was sent to or received from the amplifier.
+type TraceDirection uint8
+
+const (
+	// TraceSent is used for packets written to the amplifier.
+	TraceSent TraceDirection = iota
+
+	// TraceReceived is used for packets read from the amplifier.
+	TraceReceived
+)
+
+// String returns "sent" or "received".
+func (d TraceDirection) String() string {
+	if d == TraceSent {
+		return "sent"
+	}
+	return "received"
+}
+
+// TraceEvent describes a packet that was sent to or received from the amplifier.
+type TraceEvent struct {
+	Time      time.Time
+	Direction TraceDirection
+
+	// Packet is the packet without the trailing carriage return, like "-v.20".
+	Packet string
+
+	// Latency is the time from sending a command until receiving its response.
+	// It is zero for sent packets and for notifications.
+	Latency time.Duration
+}
+
+// Tracer is called with every packet exchanged with the amplifier. It is called from
+// the goroutine reading or writing the connection and should return quickly.
+type Tracer func(event TraceEvent)
+
+// SlogTracer returns a tracer that logs each packet at debug level using the handler.
+func SlogTracer(handler slog.Handler) Tracer {
+	return func(event TraceEvent) {
+		ctx := context.Background()
+		if !handler.Enabled(ctx, slog.LevelDebug) {
+			return
+		}
+
+		record := slog.NewRecord(event.Time, slog.LevelDebug, "Packet "+event.Direction.String(), 0)
+		record.AddAttrs(slog.String("packet", event.Packet))
+		if event.Latency > 0 {
+			record.AddAttrs(slog.Duration("latency", event.Latency))
+		}
+
+		_ = handler.Handle(ctx, record)
+	}
+}
+
+// SetTracer sets a tracer that is called with every packet exchanged with the amplifier.
+// Passing nil turns tracing off.
+func (c *Control) SetTracer(tracer Tracer) {
+	if tracer == nil {
+		c.tracer.Store(nil)
+		return
+	}
+
+	c.tracer.Store(&tracer)
+}
+
+// trace passes the packet on to the tracer, if there is one, and returns the time it was traced at.
+// The time that the command was sent should be passed for responses and a zero time otherwise.
+func (c *Control) trace(direction TraceDirection, packet []byte, sent time.Time) time.Time {
+	tracer := c.tracer.Load()
+	if tracer == nil {
+		return time.Time{}
+	}
+
+	event := TraceEvent{
+		Time:      time.Now(),
+		Direction: direction,
+		Packet:    string(bytes.TrimSuffix(packet, []byte{'\r'})),
+	}
+	if !sent.IsZero() {
+		event.Latency = event.Time.Sub(sent)
+	}
+
+	(*tracer)(event)
+	return event.Time
+}
+
+// SetTracer sets a tracer that is called with every packet exchanged with the amplifier,
+// including notifications. Passing nil turns tracing off.
+func (c *ControlWithListener) SetTracer(tracer Tracer) {
+	c.control.SetTracer(tracer)
+}
+
+// traceIncoming traces a packet read by the session. The latency is included if it answers a request.
+func (c *ControlWithListener) traceIncoming(got readResponse, answered *request) {
+	if got.err != nil {
+		return
+	}
+
+	sent := time.Time{}
+	if answered != nil {
+		sent = answered.sent
+	}
+
+	c.control.trace(TraceReceived, got.buf, sent)
+}
@@ -0,0 +1,95 @@
+package remote
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/alecthomas/assert/v2"
+)
+
+func receiveTrace(t *testing.T, traces <-chan TraceEvent) TraceEvent {
+	t.Helper()
+
+	select {
+	case event := <-traces:
+		assert.False(t, event.Time.IsZero())
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for trace")
+		return TraceEvent{}
+	}
+}
+
+func TestTracer(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+	control := connectToSimulator(t, amp)
+
+	traces := make(chan TraceEvent, 2)
+	control.SetTracer(func(event TraceEvent) { traces <- event })
+
+	_, err := control.SetVolume(20)
+	assert.NoError(t, err)
+
+	sent := receiveTrace(t, traces)
+	assert.Equal(t, TraceSent, sent.Direction)
+	assert.Equal(t, "-v.20", sent.Packet)
+	assert.Zero(t, sent.Latency)
+
+	received := receiveTrace(t, traces)
+	assert.Equal(t, TraceReceived, received.Direction)
+	assert.Equal(t, "-v.20", received.Packet)
+	assert.True(t, received.Latency > 0)
+
+	control.SetTracer(nil)
+	_, err = control.GetVolume()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(traces))
+}
+
+func TestListenerTracer(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+	control := listenToSimulator(t, amp)
+
+	traces := make(chan TraceEvent, 4)
+	control.SetTracer(func(event TraceEvent) { traces <- event })
+
+	_, err := control.SetInput(3)
+	assert.NoError(t, err)
+
+	sent := receiveTrace(t, traces)
+	assert.Equal(t, TraceSent, sent.Direction)
+	assert.Equal(t, "-i.3", sent.Packet)
+
+	received := receiveTrace(t, traces)
+	assert.Equal(t, TraceReceived, received.Direction)
+	assert.Equal(t, "-i.3", received.Packet)
+	assert.True(t, received.Latency > 0)
+
+	amp.SetMute(true)
+	notification := receiveTrace(t, traces)
+	assert.Equal(t, TraceReceived, notification.Direction)
+	assert.Equal(t, "-m.1", notification.Packet)
+	assert.Zero(t, notification.Latency)
+}
+
+func TestSlogTracer(t *testing.T) {
+	out := &bytes.Buffer{}
+	tracer := SlogTracer(slog.NewTextHandler(out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	tracer(TraceEvent{Time: time.Now(), Direction: TraceSent, Packet: "-v.u"})
+	tracer(TraceEvent{Time: time.Now(), Direction: TraceReceived, Packet: "-v.21", Latency: 3 * time.Millisecond})
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+	assert.Contains(t, lines[0], `level=DEBUG msg="Packet sent" packet=-v.u`)
+	assert.Contains(t, lines[1], `msg="Packet received" packet=-v.21 latency=3ms`)
+
+	out.Reset()
+	tracer = SlogTracer(slog.NewTextHandler(out, nil))
+	tracer(TraceEvent{Time: time.Now(), Direction: TraceSent, Packet: "-v.u"})
+	assert.Zero(t, out.Len())
+}
@@ -0,0 +1,216 @@
+package remote
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The transcript format has one event per line. Each line has the number of seconds since
+// the recording started, the kind of event and then the data quoted like a Go string:
+//
+//	# Comments and empty lines are ignored.
+//	0.000 connect "192.168.1.10:50001"
+//	0.001 send "-v.?\r"
+//	0.009 recv "-v.20\r"
+//	2.500 recv "-v.2"
+//	2.501 recv "1\r"
+//	9.000 eof
+//	9.002 close
+//
+// Every read and write is recorded as it happened, so packets split over several reads
+// show up as several recv lines. The time may be left out when writing transcripts by hand.
+
+type entryKind uint8
+
+const (
+	// entryConnect is a new connection to the address in the data.
+	entryConnect entryKind = iota
+
+	// entrySend is data written to the amplifier.
+	entrySend
+
+	// entryRecv is data read from the amplifier.
+	entryRecv
+
+	// entryEOF is the amplifier closing the connection.
+	entryEOF
+
+	// entryClose is the client closing the connection.
+	entryClose
+)
+
+var entryKindNames = [...]string{"connect", "send", "recv", "eof", "close"}
+
+type transcriptEntry struct {
+	line   int
+	offset time.Duration
+	kind   entryKind
+	data   []byte
+}
+
+func (e transcriptEntry) hasData() bool {
+	return e.kind == entryConnect || e.kind == entrySend || e.kind == entryRecv
+}
+
+func (e transcriptEntry) String() string {
+	line := fmt.Sprintf("%.3f %s", e.offset.Seconds(), entryKindNames[e.kind])
+	if e.hasData() {
+		line += " " + strconv.Quote(string(e.data))
+	}
+	return line
+}
+
+// parseTranscript reads all entries of a transcript.
+func parseTranscript(r io.Reader) ([]transcriptEntry, error) {
+	entries := []transcriptEntry{}
+	scanner := bufio.NewScanner(r)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		entry, err := parseTranscriptLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("transcript line %d: %w", number, err)
+		}
+
+		entry.line = number
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
+
+func parseTranscriptLine(line string) (transcriptEntry, error) {
+	entry := transcriptEntry{}
+	first, rest, _ := strings.Cut(line, " ")
+	if seconds, err := strconv.ParseFloat(first, 64); err == nil {
+		entry.offset = time.Duration(seconds * float64(time.Second))
+		first, rest, _ = strings.Cut(strings.TrimSpace(rest), " ")
+	}
+
+	kind := -1
+	for i, name := range entryKindNames {
+		if first == name {
+			kind = i
+		}
+	}
+	if kind == -1 {
+		return entry, fmt.Errorf("unknown event %q", first)
+	}
+	entry.kind = entryKind(kind)
+
+	rest = strings.TrimSpace(rest)
+	if !entry.hasData() {
+		if rest != "" {
+			return entry, fmt.Errorf("unexpected data after %s", first)
+		}
+		return entry, nil
+	}
+
+	data, err := strconv.Unquote(rest)
+	if err != nil {
+		return entry, fmt.Errorf("invalid quoted data %s: %w", rest, err)
+	}
+
+	entry.data = []byte(data)
+	return entry, nil
+}
+
+// Recorder writes a transcript of the connections to an amplifier.
+// The transcript can be served back using [Replay].
+// This data type is thread safe.
+type Recorder struct {
+	lock  sync.Mutex
+	out   io.Writer
+	start time.Time
+	err   error
+}
+
+// NewRecorder creates a recorder that writes the transcript to w.
+func NewRecorder(w io.Writer) *Recorder {
+	r := &Recorder{out: w, start: time.Now()}
+	_, r.err = fmt.Fprintf(w, "# Hegelmote transcript recorded at %s.\n", r.start.Format(time.RFC3339))
+	return r
+}
+
+// Err returns the first error that happened when writing the transcript.
+func (r *Recorder) Err() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.err
+}
+
+// WrapDial returns a function for [ConnectConfig.Dial] that records all connections opened by dial.
+// A nil dial connects using a [net.Dialer].
+func (r *Recorder) WrapDial(dial func(ctx context.Context, network, address string) (net.Conn, error)) func(ctx context.Context, network, address string) (net.Conn, error) {
+	if dial == nil {
+		d := net.Dialer{}
+		dial = d.DialContext
+	}
+
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+
+		return r.Wrap(conn), nil
+	}
+}
+
+// Wrap records everything read from and written to the connection.
+func (r *Recorder) Wrap(conn net.Conn) net.Conn {
+	r.record(entryConnect, []byte(conn.RemoteAddr().String()))
+	return &recordedConn{Conn: conn, recorder: r}
+}
+
+func (r *Recorder) record(kind entryKind, data []byte) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.err != nil {
+		return
+	}
+
+	entry := transcriptEntry{offset: time.Since(r.start), kind: kind, data: data}
+	_, r.err = fmt.Fprintln(r.out, entry)
+}
+
+type recordedConn struct {
+	net.Conn
+	recorder *Recorder
+}
+
+func (c *recordedConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.recorder.record(entryRecv, p[:n])
+	}
+	if errors.Is(err, io.EOF) {
+		c.recorder.record(entryEOF, nil)
+	}
+	return n, err
+}
+
+func (c *recordedConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.recorder.record(entrySend, p[:n])
+	}
+	return n, err
+}
+
+func (c *recordedConn) Close() error {
+	c.recorder.record(entryClose, nil)
+	return c.Conn.Close()
+}
@@ -0,0 +1,88 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestRecorder(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+
+	transcript := &bytes.Buffer{}
+	recorder := NewRecorder(transcript)
+
+	control := &Control{}
+	err := control.ConnectWithConfig(context.Background(), "127.0.0.1", device.H95, ConnectConfig{
+		Port: amp.Port(),
+		Dial: recorder.WrapDial(nil),
+	})
+	assert.NoError(t, err)
+
+	_, err = control.SetVolume(20)
+	assert.NoError(t, err)
+	_, err = control.SendRaw('x', "?")
+	assert.Error(t, err)
+	assert.NoError(t, control.Disconnect())
+	assert.NoError(t, recorder.Err())
+
+	assert.True(t, strings.HasPrefix(transcript.String(), "# Hegelmote transcript recorded at "))
+
+	entries, err := parseTranscript(transcript)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, len(entries))
+
+	expected := []struct {
+		kind entryKind
+		data string
+	}{
+		{entryConnect, amp.Addr().String()},
+		{entrySend, "-v.20\r"},
+		{entryRecv, "-v.20\r"},
+		{entrySend, "-x.?\r"},
+		{entryRecv, "-e.2\r"},
+		{entryClose, ""},
+	}
+	for i, entry := range entries {
+		assert.Equal(t, expected[i].kind, entry.kind)
+		assert.Equal(t, expected[i].data, string(entry.data))
+		assert.True(t, i == 0 || entry.offset >= entries[i-1].offset)
+	}
+}
+
+func TestParseTranscript(t *testing.T) {
+	transcript := `# A hand written transcript.
+0.000 connect "amp:50001"
+
+send "-v.?\r"
+ 1.5   recv "-v.2"
+recv "0\r"
+eof
+`
+	entries, err := parseTranscript(strings.NewReader(transcript))
+	assert.NoError(t, err)
+	assert.Equal(t, []transcriptEntry{
+		{line: 2, kind: entryConnect, data: []byte("amp:50001")},
+		{line: 4, kind: entrySend, data: []byte("-v.?\r")},
+		{line: 5, offset: 1500 * time.Millisecond, kind: entryRecv, data: []byte("-v.2")},
+		{line: 6, kind: entryRecv, data: []byte("0\r")},
+		{line: 7, kind: entryEOF},
+	}, entries)
+
+	assert.Equal(t, `1.500 recv "-v.2"`, entries[2].String())
+	assert.Equal(t, `0.000 eof`, entries[4].String())
+
+	_, err = parseTranscript(strings.NewReader("send \"-v.?\\r\"\nwrite \"-v.?\\r\"\n"))
+	assert.EqualError(t, err, `transcript line 2: unknown event "write"`)
+
+	_, err = parseTranscript(strings.NewReader("send -v.?\n"))
+	assert.Error(t, err)
+
+	_, err = parseTranscript(strings.NewReader("eof \"-v.1\"\n"))
+	assert.EqualError(t, err, "transcript line 1: unexpected data after eof")
+}
@@ -1,47 +1,104 @@
 package remote
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 // Volume specifies a volume in the range 0 to 100.
 type Volume = uint8
 
 // SetVolume sets the volume to a value between 0 and 100.
+// A [*VolumeLimitError] is returned if the volume is above the limit.
 func (c *Control) SetVolume(volume Volume) (Volume, error) {
+	return c.SetVolumeContext(context.Background(), volume)
+}
+
+// SetVolumeContext is like [Control.SetVolume] but gives up when the context is done.
+func (c *Control) SetVolumeContext(ctx context.Context, volume Volume) (Volume, error) {
 	if volume > 100 {
 		return 0, fmt.Errorf("invalid volume: %d", volume)
 	}
 
+	err := c.checkVolumeLimit(ctx, volume)
+	if err != nil {
+		return 0, err
+	}
+
 	packet := createNumericalPacket('v', volume)
-	return c.sendWithNumericalResponse(packet)
+	return c.sendWithNumericalResponse(ctx, packet)
 }
 
 // VolumeUp increases the volume one step.
+// A [*VolumeLimitError] is returned if the step would go above the limit.
 func (c *Control) VolumeUp() (Volume, error) {
-	return c.sendWithNumericalResponse([]byte("-v.u\r"))
+	return c.VolumeUpContext(context.Background())
+}
+
+// VolumeUpContext is like [Control.VolumeUp] but gives up when the context is done.
+func (c *Control) VolumeUpContext(ctx context.Context) (Volume, error) {
+	if c.limit.Load() != nil {
+		volume, err := c.currentVolume(ctx)
+		if err != nil {
+			return volume, err
+		}
+
+		err = c.checkVolumeLimit(ctx, volume+1)
+		if err != nil {
+			return volume, err
+		}
+	}
+
+	return c.sendWithNumericalResponse(ctx, []byte("-v.u\r"))
 }
 
 // VolumeDown decreases the volume one step.
 func (c *Control) VolumeDown() (Volume, error) {
-	return c.sendWithNumericalResponse([]byte("-v.d\r"))
+	return c.VolumeDownContext(context.Background())
+}
+
+// VolumeDownContext is like [Control.VolumeDown] but gives up when the context is done.
+func (c *Control) VolumeDownContext(ctx context.Context) (Volume, error) {
+	return c.sendWithNumericalResponse(ctx, []byte("-v.d\r"))
 }
 
 // GetVolume returns the currrently selected volume percentage.
 func (c *Control) GetVolume() (Volume, error) {
-	return c.sendWithNumericalResponse([]byte("-v.?\r"))
+	return c.GetVolumeContext(context.Background())
+}
+
+// GetVolumeContext is like [Control.GetVolume] but gives up when the context is done.
+func (c *Control) GetVolumeContext(ctx context.Context) (Volume, error) {
+	return c.sendWithNumericalResponse(ctx, []byte("-v.?\r"))
 }
 
 // SetVolumeMute allows turning on or off mute.
 func (c *Control) SetVolumeMute(mute bool) (bool, error) {
+	return c.SetVolumeMuteContext(context.Background(), mute)
+}
+
+// SetVolumeMuteContext is like [Control.SetVolumeMute] but gives up when the context is done.
+func (c *Control) SetVolumeMuteContext(ctx context.Context, mute bool) (bool, error) {
 	packet := createBooleanPacket('m', mute)
-	return c.sendWithBoolResponse(packet)
+	return c.sendWithBoolResponse(ctx, packet)
 }
 
 // ToggleVolumeMute toggles the muting of volume.
 func (c *Control) ToggleVolumeMute() (bool, error) {
-	return c.sendWithBoolResponse([]byte("-m.t\r"))
+	return c.ToggleVolumeMuteContext(context.Background())
+}
+
+// ToggleVolumeMuteContext is like [Control.ToggleVolumeMute] but gives up when the context is done.
+func (c *Control) ToggleVolumeMuteContext(ctx context.Context) (bool, error) {
+	return c.sendWithBoolResponse(ctx, []byte("-m.t\r"))
 }
 
 // GetVolumeMute returns true if the device is muted.
 func (c *Control) GetVolumeMute() (bool, error) {
-	return c.sendWithBoolResponse([]byte("-m.?\r"))
+	return c.GetVolumeMuteContext(context.Background())
+}
+
+// GetVolumeMuteContext is like [Control.GetVolumeMute] but gives up when the context is done.
+func (c *Control) GetVolumeMuteContext(ctx context.Context) (bool, error) {
+	return c.sendWithBoolResponse(ctx, []byte("-m.?\r"))
 }
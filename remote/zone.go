@@ -0,0 +1,415 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ZoneVolumeMode decides how volume changes are passed on within a [ZoneGroup].
+type ZoneVolumeMode uint8
+
+const (
+	// ZoneVolumeAbsolute gives every member the same volume, plus the offset of the member.
+	ZoneVolumeAbsolute ZoneVolumeMode = iota
+
+	// ZoneVolumeRelative changes the volume of every member by the same number of steps.
+	ZoneVolumeRelative
+)
+
+const defaultZoneTimeout = 2 * time.Second
+
+// echoWindow is how long a change made by a zone group may come back as a notification.
+const echoWindow = 2 * time.Second
+
+// ZoneMember is an amplifier in a [ZoneGroup].
+type ZoneMember struct {
+	Name      string
+	Amplifier *ControlWithListener
+
+	// VolumeOffset is added to the volume of the group for this member, like -5 for playing
+	// a bit quieter than the rest. It is used by [ZoneVolumeAbsolute] and [ZoneGroup.SetVolume].
+	VolumeOffset int
+}
+
+// ZoneConfig configures a [ZoneGroup].
+type ZoneConfig struct {
+	// VolumeMode decides how volume changes are passed on. Defaults to [ZoneVolumeAbsolute].
+	VolumeMode ZoneVolumeMode
+
+	// Timeout limits how long to wait for each member when passing on a change. Defaults to 2 seconds.
+	Timeout time.Duration
+
+	// OnError, if set, is called when a change could not be passed on to a member.
+	OnError func(member string, err error)
+}
+
+type zoneField uint8
+
+const (
+	zonePower zoneField = iota
+	zoneMute
+	zoneVolume
+	zoneFields
+)
+
+type zoneChange struct {
+	field zoneField
+	value int
+}
+
+// expectation is a value set by the group that the member may echo back.
+type expectation struct {
+	value int
+	until time.Time
+}
+
+type zoneMember struct {
+	ZoneMember
+
+	state     ConnectionState
+	rejoining bool
+	volume    int
+	expected  [zoneFields]expectation
+}
+
+func (m *zoneMember) expect(change zoneChange) {
+	m.expected[change.field] = expectation{value: change.value, until: time.Now().Add(echoWindow)}
+}
+
+// isEcho reports if the value was just set by the group and should not be passed on.
+func (m *zoneMember) isEcho(field zoneField, value int) bool {
+	expected := m.expected[field]
+	m.expected[field] = expectation{}
+	return expected.value == value && time.Now().Before(expected.until)
+}
+
+func (m *zoneMember) set(ctx context.Context, change zoneChange) error {
+	var err error
+	switch change.field {
+	case zonePower:
+		_, err = m.Amplifier.SetPowerContext(ctx, change.value == 1)
+	case zoneMute:
+		_, err = m.Amplifier.SetVolumeMuteContext(ctx, change.value == 1)
+	case zoneVolume:
+		_, err = m.Amplifier.SetVolumeContext(ctx, Volume(change.value)) // #nosec G115 -- Clamped to 0-100.
+	}
+	return err
+}
+
+type memberEvent struct {
+	member *zoneMember
+	event  Event
+}
+
+// ZoneGroup links the power, muting and volume of several amplifiers, like ones playing
+// the same stream in different rooms. A change reported by any member is passed on to
+// the others. Changes made by the group are not passed on again when echoed back.
+//
+// Only changes reported as notifications are followed, like those made using the front
+// panel, a remote control or another application. Commands sent through a member are not,
+// so use the methods of the group to change all members from the same application.
+//
+// Members that are not connected are skipped. Once reconnected, a member is brought in line
+// with the rest of the group instead of the changes found when reconnecting being passed on.
+// Members are never held up by the group, and the changes of a member reporting them faster
+// than the group can pass them on are skipped in favour of its latest state.
+// This data type is thread safe.
+type ZoneGroup struct {
+	config  ZoneConfig
+	members []*zoneMember
+	stop    context.CancelFunc
+	done    chan struct{}
+
+	lock  sync.Mutex
+	state [zoneFields]int
+	known [zoneFields]bool
+}
+
+// NewZoneGroup links the members until [ZoneGroup.Close] is called. The state of the group
+// starts out as that of the first member, but nothing is changed until a member reports a change.
+func NewZoneGroup(config ZoneConfig, members ...ZoneMember) (*ZoneGroup, error) {
+	if len(members) < 2 {
+		return nil, errors.New("a zone group needs at least two members")
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	g := &ZoneGroup{config: config, stop: stop, done: make(chan struct{})}
+	events := make(chan memberEvent)
+	names := map[string]bool{}
+	for _, member := range members {
+		if member.Amplifier == nil || names[member.Name] {
+			stop()
+			return nil, fmt.Errorf("invalid or duplicate member %q", member.Name)
+		}
+		names[member.Name] = true
+
+		m := &zoneMember{ZoneMember: member}
+		go g.forward(ctx, m, member.Amplifier.SubscribeWithConfig(ctx, followConfig), events)
+
+		m.state = member.Amplifier.GetConnectionState()
+		m.rejoining = m.state != Connected
+		m.volume = int(member.Amplifier.Snapshot().Volume)
+		g.members = append(g.members, m)
+	}
+
+	first := g.members[0]
+	state := first.Amplifier.Snapshot()
+	g.state = [zoneFields]int{boolToInt(state.Power), boolToInt(state.Mute), int(state.Volume) - first.VolumeOffset}
+	g.known = [zoneFields]bool{!state.PowerUpdated.IsZero(), !state.MuteUpdated.IsZero(), !state.VolumeUpdated.IsZero()}
+
+	go g.run(ctx, events)
+	return g, nil
+}
+
+// Close stops linking the members. The amplifiers are left connected.
+func (g *ZoneGroup) Close() {
+	g.stop()
+	<-g.done
+}
+
+// SetPower turns all members on or off.
+func (g *ZoneGroup) SetPower(ctx context.Context, on bool) GroupResult {
+	return g.setAll(ctx, zoneChange{field: zonePower, value: boolToInt(on)})
+}
+
+// SetVolumeMute mutes or unmutes all members.
+func (g *ZoneGroup) SetVolumeMute(ctx context.Context, muted bool) GroupResult {
+	return g.setAll(ctx, zoneChange{field: zoneMute, value: boolToInt(muted)})
+}
+
+// SetVolume sets the volume of all members to the given volume plus the offset of the member.
+func (g *ZoneGroup) SetVolume(ctx context.Context, volume Volume) GroupResult {
+	return g.setAll(ctx, zoneChange{field: zoneVolume, value: int(volume)})
+}
+
+// setAll changes all members. Members that are not connected get the change when they rejoin.
+func (g *ZoneGroup) setAll(ctx context.Context, change zoneChange) GroupResult {
+	g.lock.Lock()
+	changes := g.changesFor(change, nil)
+	g.lock.Unlock()
+
+	result := g.apply(ctx, changes)
+	for _, member := range g.members {
+		if _, ok := result[member.Name]; !ok {
+			result[member.Name] = errNotConnected
+		}
+	}
+
+	return result
+}
+
+// changesFor updates the state of the group and returns the change for each member, except the source.
+// The lock must be held when calling this method.
+func (g *ZoneGroup) changesFor(change zoneChange, source *zoneMember) map[*zoneMember][]zoneChange {
+	g.state[change.field], g.known[change.field] = change.value, true
+
+	changes := map[*zoneMember][]zoneChange{}
+	for _, member := range g.members {
+		if member == source || member.rejoining {
+			continue
+		}
+
+		target := change
+		if change.field == zoneVolume {
+			target.value = clampZoneVolume(change.value + member.VolumeOffset)
+			member.volume = target.value
+		}
+
+		member.expect(target)
+		changes[member] = []zoneChange{target}
+	}
+
+	return changes
+}
+
+// relativeChangesFor returns the volume change for each member when using [ZoneVolumeRelative].
+// The lock must be held when calling this method.
+func (g *ZoneGroup) relativeChangesFor(source *zoneMember, steps int) map[*zoneMember][]zoneChange {
+	changes := map[*zoneMember][]zoneChange{}
+	for _, member := range g.members {
+		if member == source || member.rejoining || steps == 0 {
+			continue
+		}
+
+		target := zoneChange{field: zoneVolume, value: clampZoneVolume(int(member.Amplifier.Snapshot().Volume) + steps)}
+		member.volume = target.value
+		member.expect(target)
+		changes[member] = []zoneChange{target}
+	}
+
+	return changes
+}
+
+// forward passes the events of the member on to the group. The member is never held up by the group.
+// If the group falls behind, the member catches up using its current state, like after reconnecting.
+func (g *ZoneGroup) forward(ctx context.Context, member *zoneMember, events <-chan Event, out chan<- memberEvent) {
+	member.Amplifier.follow(ctx, events, func(event Event) {
+		select {
+		case out <- memberEvent{member: member, event: event}:
+		case <-ctx.Done():
+		}
+	})
+}
+
+func (g *ZoneGroup) run(ctx context.Context, events <-chan memberEvent) {
+	defer close(g.done)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case got := <-events:
+			g.handle(ctx, got.member, got.event)
+		}
+	}
+}
+
+func (g *ZoneGroup) handle(ctx context.Context, member *zoneMember, event Event) {
+	switch event := event.(type) {
+	case ConnectionStateChanged:
+		g.connectionChanged(ctx, member, event.State)
+	case Resynced:
+		g.rejoin(ctx, member)
+	case PowerChanged:
+		g.follow(ctx, member, zoneChange{field: zonePower, value: boolToInt(event.PoweredOn)})
+	case MuteChanged:
+		g.follow(ctx, member, zoneChange{field: zoneMute, value: boolToInt(event.Muted)})
+	case VolumeChanged:
+		g.follow(ctx, member, zoneChange{field: zoneVolume, value: int(event.Volume)})
+	}
+}
+
+func (g *ZoneGroup) connectionChanged(ctx context.Context, member *zoneMember, state ConnectionState) {
+	g.lock.Lock()
+	previous := member.state
+	member.state = state
+	if state != Connected {
+		member.rejoining = true
+	}
+	g.lock.Unlock()
+
+	// A new connection does not report the state it finds, unlike a reconnection, so it can rejoin right away.
+	if state == Connected && previous == Connecting {
+		g.rejoin(ctx, member)
+	}
+}
+
+// follow passes on a change reported by a member to the rest of the group.
+func (g *ZoneGroup) follow(ctx context.Context, source *zoneMember, change zoneChange) {
+	g.lock.Lock()
+	steps := 0
+	if change.field == zoneVolume {
+		steps = change.value - source.volume
+		source.volume = change.value
+	}
+
+	if source.rejoining || source.isEcho(change.field, change.value) {
+		g.lock.Unlock()
+		return
+	}
+
+	var changes map[*zoneMember][]zoneChange
+	switch {
+	case change.field == zoneVolume && g.config.VolumeMode == ZoneVolumeRelative:
+		changes = g.relativeChangesFor(source, steps)
+	case change.field == zoneVolume:
+		change.value -= source.VolumeOffset
+		changes = g.changesFor(change, source)
+	default:
+		changes = g.changesFor(change, source)
+	}
+	g.lock.Unlock()
+
+	g.report(g.apply(ctx, changes))
+}
+
+// rejoin brings a member that was disconnected in line with the rest of the group.
+func (g *ZoneGroup) rejoin(ctx context.Context, member *zoneMember) {
+	g.lock.Lock()
+	if !member.rejoining {
+		g.lock.Unlock()
+		return // Caught up on events missed while connected, which were followed as usual.
+	}
+	member.rejoining = false
+
+	changes := []zoneChange{}
+	for field := range zoneFields {
+		if !g.known[field] || (field == zoneVolume && g.config.VolumeMode == ZoneVolumeRelative) {
+			continue
+		}
+
+		change := zoneChange{field: field, value: g.state[field]}
+		if field == zoneVolume {
+			change.value = clampZoneVolume(change.value + member.VolumeOffset)
+			member.volume = change.value
+		}
+
+		member.expect(change)
+		changes = append(changes, change)
+	}
+	g.lock.Unlock()
+
+	g.report(g.apply(ctx, map[*zoneMember][]zoneChange{member: changes}))
+}
+
+// apply makes the changes to each member concurrently and waits for all of them.
+func (g *ZoneGroup) apply(ctx context.Context, changes map[*zoneMember][]zoneChange) GroupResult {
+	timeout := g.config.Timeout
+	if timeout <= 0 {
+		timeout = defaultZoneTimeout
+	}
+
+	resultLock := sync.Mutex{}
+	result := make(GroupResult, len(changes))
+
+	wg := sync.WaitGroup{}
+	for member, memberChanges := range changes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			var err error
+			for _, change := range memberChanges {
+				if err = member.set(ctx, change); err != nil {
+					break
+				}
+			}
+
+			resultLock.Lock()
+			result[member.Name] = err
+			resultLock.Unlock()
+		}()
+	}
+
+	wg.Wait()
+	return result
+}
+
+func (g *ZoneGroup) report(result GroupResult) {
+	if g.config.OnError == nil {
+		return
+	}
+
+	for name, err := range result {
+		if err != nil {
+			g.config.OnError(name, err)
+		}
+	}
+}
+
+func clampZoneVolume(volume int) int {
+	return min(max(volume, 0), 100)
+}
+
+func boolToInt(value bool) int {
+	if value {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,234 @@
+package remote
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Jacalz/hegelmote/device"
+	"github.com/Jacalz/hegelmote/remote/hegelsim"
+	"github.com/alecthomas/assert/v2"
+)
+
+func newTestZoneGroup(t *testing.T, config ZoneConfig, members ...ZoneMember) *ZoneGroup {
+	t.Helper()
+
+	if config.OnError == nil {
+		config.OnError = func(member string, err error) { t.Errorf("unexpected error for %s: %v", member, err) }
+	}
+
+	group, err := NewZoneGroup(config, members...)
+	assert.NoError(t, err)
+	t.Cleanup(group.Close)
+	return group
+}
+
+func waitForState(t *testing.T, amp *hegelsim.Amplifier, check func(state hegelsim.State) bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !check(amp.State()) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for state, got %+v", amp.State())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestZoneGroupFollows(t *testing.T) {
+	listeningRoom := newSimulator(t, device.H390)
+	lounge := newSimulator(t, device.H95)
+
+	newTestZoneGroup(t, ZoneConfig{},
+		ZoneMember{Name: "listening room", Amplifier: listenToSimulator(t, listeningRoom)},
+		ZoneMember{Name: "lounge", Amplifier: listenToSimulator(t, lounge), VolumeOffset: -5},
+	)
+
+	listeningRoom.SetVolume(40)
+	waitForState(t, lounge, func(state hegelsim.State) bool { return state.Volume == 35 })
+
+	lounge.SetVolume(20)
+	waitForState(t, listeningRoom, func(state hegelsim.State) bool { return state.Volume == 25 })
+
+	lounge.SetMute(true)
+	waitForState(t, listeningRoom, func(state hegelsim.State) bool { return state.Mute })
+
+	listeningRoom.SetPower(true)
+	waitForState(t, lounge, func(state hegelsim.State) bool { return state.Power })
+
+	listeningRoom.SetVolume(2)
+	waitForState(t, lounge, func(state hegelsim.State) bool { return state.Volume == 0 })
+}
+
+func TestZoneGroupRelative(t *testing.T) {
+	first := newSimulator(t, device.H95)
+	first.SetVolume(20)
+	second := newSimulator(t, device.H95)
+	second.SetVolume(50)
+
+	newTestZoneGroup(t, ZoneConfig{VolumeMode: ZoneVolumeRelative},
+		ZoneMember{Name: "first", Amplifier: listenToSimulator(t, first)},
+		ZoneMember{Name: "second", Amplifier: listenToSimulator(t, second)},
+	)
+
+	first.SetVolume(25)
+	waitForState(t, second, func(state hegelsim.State) bool { return state.Volume == 55 })
+
+	second.SetVolume(45)
+	waitForState(t, first, func(state hegelsim.State) bool { return state.Volume == 15 })
+}
+
+func TestZoneGroupIgnoresEcho(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+	first := listenToSimulator(t, amp)
+
+	// The second amplifier sends the change made by the group back as a notification.
+	replay := newReplay(t, `
+send "-r.3\r"
+recv "-r.3\r"
+send "-p.?\r"
+recv "-p.1\r"
+send "-v.?\r"
+recv "-v.30\r"
+send "-m.?\r"
+recv "-m.0\r"
+send "-i.?\r"
+recv "-i.1\r"
+send "-v.25\r"
+recv "-v.25\r"
+recv "-v.25\r"
+`)
+	second := NewControlWithListener(nil, nil, nil, nil, nil, func(err error) { t.Errorf("unexpected error: %v", err) })
+	err := second.ConnectWithConfig(context.Background(), "amp", device.H95, ConnectConfig{Dial: replay.Dial})
+	assert.NoError(t, err)
+	defer second.Disconnect()
+
+	newTestZoneGroup(t, ZoneConfig{},
+		ZoneMember{Name: "first", Amplifier: first},
+		ZoneMember{Name: "second", Amplifier: second, VolumeOffset: 5},
+	)
+
+	lock := sync.Mutex{}
+	sent := []string{}
+	first.SetTracer(func(event TraceEvent) {
+		if event.Direction == TraceSent {
+			lock.Lock()
+			sent = append(sent, event.Packet)
+			lock.Unlock()
+		}
+	})
+
+	amp.SetVolume(20)
+	deadline := time.Now().Add(time.Second)
+	for second.Snapshot().Volume != 25 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Equal(t, 25, second.Snapshot().Volume)
+
+	time.Sleep(50 * time.Millisecond)
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Zero(t, sent)
+}
+
+func TestZoneGroupRejoin(t *testing.T) {
+	stable := newSimulator(t, device.H95)
+	flaky := newSimulator(t, device.H95)
+
+	flakyControl := NewControlWithListener(nil, nil, nil, nil, nil, nil)
+	flakyControl.Reconnect = &ReconnectPolicy{InitialDelay: 100 * time.Millisecond}
+	err := flakyControl.ConnectWithConfig(context.Background(), "127.0.0.1", device.H95, ConnectConfig{Port: flaky.Port()})
+	assert.NoError(t, err)
+	defer flakyControl.Disconnect()
+
+	group := newTestZoneGroup(t, ZoneConfig{},
+		ZoneMember{Name: "stable", Amplifier: listenToSimulator(t, stable)},
+		ZoneMember{Name: "flaky", Amplifier: flakyControl},
+	)
+
+	// Changes made while a member is away are not passed on to it, and the
+	// changes found on it when reconnecting are not passed on to the others.
+	flaky.Reset()
+	for flakyControl.GetConnectionState() == Connected {
+		time.Sleep(time.Millisecond)
+	}
+
+	stable.SetVolume(40)
+	flaky.SetVolume(70)
+	waitForState(t, flaky, func(state hegelsim.State) bool { return state.Volume == 40 })
+	assert.Equal(t, 40, stable.State().Volume)
+
+	result := group.SetVolumeMute(context.Background(), true)
+	assert.NoError(t, result.Err())
+	assert.True(t, stable.State().Mute)
+	assert.True(t, flaky.State().Mute)
+
+	assert.NoError(t, flakyControl.Disconnect())
+	result = group.SetVolume(context.Background(), 10)
+	assert.NoError(t, result["stable"])
+	assert.IsError(t, result["flaky"], errNotConnected)
+	assert.Equal(t, 10, stable.State().Volume)
+}
+
+func TestZoneGroupErrors(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+	control := listenToSimulator(t, amp)
+
+	_, err := NewZoneGroup(ZoneConfig{}, ZoneMember{Name: "alone", Amplifier: control})
+	assert.Error(t, err)
+
+	_, err = NewZoneGroup(ZoneConfig{}, ZoneMember{Name: "same", Amplifier: control}, ZoneMember{Name: "same", Amplifier: control})
+	assert.Error(t, err)
+
+	limited := newSimulator(t, device.H95)
+	limitedControl := listenToSimulator(t, limited)
+	limitedControl.SetVolumeLimit(&VolumeLimit{Max: 30})
+
+	errs := make(chan string, 1)
+	newTestZoneGroup(t, ZoneConfig{OnError: func(member string, err error) { errs <- member + ": " + err.Error() }},
+		ZoneMember{Name: "free", Amplifier: control},
+		ZoneMember{Name: "limited", Amplifier: limitedControl},
+	)
+
+	amp.SetVolume(50)
+	select {
+	case got := <-errs:
+		assert.True(t, strings.HasPrefix(got, "limited: volume 50 is above the limit"))
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for error")
+	}
+}
+
+func TestZoneGroupSlowToFollow(t *testing.T) {
+	amp := newSimulator(t, device.H95)
+	control := listenToSimulator(t, amp)
+	limited := newSimulator(t, device.H95)
+	limitedControl := listenToSimulator(t, limited)
+	limitedControl.SetVolumeLimit(&VolumeLimit{Max: 30})
+
+	// The group is held up while reporting the first error.
+	release := make(chan struct{})
+	newTestZoneGroup(t, ZoneConfig{OnError: func(string, error) { <-release }},
+		ZoneMember{Name: "free", Amplifier: control},
+		ZoneMember{Name: "limited", Amplifier: limitedControl},
+	)
+
+	amp.SetVolume(50)
+	for volume := range Volume(100) {
+		amp.SetVolume(volume % 20)
+	}
+	amp.SetVolume(10)
+
+	// The member keeps working while the group is behind.
+	for deadline := time.Now().Add(time.Second); control.Snapshot().Volume != 10; {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the notifications")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	close(release)
+	waitForState(t, limited, func(state hegelsim.State) bool { return state.Volume == 10 })
+}